@@ -0,0 +1,66 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/models"
+)
+
+// DistanceMatrix reads a JSON matrix request (as per POST /matrix) from
+// inputPath, and writes the resulting matrix as JSON to outputPath, or to
+// stdout if no path is given.
+func DistanceMatrix(inputPath string, profilesPath string, outputPath string) error {
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("error reading file: %v", err)
+	}
+
+	var req models.MatrixRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("error parsing matrix request: %v", err)
+	}
+
+	config := db.ConfigFromEnv()
+	ctx := context.Background()
+
+	pool, err := db.NewDBPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create database pool: %v", err)
+	}
+	defer pool.Close()
+
+	service, err := newRoutingService(ctx, pool, profilesPath, EngineOptions{})
+	if err != nil {
+		return err
+	}
+
+	matrix, err := service.Matrix(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to compute matrix: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("error creating file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := json.NewEncoder(out).Encode(matrix); err != nil {
+		return fmt.Errorf("failed to write matrix: %v", err)
+	}
+
+	if outputPath != "" {
+		log.Printf("%dx%d matrix written to %s", len(matrix.Origins), len(matrix.Destinations), outputPath)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/graph"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+// ExportGraph loads the road network from the database and writes it to a
+// graph snapshot file, from which servers can start without a database.
+func ExportGraph(outputPath string) error {
+	config := db.ConfigFromEnv()
+	ctx := context.Background()
+
+	pool, err := db.NewDBPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create database pool: %v", err)
+	}
+	defer pool.Close()
+
+	g, err := graph.Load(ctx, repository.NewNetworkRepository(pool))
+	if err != nil {
+		return fmt.Errorf("failed to load routing graph: %v", err)
+	}
+
+	if err := writeAtomically(outputPath, g.WriteSnapshot); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote graph snapshot to %s", outputPath)
+	return nil
+}
+
+func readGraph(path string) (*graph.Graph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open graph snapshot: %v", err)
+	}
+	defer file.Close()
+
+	g, err := graph.ReadSnapshot(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return g, nil
+}
@@ -0,0 +1,68 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/elevation"
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+	"github.com/schollz/progressbar/v3"
+)
+
+// ImportDEM samples the digital elevation model (an OS Terrain 50 ASCII grid
+// or GeoTIFF tile, or a directory of them) along every road link, and stores each
+// link's ascent, descent, maximum gradient and vertex heights.
+func ImportDEM(path string) error {
+	dem, err := elevation.LoadDEM(path)
+	if err != nil {
+		return fmt.Errorf("failed to load elevation model: %v", err)
+	}
+	log.Printf("Loaded %d elevation grid tiles", dem.Grids())
+
+	config := db.ConfigFromEnv()
+	ctx := context.Background()
+
+	pool, err := db.NewDBPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create database pool: %v", err)
+	}
+	defer pool.Close()
+
+	repo := repository.NewElevationRepository(pool)
+
+	bar := progressbar.Default(-1, "sampling elevations")
+	elevations := make([]models.LinkElevation, 0, BATCH_SIZE)
+	stored, uncovered := 0, 0
+	err = repo.StreamLinkGeometries(ctx, func(id int64, line models.LineString) error {
+		bar.Add(1)
+		link, ok := dem.LinkElevation(id, line)
+		if !ok {
+			uncovered++
+			return nil
+		}
+
+		elevations = append(elevations, *link)
+		if len(elevations) == BATCH_SIZE {
+			if err := repo.StoreLinkElevations(ctx, elevations...); err != nil {
+				return fmt.Errorf("failed to save: %v", err)
+			}
+			stored += len(elevations)
+			elevations = elevations[:0]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := repo.StoreLinkElevations(ctx, elevations...); err != nil {
+		return fmt.Errorf("failed to save: %v", err)
+	}
+	stored += len(elevations)
+	bar.Finish()
+
+	log.Printf("Stored elevations for %d road links (%d not covered by the model)", stored, uncovered)
+	return nil
+}
@@ -130,6 +130,10 @@ func ImportGmlData(path string) error {
 	if err != nil {
 		return fmt.Errorf("failed to save: %v", err)
 	}
+	_, err = repo.LinkMotorwayJunctions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to link motorway junctions: %v", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,74 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/routing"
+)
+
+// MatchTrace map-matches the GPS trace in inputPath (GPX or CSV, as per the
+// format, or else the file extension) against the road network, and writes
+// the result as JSON to outputPath, or to stdout if no path is given.
+func MatchTrace(inputPath string, format string, profilesPath string, outputPath string) error {
+	if format == "" {
+		format = strings.ToLower(strings.TrimPrefix(filepath.Ext(inputPath), "."))
+	}
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	trace, err := routing.ParseTrace(file, format)
+	if err != nil {
+		return fmt.Errorf("error reading trace: %v", err)
+	}
+
+	config := db.ConfigFromEnv()
+	ctx := context.Background()
+
+	pool, err := db.NewDBPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create database pool: %v", err)
+	}
+	defer pool.Close()
+
+	service, err := newRoutingService(ctx, pool, profilesPath, EngineOptions{})
+	if err != nil {
+		return err
+	}
+
+	result, err := service.MatchTrace(ctx, trace)
+	if err != nil {
+		return fmt.Errorf("failed to match trace: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("error creating file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := json.NewEncoder(out).Encode(result); err != nil {
+		return fmt.Errorf("failed to write match: %v", err)
+	}
+
+	if outputPath != "" {
+		log.Printf("Matched %d points onto %d links (%.1f km, confidence %.2f), written to %s",
+			len(result.Points), len(result.Links), result.DistanceM/1000, result.Confidence, outputPath)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/routing"
+)
+
+// PlanRoute computes a route through the "lat,lon" waypoints, in order, and
+// writes it in the given format to outputPath, or to stdout if no path is
+// given. If avoidAreasPath is given, the route avoids the polygons in that
+// GeoJSON file.
+func PlanRoute(waypoints []string, opts routing.RouteOptions, profilesPath string, avoidAreasPath string, format string, outputPath string) error {
+	if _, err := routing.ContentType(format); err != nil {
+		return err
+	}
+
+	if avoidAreasPath != "" {
+		data, err := os.ReadFile(avoidAreasPath)
+		if err != nil {
+			return fmt.Errorf("error reading avoid areas: %v", err)
+		}
+		if opts.Avoid.Areas, err = models.ParseAvoidAreas(data); err != nil {
+			return fmt.Errorf("invalid avoid areas in %s: %v", avoidAreasPath, err)
+		}
+	}
+
+	coords := make([]models.Coordinate, len(waypoints))
+	for i, waypoint := range waypoints {
+		coord, err := models.ParseCoordinate(waypoint)
+		if err != nil {
+			return fmt.Errorf("invalid waypoint %d: %v", i+1, err)
+		}
+		coords[i] = *coord
+	}
+
+	config := db.ConfigFromEnv()
+	ctx := context.Background()
+
+	pool, err := db.NewDBPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create database pool: %v", err)
+	}
+	defer pool.Close()
+
+	service, err := newRoutingService(ctx, pool, profilesPath, EngineOptions{})
+	if err != nil {
+		return err
+	}
+
+	route, err := service.Route(ctx, coords, opts)
+	if err != nil {
+		return fmt.Errorf("failed to plan route: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("error creating file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := service.WriteRoute(ctx, out, route, format); err != nil {
+		return fmt.Errorf("failed to write route: %v", err)
+	}
+
+	if outputPath != "" {
+		log.Printf("Route of %.1f km (%.0f min) written to %s", route.DistanceM/1000, route.DurationS/60, outputPath)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package cmds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/graph"
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+	"github.com/rm-hull/route-planner/routing"
+)
+
+// Prepare loads the road network into memory (from the graph snapshot if
+// one is given, or the database otherwise) and builds a contraction
+// hierarchy for each of the named profiles (or all of them, if none are
+// named), writing each to a file in outputDir.
+func Prepare(profilesPath string, names []string, outputDir string, graphPath string) error {
+	profiles, err := routing.LoadProfiles(profilesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load profiles: %v", err)
+	}
+
+	if len(names) == 0 {
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	selected := make([]*models.Profile, len(names))
+	for i, name := range names {
+		if selected[i], err = routing.ResolveProfile(profiles, routing.RouteOptions{Profile: name}); err != nil {
+			return err
+		}
+	}
+
+	var g *graph.Graph
+	if graphPath != "" {
+		if g, err = readGraph(graphPath); err != nil {
+			return err
+		}
+	} else {
+		ctx := context.Background()
+		pool, err := db.NewDBPool(ctx, db.ConfigFromEnv())
+		if err != nil {
+			return fmt.Errorf("failed to create database pool: %v", err)
+		}
+		defer pool.Close()
+
+		if g, err = graph.Load(ctx, repository.NewNetworkRepository(pool)); err != nil {
+			return fmt.Errorf("failed to load routing graph: %v", err)
+		}
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", outputDir, err)
+	}
+
+	for _, profile := range selected {
+		h, err := g.Contract(profile)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(outputDir, graph.HierarchyFileName(profile))
+		if err := writeAtomically(path, h.Write); err != nil {
+			return err
+		}
+		log.Printf("Wrote %s", path)
+	}
+	return nil
+}
+
+// writeAtomically writes a file alongside its destination and renames it
+// into place, so that a server never sees a partially written file.
+func writeAtomically(path string, write func(w io.Writer) error) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", tmpPath, err)
+	}
+	defer os.Remove(tmpPath)
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", tmpPath, err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// loadHierarchies attaches the hierarchy for each profile found in dir to
+// the graph. Profiles without one are routed with plain Dijkstra.
+func loadHierarchies(g *graph.Graph, profiles map[string]models.Profile, dir string) error {
+	for name := range profiles {
+		profile, err := routing.ResolveProfile(profiles, routing.RouteOptions{Profile: name})
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, graph.HierarchyFileName(profile))
+		file, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("No contraction hierarchy for profile '%s'; run prepare to speed it up", name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", path, err)
+		}
+
+		h, err := graph.ReadHierarchy(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err := g.UseHierarchy(h, profile); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		log.Printf("Loaded contraction hierarchy for profile '%s' from %s", name, path)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rm-hull/route-planner/db"
+)
+
+// SearchRoads finds roads by name or number, and writes them as JSON to
+// outputPath, or to stdout if no path is given.
+func SearchRoads(query string, limit int, profilesPath string, outputPath string) error {
+	config := db.ConfigFromEnv()
+	ctx := context.Background()
+
+	pool, err := db.NewDBPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create database pool: %v", err)
+	}
+	defer pool.Close()
+
+	service, err := newRoutingService(ctx, pool, profilesPath, EngineOptions{})
+	if err != nil {
+		return err
+	}
+
+	roads, err := service.SearchRoads(ctx, query, limit)
+	if err != nil {
+		return fmt.Errorf("failed to search roads: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("error creating file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := json.NewEncoder(out).Encode(roads); err != nil {
+		return fmt.Errorf("failed to write roads: %v", err)
+	}
+	return nil
+}
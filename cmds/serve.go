@@ -0,0 +1,129 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/graph"
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+	"github.com/rm-hull/route-planner/routing"
+	"github.com/rm-hull/route-planner/server"
+)
+
+// Options for the engine behind the routing service
+type EngineOptions struct {
+	// Load the road network into memory and route there, rather than with
+	// pgRouting
+	InMemory bool
+	// Directory of contraction hierarchies written by prepare; implies
+	// InMemory
+	HierarchiesDir string
+	// Graph snapshot written by export-graph to load instead of querying
+	// the database, which is then not used at all
+	GraphPath string
+}
+
+func Serve(addr string, profilesPath string, engineOpts EngineOptions) error {
+	ctx := context.Background()
+
+	var service *routing.Service
+	var tiles repository.TileRepository
+	if engineOpts.GraphPath != "" {
+		var err error
+		if service, err = newSnapshotService(profilesPath, engineOpts); err != nil {
+			return err
+		}
+	} else {
+		pool, err := db.NewDBPool(ctx, db.ConfigFromEnv())
+		if err != nil {
+			return fmt.Errorf("failed to create database pool: %v", err)
+		}
+		defer pool.Close()
+
+		if service, err = newRoutingService(ctx, pool, profilesPath, engineOpts); err != nil {
+			return err
+		}
+		if tiles, err = repository.NewTileRepository(pool); err != nil {
+			return fmt.Errorf("failed to initialize tile repo: %v", err)
+		}
+	}
+
+	log.Printf("Listening on %s", addr)
+	return http.ListenAndServe(addr, server.NewServer(service, tiles))
+}
+
+// newRoutingService creates a routing service over the database. If the
+// options ask for it, the whole road network is first loaded into memory
+// and paths are found (and traces matched) there, rather than with pgRouting
+// (and a graph of the region around each trace).
+func newRoutingService(ctx context.Context, pool *pgxpool.Pool, profilesPath string, engineOpts EngineOptions) (*routing.Service, error) {
+	repo, err := repository.NewRoutingRepository(pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize repo: %v", err)
+	}
+
+	profiles, err := routing.LoadProfiles(profilesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profiles: %v", err)
+	}
+
+	for _, profile := range profiles {
+		if err := repo.ValidateProfile(&profile); err != nil {
+			return nil, err
+		}
+	}
+
+	if !engineOpts.InMemory && engineOpts.HierarchiesDir == "" {
+		matcher := graph.NewRegionMatcher(repository.NewNetworkRepository(pool))
+		return routing.NewService(repo, repo, matcher, profiles), nil
+	}
+
+	g, err := graph.Load(ctx, repository.NewNetworkRepository(pool))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routing graph: %v", err)
+	}
+	if err := prepareGraph(g, profiles, engineOpts); err != nil {
+		return nil, err
+	}
+
+	return routing.NewService(repo, g, g, profiles), nil
+}
+
+// newSnapshotService creates a routing service entirely from a graph
+// snapshot, without a database.
+func newSnapshotService(profilesPath string, engineOpts EngineOptions) (*routing.Service, error) {
+	profiles, err := routing.LoadProfiles(profilesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profiles: %v", err)
+	}
+
+	g, err := readGraph(engineOpts.GraphPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareGraph(g, profiles, engineOpts); err != nil {
+		return nil, err
+	}
+
+	return routing.NewService(nil, g, g, profiles), nil
+}
+
+// prepareGraph checks the profiles against the graph's ref-data, and
+// attaches any contraction hierarchies.
+func prepareGraph(g *graph.Graph, profiles map[string]models.Profile, engineOpts EngineOptions) error {
+	for _, profile := range profiles {
+		if err := g.ValidateProfile(&profile); err != nil {
+			return err
+		}
+	}
+
+	if engineOpts.HierarchiesDir != "" {
+		return loadHierarchies(g, profiles, engineOpts.HierarchiesDir)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+	"github.com/rm-hull/route-planner/tiles"
+	"github.com/schollz/progressbar/v3"
+)
+
+// Fields of each vector tile layer, as listed in archive metadata
+var tileLayers = []map[string]any{
+	{
+		"id": "road_links",
+		"fields": map[string]string{
+			"gml_id": "String", "name1": "String", "road_classification_number": "String",
+			"road_classification": "String", "road_function": "String", "form_of_way": "String",
+			"primary_route": "Boolean", "trunk_road": "Boolean",
+		},
+	},
+	{
+		"id":      "road_nodes",
+		"minzoom": repository.MIN_TILE_ZOOM_NODES,
+		"fields":  map[string]string{"gml_id": "String", "form_of_road_node": "String"},
+	},
+}
+
+type renderedTile struct {
+	tile models.TileCoord
+	mvt  []byte
+	err  error
+}
+
+// GenerateTiles renders vector tiles of the road network (as served by
+// /tiles) at each zoom level from minZoom to maxZoom, over the bounding box
+// ("min_lat,min_lon,max_lat,max_lon") or else the whole network, into a
+// PMTiles archive at outputPath.
+func GenerateTiles(outputPath string, minZoom int, maxZoom int, bbox string) error {
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".pmtiles":
+	case ".mbtiles":
+		return fmt.Errorf("MBTiles output needs an SQLite driver, which is not included: write a .pmtiles archive instead")
+	default:
+		return fmt.Errorf("unsupported tile archive '%s': expected a .pmtiles file", outputPath)
+	}
+	if minZoom < 0 || maxZoom > models.MAX_TILE_ZOOM || minZoom > maxZoom {
+		return fmt.Errorf("zoom levels must be between 0 and %d, with the minimum no more than the maximum", models.MAX_TILE_ZOOM)
+	}
+
+	config := db.ConfigFromEnv()
+	ctx := context.Background()
+
+	pool, err := db.NewDBPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create database pool: %v", err)
+	}
+	defer pool.Close()
+
+	repo, err := repository.NewTileRepository(pool)
+	if err != nil {
+		return fmt.Errorf("failed to initialize repo: %v", err)
+	}
+
+	var bounds *models.BoundingBox
+	if bbox != "" {
+		bounds, err = models.ParseBoundingBox(bbox)
+	} else {
+		bounds, err = repo.Bounds(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for z := minZoom; z <= maxZoom; z++ {
+		models.TilesIn(*bounds, z, func(models.TileCoord) error {
+			total++
+			return nil
+		})
+	}
+
+	writer, err := tiles.NewPMTilesWriter()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	jobs := make(chan models.TileCoord)
+	results := make(chan renderedTile)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for range int(pool.Config().MaxConns) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tile := range jobs {
+				mvt, err := repo.Tile(ctx, tile)
+				results <- renderedTile{tile: tile, mvt: mvt, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for z := minZoom; z <= maxZoom; z++ {
+			err := models.TilesIn(*bounds, z, func(tile models.TileCoord) error {
+				select {
+				case jobs <- tile:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	bar := progressbar.Default(int64(total), "rendering tiles")
+	written := 0
+	for result := range results {
+		bar.Add(1)
+		if err == nil && result.err != nil {
+			err = result.err
+			cancel()
+		}
+		if err != nil || len(result.mvt) == 0 {
+			continue
+		}
+		if err = writer.WriteTile(result.tile, result.mvt); err != nil {
+			cancel()
+			continue
+		}
+		written++
+	}
+	bar.Finish()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+
+	metadata := map[string]any{
+		"name":          "route-planner",
+		"description":   "Road network imported from OS Open Roads",
+		"format":        "pbf",
+		"type":          "overlay",
+		"vector_layers": tileLayers,
+	}
+	if err := writer.Finish(file, metadata, *bounds); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote %d tiles (zoom %d-%d) to %s", written, minZoom, maxZoom, outputPath)
+	return nil
+}
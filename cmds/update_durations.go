@@ -0,0 +1,35 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rm-hull/route-planner/db"
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+func UpdateDurations() error {
+	config := db.ConfigFromEnv()
+	ctx := context.Background()
+
+	pool, err := db.NewDBPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to create database pool: %v", err)
+	}
+	defer pool.Close()
+
+	repo, err := repository.NewGmlRepository(pool)
+	if err != nil {
+		return fmt.Errorf("failed to initialize repo: %v", err)
+	}
+
+	count, err := repo.UpdateDurations(ctx, models.DefaultSpeedModel)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Updated durations for %d road links", count)
+	return nil
+}
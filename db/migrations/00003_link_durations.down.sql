@@ -0,0 +1 @@
+ALTER TABLE road_links DROP COLUMN duration_s;
@@ -0,0 +1 @@
+ALTER TABLE road_links ADD COLUMN duration_s NUMERIC(8,2);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_road_links_road_classification_number_trgm;
+DROP INDEX IF EXISTS idx_road_links_name1_trgm;
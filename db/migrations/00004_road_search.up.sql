@@ -0,0 +1,4 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_road_links_name1_trgm ON road_links USING GIN (name1 gin_trgm_ops);
+CREATE INDEX idx_road_links_road_classification_number_trgm ON road_links USING GIN (road_classification_number gin_trgm_ops);
@@ -0,0 +1 @@
+DROP TABLE motorway_junctions;
@@ -0,0 +1,11 @@
+CREATE TABLE motorway_junctions (
+    id BIGINT PRIMARY KEY,
+    gml_id TEXT NOT NULL UNIQUE,
+    junction_number TEXT NOT NULL,
+    road_classification_number TEXT, -- of the nearest motorway link
+    road_node_id BIGINT REFERENCES road_nodes(id) ON DELETE SET NULL,
+    location GEOMETRY(POINT, 4326) NOT NULL -- WSG84 SRID
+);
+
+CREATE INDEX idx_motorway_junctions_number ON motorway_junctions (road_classification_number, junction_number);
+CREATE INDEX idx_motorway_junctions_location ON motorway_junctions USING GIST (location);
@@ -0,0 +1,5 @@
+ALTER TABLE road_links
+    DROP COLUMN ascent_m,
+    DROP COLUMN descent_m,
+    DROP COLUMN max_gradient,
+    DROP COLUMN elevations;
@@ -0,0 +1,5 @@
+ALTER TABLE road_links
+    ADD COLUMN ascent_m NUMERIC(7,1), -- in the direction of digitisation
+    ADD COLUMN descent_m NUMERIC(7,1),
+    ADD COLUMN max_gradient NUMERIC(5,3), -- rise over run, e.g. 0.1 for 10%
+    ADD COLUMN elevations REAL[]; -- height (m) at each vertex of center_line
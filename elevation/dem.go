@@ -0,0 +1,208 @@
+package elevation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Size (in metres) of the cells used to index grid tiles by location. OS
+// Terrain 50 tiles each cover 10km x 10km of the national grid.
+const DEM_INDEX_CELL_M = 10_000.0
+
+// A grid of heights (in metres), with rows running north to south, in
+// British National Grid coordinates (EPSG:27700)
+type Grid struct {
+	cols, rows int
+	// Centre of the south-west cell
+	x0, y0   float64
+	cellSize float64
+	heights  []float32
+}
+
+// ReadASCIIGrid reads an Esri ASCII grid, as OS Terrain 50 is supplied in.
+// Cells holding the NODATA_value are stored as NaN.
+func ReadASCIIGrid(r io.Reader) (*Grid, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<24)
+	scanner.Split(bufio.ScanWords)
+
+	header := make(map[string]float64)
+	var first string
+	for scanner.Scan() {
+		key := strings.ToLower(scanner.Text())
+		if _, err := strconv.ParseFloat(key, 64); err == nil {
+			first = key
+			break
+		}
+		if !scanner.Scan() {
+			break
+		}
+		value, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in grid header: %v", key, err)
+		}
+		header[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	grid := &Grid{cols: int(header["ncols"]), rows: int(header["nrows"]), cellSize: header["cellsize"]}
+	if grid.cols <= 0 || grid.rows <= 0 || grid.cellSize <= 0 {
+		return nil, fmt.Errorf("grid header must give positive ncols, nrows and cellsize")
+	}
+	if x, ok := header["xllcenter"]; ok {
+		grid.x0, grid.y0 = x, header["yllcenter"]
+	} else {
+		grid.x0, grid.y0 = header["xllcorner"]+grid.cellSize/2, header["yllcorner"]+grid.cellSize/2
+	}
+	noData, hasNoData := header["nodata_value"]
+
+	grid.heights = make([]float32, 0, grid.cols*grid.rows)
+	parse := func(text string) error {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("invalid height '%s': %v", text, err)
+		}
+		if hasNoData && value == noData {
+			value = math.NaN()
+		}
+		grid.heights = append(grid.heights, float32(value))
+		return nil
+	}
+	if first != "" {
+		if err := parse(first); err != nil {
+			return nil, err
+		}
+	}
+	for scanner.Scan() {
+		if err := parse(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(grid.heights) != grid.cols*grid.rows {
+		return nil, fmt.Errorf("expected %d heights but found %d", grid.cols*grid.rows, len(grid.heights))
+	}
+	return grid, nil
+}
+
+// at returns the height of the cell at a column and row counted from the
+// south-west corner.
+func (g *Grid) at(col, row int) float64 {
+	return float64(g.heights[(g.rows-1-row)*g.cols+col])
+}
+
+// Height interpolates bilinearly between the centres of the four cells
+// around the point, or takes the nearest cell's height at the edges of the
+// grid (and next to missing cells). It reports false if the point is off the
+// grid or has no data.
+func (g *Grid) Height(x, y float64) (float64, bool) {
+	fx, fy := (x-g.x0)/g.cellSize, (y-g.y0)/g.cellSize
+	if fx < -0.5 || fy < -0.5 || fx > float64(g.cols)-0.5 || fy > float64(g.rows)-0.5 {
+		return 0, false
+	}
+
+	col := min(max(int(math.Floor(fx)), 0), g.cols-2)
+	row := min(max(int(math.Floor(fy)), 0), g.rows-2)
+	tx, ty := math.Min(math.Max(fx-float64(col), 0), 1), math.Min(math.Max(fy-float64(row), 0), 1)
+	if g.cols < 2 || g.rows < 2 {
+		col, row, tx, ty = 0, 0, 0, 0
+	}
+
+	h00, h10 := g.at(col, row), g.at(min(col+1, g.cols-1), row)
+	h01, h11 := g.at(col, min(row+1, g.rows-1)), g.at(min(col+1, g.cols-1), min(row+1, g.rows-1))
+	h := (h00*(1-tx)+h10*tx)*(1-ty) + (h01*(1-tx)+h11*tx)*ty
+	if math.IsNaN(h) {
+		nearest := g.at(min(max(int(math.Round(fx)), 0), g.cols-1), min(max(int(math.Round(fy)), 0), g.rows-1))
+		return nearest, !math.IsNaN(nearest)
+	}
+	return h, true
+}
+
+// A digital elevation model made up of grid tiles
+type DEM struct {
+	grids []*Grid
+	index map[[2]int32][]*Grid
+}
+
+// LoadDEM reads an ASCII grid (.asc) or GeoTIFF (.tif) file, or every one in
+// a directory tree.
+func LoadDEM(path string) (*DEM, error) {
+	dem := &DEM{index: make(map[[2]int32][]*Grid)}
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		var read func(io.Reader) (*Grid, error)
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".asc":
+			read = ReadASCIIGrid
+		case ".tif", ".tiff":
+			read = ReadGeoTIFF
+		default:
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("error opening file: %v", err)
+		}
+		defer f.Close()
+
+		grid, err := read(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		dem.add(grid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(dem.grids) == 0 {
+		return nil, fmt.Errorf("no ASCII grid (.asc) or GeoTIFF (.tif) files found in %s", path)
+	}
+	return dem, nil
+}
+
+func (dem *DEM) add(grid *Grid) {
+	dem.grids = append(dem.grids, grid)
+	half := grid.cellSize / 2
+	minX, minY := indexCell(grid.x0-half, grid.y0-half)
+	maxX, maxY := indexCell(grid.x0+float64(grid.cols)*grid.cellSize-half, grid.y0+float64(grid.rows)*grid.cellSize-half)
+	for x := minX; x <= maxX; x++ {
+		for y := minY; y <= maxY; y++ {
+			dem.index[[2]int32{x, y}] = append(dem.index[[2]int32{x, y}], grid)
+		}
+	}
+}
+
+// Grids returns the number of grid tiles loaded.
+func (dem *DEM) Grids() int {
+	return len(dem.grids)
+}
+
+// Height returns the height at a point, from the first grid covering it.
+func (dem *DEM) Height(x, y float64) (float64, bool) {
+	cx, cy := indexCell(x, y)
+	for _, grid := range dem.index[[2]int32{cx, cy}] {
+		if h, ok := grid.Height(x, y); ok {
+			return h, true
+		}
+	}
+	return 0, false
+}
+
+func indexCell(x, y float64) (int32, int32) {
+	return int32(math.Floor(x / DEM_INDEX_CELL_M)), int32(math.Floor(y / DEM_INDEX_CELL_M))
+}
@@ -0,0 +1,133 @@
+package elevation
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestReadASCIIGrid(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		cols     int
+		rows     int
+		x0, y0   float64
+		cellSize float64
+		heights  []float64
+		err      string
+	}{
+		{
+			name: "corner origin",
+			text: "ncols 3\nnrows 2\nxllcorner 400000\nyllcorner 100000\ncellsize 50\n1 2 3\n4 5 6\n",
+			cols: 3, rows: 2, x0: 400025, y0: 100025, cellSize: 50,
+			heights: []float64{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name: "centre origin with nodata",
+			text: "NCOLS 2\nNROWS 2\nXLLCENTER 400025\nYLLCENTER 100025\nCELLSIZE 50\nNODATA_value -9999\n1.5 -9999\n-2.25 4\n",
+			cols: 2, rows: 2, x0: 400025, y0: 100025, cellSize: 50,
+			heights: []float64{1.5, math.NaN(), -2.25, 4},
+		},
+		{
+			name: "heights on one line",
+			text: "ncols 2 nrows 1 xllcorner 0 yllcorner 0 cellsize 10 7 8",
+			cols: 2, rows: 1, x0: 5, y0: 5, cellSize: 10,
+			heights: []float64{7, 8},
+		},
+		{name: "missing size", text: "ncols 2\nxllcorner 0\nyllcorner 0\ncellsize 10\n1 2\n", err: "positive ncols, nrows and cellsize"},
+		{name: "invalid header value", text: "ncols two\nnrows 1\n", err: "invalid ncols in grid header"},
+		{name: "invalid height", text: "ncols 2\nnrows 1\nxllcorner 0\nyllcorner 0\ncellsize 10\n1 x\n", err: "invalid height 'x'"},
+		{name: "too few heights", text: "ncols 2\nnrows 2\nxllcorner 0\nyllcorner 0\ncellsize 10\n1 2 3\n", err: "expected 4 heights but found 3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := ReadASCIIGrid(strings.NewReader(test.text))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if grid.cols != test.cols || grid.rows != test.rows || grid.x0 != test.x0 || grid.y0 != test.y0 || grid.cellSize != test.cellSize {
+				t.Fatalf("got %dx%d grid at %v, %v with %vm cells", grid.cols, grid.rows, grid.x0, grid.y0, grid.cellSize)
+			}
+			for i, expected := range test.heights {
+				if got := float64(grid.heights[i]); got != expected && !(math.IsNaN(got) && math.IsNaN(expected)) {
+					t.Fatalf("height %d is %v, expected %v", i, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestGridHeight(t *testing.T) {
+	// Cell centres at x = 5, 15, 25 and y = 5, 15, 25, with the northernmost
+	// row first and one cell missing
+	grid, err := ReadASCIIGrid(strings.NewReader(`ncols 3
+nrows 3
+xllcorner 0
+yllcorner 0
+cellsize 10
+NODATA_value -9999
+20 30 -9999
+10 20 30
+0 10 20
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		x, y     float64
+		expected float64
+		ok       bool
+	}{
+		{name: "cell centre", x: 15, y: 15, expected: 20, ok: true},
+		{name: "between two centres", x: 10, y: 5, expected: 5, ok: true},
+		{name: "between four centres", x: 10, y: 10, expected: 10, ok: true},
+		{name: "bilinear", x: 7.5, y: 12.5, expected: 10, ok: true},
+		{name: "edge of the grid", x: 0, y: 0, expected: 0, ok: true},
+		{name: "outside the centres", x: 29, y: 5, expected: 20, ok: true},
+		{name: "next to the missing cell", x: 19, y: 23, expected: 30, ok: true},
+		{name: "missing cell", x: 28, y: 28, ok: false},
+		{name: "west of the grid", x: -0.1, y: 15, ok: false},
+		{name: "north of the grid", x: 15, y: 30.1, ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, ok := grid.Height(test.x, test.y)
+			if ok != test.ok || (ok && math.Abs(h-test.expected) > 1e-9) {
+				t.Fatalf("got %v (%v), expected %v (%v)", h, ok, test.expected, test.ok)
+			}
+		})
+	}
+}
+
+func TestDEMHeightUsesCoveringGrid(t *testing.T) {
+	dem := &DEM{index: make(map[[2]int32][]*Grid)}
+	for _, text := range []string{
+		"ncols 2\nnrows 2\nxllcorner 0\nyllcorner 0\ncellsize 50\n1 1\n1 1\n",
+		"ncols 2\nnrows 2\nxllcorner 10000\nyllcorner 0\ncellsize 50\n2 2\n2 2\n",
+	} {
+		grid, err := ReadASCIIGrid(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dem.add(grid)
+	}
+
+	for _, test := range []struct {
+		x, y     float64
+		expected float64
+		ok       bool
+	}{{50, 50, 1, true}, {10050, 50, 2, true}, {5000, 50, 0, false}} {
+		if h, ok := dem.Height(test.x, test.y); h != test.expected || ok != test.ok {
+			t.Errorf("height at %v, %v is %v (%v), expected %v (%v)", test.x, test.y, h, ok, test.expected, test.ok)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package elevation
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TIFF tags read from a GeoTIFF
+const (
+	TIFF_IMAGE_WIDTH       = 256
+	TIFF_IMAGE_LENGTH      = 257
+	TIFF_BITS_PER_SAMPLE   = 258
+	TIFF_COMPRESSION       = 259
+	TIFF_STRIP_OFFSETS     = 273
+	TIFF_SAMPLES_PER_PIXEL = 277
+	TIFF_ROWS_PER_STRIP    = 278
+	TIFF_STRIP_BYTE_COUNTS = 279
+	TIFF_PREDICTOR         = 317
+	TIFF_TILE_WIDTH        = 322
+	TIFF_TILE_LENGTH       = 323
+	TIFF_TILE_OFFSETS      = 324
+	TIFF_TILE_BYTE_COUNTS  = 325
+	TIFF_SAMPLE_FORMAT     = 339
+	TIFF_MODEL_PIXEL_SCALE = 33550
+	TIFF_MODEL_TIEPOINT    = 33922
+	TIFF_GEO_KEY_DIRECTORY = 34735
+	TIFF_GDAL_NODATA       = 42113
+)
+
+// Values of the SampleFormat tag
+const (
+	TIFF_SAMPLE_FORMAT_INT  = 2
+	TIFF_SAMPLE_FORMAT_REAL = 3
+)
+
+// GeoKeys read from the GeoKey directory, and the values checked for
+const (
+	GEO_KEY_RASTER_TYPE   = 1025
+	GEO_KEY_PROJECTED_CRS = 3072
+	RASTER_PIXEL_IS_POINT = 2
+	BRITISH_NATIONAL_GRID = 27700
+)
+
+// Sizes in bytes of the TIFF field types, by type code
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// ReadGeoTIFF reads a single band GeoTIFF in British National Grid
+// coordinates, as OS Terrain 50 is also supplied in. Only uncompressed and
+// Deflate compressed images are supported. Cells holding the GDAL nodata
+// value are stored as NaN.
+func ReadGeoTIFF(r io.Reader) (*Grid, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	if magic := order.Uint16(data[2:]); magic != 42 {
+		return nil, fmt.Errorf("unsupported TIFF variant %d (BigTIFF is not supported)", magic)
+	}
+
+	tags, err := readIFD(data, order, int(order.Uint32(data[4:])))
+	if err != nil {
+		return nil, err
+	}
+	number := func(tag uint16, fallback float64) float64 {
+		if values := tags[tag]; len(values) > 0 {
+			return values[0]
+		}
+		return fallback
+	}
+
+	width, height := int(number(TIFF_IMAGE_WIDTH, 0)), int(number(TIFF_IMAGE_LENGTH, 0))
+	bits, format := int(number(TIFF_BITS_PER_SAMPLE, 1)), int(number(TIFF_SAMPLE_FORMAT, 1))
+	compression, predictor := int(number(TIFF_COMPRESSION, 1)), int(number(TIFF_PREDICTOR, 1))
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("image has no size")
+	}
+	if samples := number(TIFF_SAMPLES_PER_PIXEL, 1); samples != 1 {
+		return nil, fmt.Errorf("expected a single band but found %v", samples)
+	}
+	if bits != 8 && bits != 16 && bits != 32 && bits != 64 {
+		return nil, fmt.Errorf("unsupported sample size of %d bits", bits)
+	}
+	if compression != 1 && compression != 8 && compression != 32946 {
+		return nil, fmt.Errorf("unsupported compression type %d (only none and Deflate are supported)", compression)
+	}
+	if predictor != 1 && predictor != 2 && predictor != 3 {
+		return nil, fmt.Errorf("unsupported predictor %d", predictor)
+	}
+
+	grid, err := geoReference(tags, width, height)
+	if err != nil {
+		return nil, err
+	}
+	noData, hasNoData := math.NaN(), false
+	if text := strings.Trim(strings.TrimSpace(tags.text(TIFF_GDAL_NODATA)), "\x00"); text != "" {
+		if noData, err = strconv.ParseFloat(text, 64); err != nil {
+			return nil, fmt.Errorf("invalid nodata value '%s': %v", text, err)
+		}
+		hasNoData = true
+	}
+
+	// Images are stored in strips of whole rows, or in tiles
+	blockWidth, blockHeight := width, int(number(TIFF_ROWS_PER_STRIP, float64(height)))
+	offsets, counts := tags[TIFF_STRIP_OFFSETS], tags[TIFF_STRIP_BYTE_COUNTS]
+	if tileOffsets, ok := tags[TIFF_TILE_OFFSETS]; ok {
+		blockWidth, blockHeight = int(number(TIFF_TILE_WIDTH, 0)), int(number(TIFF_TILE_LENGTH, 0))
+		offsets, counts = tileOffsets, tags[TIFF_TILE_BYTE_COUNTS]
+	}
+	if blockWidth <= 0 || blockHeight <= 0 {
+		return nil, fmt.Errorf("image has an invalid block size")
+	}
+	blocksAcross := (width + blockWidth - 1) / blockWidth
+	blocksDown := (height + blockHeight - 1) / blockHeight
+	if len(offsets) != blocksAcross*blocksDown || len(counts) != len(offsets) {
+		return nil, fmt.Errorf("expected %d image blocks but found %d", blocksAcross*blocksDown, len(offsets))
+	}
+
+	sampleBytes := bits / 8
+	grid.heights = make([]float32, width*height)
+	for b := range offsets {
+		start, length := int(offsets[b]), int(counts[b])
+		if start < 0 || length < 0 || start+length > len(data) {
+			return nil, fmt.Errorf("image block %d lies outside the file", b)
+		}
+		block := data[start : start+length]
+		if compression != 1 {
+			if block, err = inflate(block); err != nil {
+				return nil, fmt.Errorf("failed to decompress image block %d: %v", b, err)
+			}
+		}
+
+		rowBytes := blockWidth * sampleBytes
+		rows := min(blockHeight, len(block)/rowBytes)
+		for row := range rows {
+			line := block[row*rowBytes : (row+1)*rowBytes]
+			switch predictor {
+			case 2:
+				undoHorizontalDifferencing(line, sampleBytes, order)
+			case 3:
+				line = undoFloatingPointPredictor(line, sampleBytes, order)
+			}
+
+			y := (b/blocksAcross)*blockHeight + row
+			for col := range blockWidth {
+				x := (b%blocksAcross)*blockWidth + col
+				if x >= width || y >= height {
+					continue
+				}
+				value := decodeSample(line[col*sampleBytes:(col+1)*sampleBytes], format, order)
+				if hasNoData && value == noData {
+					value = math.NaN()
+				}
+				grid.heights[y*width+x] = float32(value)
+			}
+		}
+	}
+	return grid, nil
+}
+
+// TIFF tag values, widened to float64 (or bytes, for ASCII tags)
+type tiffTags map[uint16][]float64
+
+func (tags tiffTags) text(tag uint16) string {
+	chars := make([]byte, len(tags[tag]))
+	for i, c := range tags[tag] {
+		chars[i] = byte(c)
+	}
+	return string(chars)
+}
+
+// readIFD reads the tags of the first image file directory.
+func readIFD(data []byte, order binary.ByteOrder, offset int) (tiffTags, error) {
+	if offset < 8 || offset+2 > len(data) {
+		return nil, fmt.Errorf("invalid image directory offset")
+	}
+	entries := int(order.Uint16(data[offset:]))
+	if offset+2+12*entries > len(data) {
+		return nil, fmt.Errorf("image directory is truncated")
+	}
+
+	tags := make(tiffTags, entries)
+	for i := range entries {
+		entry := data[offset+2+12*i:]
+		tag, kind, count := order.Uint16(entry), order.Uint16(entry[2:]), int(order.Uint32(entry[4:]))
+		size, ok := tiffTypeSizes[kind]
+		if !ok {
+			continue
+		}
+
+		values := entry[8:12]
+		if count < 0 || count > 4/size {
+			// Compare counts rather than byte lengths, as size*count can
+			// overflow for a corrupt count
+			start := int(order.Uint32(entry[8:]))
+			if count < 0 || start < 0 || start > len(data) || count > (len(data)-start)/size {
+				return nil, fmt.Errorf("tag %d lies outside the file", tag)
+			}
+			values = data[start : start+size*count]
+		}
+
+		decoded := make([]float64, count)
+		for j := range decoded {
+			value := values[j*size:]
+			switch kind {
+			case 1, 2, 7:
+				decoded[j] = float64(value[0])
+			case 6:
+				decoded[j] = float64(int8(value[0]))
+			case 3:
+				decoded[j] = float64(order.Uint16(value))
+			case 8:
+				decoded[j] = float64(int16(order.Uint16(value)))
+			case 4:
+				decoded[j] = float64(order.Uint32(value))
+			case 9:
+				decoded[j] = float64(int32(order.Uint32(value)))
+			case 5:
+				decoded[j] = float64(order.Uint32(value)) / float64(order.Uint32(value[4:]))
+			case 10:
+				decoded[j] = float64(int32(order.Uint32(value))) / float64(int32(order.Uint32(value[4:])))
+			case 11:
+				decoded[j] = float64(math.Float32frombits(order.Uint32(value)))
+			case 12:
+				decoded[j] = math.Float64frombits(order.Uint64(value))
+			}
+		}
+		tags[tag] = decoded
+	}
+	return tags, nil
+}
+
+// geoReference places the image on the national grid from its tie point and
+// pixel scale.
+func geoReference(tags tiffTags, width, height int) (*Grid, error) {
+	scale, tiePoint := tags[TIFF_MODEL_PIXEL_SCALE], tags[TIFF_MODEL_TIEPOINT]
+	if len(scale) < 2 || len(tiePoint) < 6 {
+		return nil, fmt.Errorf("image is not georeferenced (no tie point and pixel scale)")
+	}
+	if scale[0] <= 0 || math.Abs(scale[0]-scale[1]) > 1e-6*scale[0] {
+		return nil, fmt.Errorf("image cells must be square")
+	}
+
+	// The GeoKey directory is a header of four shorts followed by (key,
+	// location, count, value) entries
+	pixelIsPoint := false
+	keys := tags[TIFF_GEO_KEY_DIRECTORY]
+	for i := 4; i+3 < len(keys); i += 4 {
+		if keys[i+1] != 0 {
+			continue
+		}
+		switch int(keys[i]) {
+		case GEO_KEY_RASTER_TYPE:
+			pixelIsPoint = keys[i+3] == RASTER_PIXEL_IS_POINT
+		case GEO_KEY_PROJECTED_CRS:
+			if crs := int(keys[i+3]); crs != BRITISH_NATIONAL_GRID {
+				return nil, fmt.Errorf("expected British National Grid (EPSG:%d) but image is in EPSG:%d", BRITISH_NATIONAL_GRID, crs)
+			}
+		}
+	}
+
+	cellSize := scale[0]
+	offset := 0.5
+	if pixelIsPoint {
+		offset = 0
+	}
+	// Centre of the north-west cell
+	x, y := tiePoint[3]+(offset-tiePoint[0])*cellSize, tiePoint[4]-(offset-tiePoint[1])*cellSize
+	return &Grid{cols: width, rows: height, x0: x, y0: y - float64(height-1)*cellSize, cellSize: cellSize}, nil
+}
+
+func inflate(block []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(block))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// undoHorizontalDifferencing reverses TIFF predictor 2, where each integer
+// sample is stored as the difference from the one before it in the row.
+func undoHorizontalDifferencing(line []byte, sampleBytes int, order binary.ByteOrder) {
+	for i := sampleBytes; i+sampleBytes <= len(line); i += sampleBytes {
+		previous, current := line[i-sampleBytes:i], line[i:i+sampleBytes]
+		switch sampleBytes {
+		case 1:
+			current[0] += previous[0]
+		case 2:
+			order.PutUint16(current, order.Uint16(current)+order.Uint16(previous))
+		case 4:
+			order.PutUint32(current, order.Uint32(current)+order.Uint32(previous))
+		case 8:
+			order.PutUint64(current, order.Uint64(current)+order.Uint64(previous))
+		}
+	}
+}
+
+// undoFloatingPointPredictor reverses TIFF predictor 3, where the bytes of
+// each row are differenced and grouped by significance (most significant
+// first) across the row's samples.
+func undoFloatingPointPredictor(line []byte, sampleBytes int, order binary.ByteOrder) []byte {
+	for i := 1; i < len(line); i++ {
+		line[i] += line[i-1]
+	}
+	samples := len(line) / sampleBytes
+	decoded := make([]byte, len(line))
+	for i := range samples {
+		for k := range sampleBytes {
+			// Byte k of the big-endian representation
+			position := k
+			if order == binary.LittleEndian {
+				position = sampleBytes - 1 - k
+			}
+			decoded[i*sampleBytes+position] = line[k*samples+i]
+		}
+	}
+	return decoded
+}
+
+func decodeSample(value []byte, format int, order binary.ByteOrder) float64 {
+	switch len(value) {
+	case 1:
+		if format == TIFF_SAMPLE_FORMAT_INT {
+			return float64(int8(value[0]))
+		}
+		return float64(value[0])
+	case 2:
+		if format == TIFF_SAMPLE_FORMAT_INT {
+			return float64(int16(order.Uint16(value)))
+		}
+		return float64(order.Uint16(value))
+	case 4:
+		switch format {
+		case TIFF_SAMPLE_FORMAT_REAL:
+			return float64(math.Float32frombits(order.Uint32(value)))
+		case TIFF_SAMPLE_FORMAT_INT:
+			return float64(int32(order.Uint32(value)))
+		}
+		return float64(order.Uint32(value))
+	default:
+		switch format {
+		case TIFF_SAMPLE_FORMAT_REAL:
+			return math.Float64frombits(order.Uint64(value))
+		case TIFF_SAMPLE_FORMAT_INT:
+			return float64(int64(order.Uint64(value)))
+		}
+		return float64(order.Uint64(value))
+	}
+}
@@ -0,0 +1,299 @@
+package elevation
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Size of the test image, chosen so that neither strips nor tiles divide it
+// evenly
+const (
+	testTIFFWidth  = 20
+	testTIFFHeight = 18
+)
+
+// Sample of the test image at a column and row (from the top), with one
+// cell holding the nodata value
+func testTIFFSample(col, row int) float32 {
+	if col == 3 && row == 4 {
+		return -9999
+	}
+	return float32(row*100+col) + 0.25
+}
+
+type tiffEntry struct {
+	tag, kind uint16
+	count     int
+	data      []byte
+}
+
+// tiffOptions describes how the test image is laid out
+type tiffOptions struct {
+	order binary.ByteOrder
+	// Tile size, or zero for strips of rowsPerStrip rows
+	tileSize     int
+	rowsPerStrip int
+	deflate      bool
+	predictor    uint16
+}
+
+// encodeRow lays out a row of float32 samples, applying the floating point
+// predictor if asked.
+func encodeRow(samples []float32, opts tiffOptions) []byte {
+	row := make([]byte, 4*len(samples))
+	if opts.predictor != 3 {
+		for i, sample := range samples {
+			opts.order.PutUint32(row[4*i:], math.Float32bits(sample))
+		}
+		return row
+	}
+
+	// Bytes grouped by significance, most significant first, then
+	// differenced along the row
+	for i, sample := range samples {
+		bits := math.Float32bits(sample)
+		for k := range 4 {
+			row[k*len(samples)+i] = byte(bits >> (8 * (3 - k)))
+		}
+	}
+	for i := len(row) - 1; i > 0; i-- {
+		row[i] -= row[i-1]
+	}
+	return row
+}
+
+// writeGeoTIFF writes the test image as a single band float32 GeoTIFF on
+// the national grid, with 50m cells and its north-west corner at 400000,
+// 100900.
+func writeGeoTIFF(t *testing.T, opts tiffOptions) []byte {
+	t.Helper()
+	blockWidth, blockHeight := testTIFFWidth, opts.rowsPerStrip
+	if opts.tileSize > 0 {
+		blockWidth, blockHeight = opts.tileSize, opts.tileSize
+	}
+
+	// The blocks follow the header, and the image directory follows them
+	var out bytes.Buffer
+	out.Write(make([]byte, 8))
+	offsets, counts := make([]uint32, 0), make([]uint32, 0)
+	for top := 0; top < testTIFFHeight; top += blockHeight {
+		for left := 0; left < testTIFFWidth; left += blockWidth {
+			var block []byte
+			for row := top; row < top+blockHeight; row++ {
+				if opts.tileSize == 0 && row >= testTIFFHeight {
+					break
+				}
+				samples := make([]float32, blockWidth)
+				for i := range samples {
+					if col := left + i; col < testTIFFWidth && row < testTIFFHeight {
+						samples[i] = testTIFFSample(col, row)
+					}
+				}
+				block = append(block, encodeRow(samples, opts)...)
+			}
+			if opts.deflate {
+				var compressed bytes.Buffer
+				w := zlib.NewWriter(&compressed)
+				if _, err := w.Write(block); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				block = compressed.Bytes()
+			}
+			offsets = append(offsets, uint32(out.Len()))
+			counts = append(counts, uint32(len(block)))
+			out.Write(block)
+		}
+	}
+
+	shorts := func(tag uint16, values ...uint16) tiffEntry {
+		data := make([]byte, 2*len(values))
+		for i, value := range values {
+			opts.order.PutUint16(data[2*i:], value)
+		}
+		return tiffEntry{tag: tag, kind: 3, count: len(values), data: data}
+	}
+	longs := func(tag uint16, values ...uint32) tiffEntry {
+		data := make([]byte, 4*len(values))
+		for i, value := range values {
+			opts.order.PutUint32(data[4*i:], value)
+		}
+		return tiffEntry{tag: tag, kind: 4, count: len(values), data: data}
+	}
+	doubles := func(tag uint16, values ...float64) tiffEntry {
+		data := make([]byte, 8*len(values))
+		for i, value := range values {
+			opts.order.PutUint64(data[8*i:], math.Float64bits(value))
+		}
+		return tiffEntry{tag: tag, kind: 12, count: len(values), data: data}
+	}
+
+	compression := uint16(1)
+	if opts.deflate {
+		compression = 8
+	}
+	entries := []tiffEntry{
+		longs(TIFF_IMAGE_WIDTH, testTIFFWidth),
+		longs(TIFF_IMAGE_LENGTH, testTIFFHeight),
+		shorts(TIFF_BITS_PER_SAMPLE, 32),
+		shorts(TIFF_COMPRESSION, compression),
+		shorts(TIFF_SAMPLES_PER_PIXEL, 1),
+		shorts(TIFF_PREDICTOR, max(opts.predictor, 1)),
+		shorts(TIFF_SAMPLE_FORMAT, TIFF_SAMPLE_FORMAT_REAL),
+		doubles(TIFF_MODEL_PIXEL_SCALE, 50, 50, 0),
+		doubles(TIFF_MODEL_TIEPOINT, 0, 0, 0, 400000, 100900, 0),
+		shorts(TIFF_GEO_KEY_DIRECTORY, 1, 1, 0, 2, GEO_KEY_RASTER_TYPE, 0, 1, 1, GEO_KEY_PROJECTED_CRS, 0, 1, BRITISH_NATIONAL_GRID),
+		{tag: TIFF_GDAL_NODATA, kind: 2, count: 6, data: []byte("-9999\x00")},
+	}
+	if opts.tileSize > 0 {
+		entries = append(entries,
+			shorts(TIFF_TILE_WIDTH, uint16(opts.tileSize)),
+			shorts(TIFF_TILE_LENGTH, uint16(opts.tileSize)),
+			longs(TIFF_TILE_OFFSETS, offsets...),
+			longs(TIFF_TILE_BYTE_COUNTS, counts...))
+	} else {
+		entries = append(entries,
+			longs(TIFF_STRIP_OFFSETS, offsets...),
+			shorts(TIFF_ROWS_PER_STRIP, uint16(opts.rowsPerStrip)),
+			longs(TIFF_STRIP_BYTE_COUNTS, counts...))
+	}
+	slices.SortFunc(entries, func(a, b tiffEntry) int { return int(a.tag) - int(b.tag) })
+
+	// Values of more than four bytes follow the directory
+	directory := out.Len()
+	external := directory + 2 + 12*len(entries) + 4
+	var values bytes.Buffer
+	binary.Write(&out, opts.order, uint16(len(entries)))
+	for _, entry := range entries {
+		field := make([]byte, 12)
+		opts.order.PutUint16(field, entry.tag)
+		opts.order.PutUint16(field[2:], entry.kind)
+		opts.order.PutUint32(field[4:], uint32(entry.count))
+		if len(entry.data) <= 4 {
+			copy(field[8:], entry.data)
+		} else {
+			opts.order.PutUint32(field[8:], uint32(external+values.Len()))
+			values.Write(entry.data)
+		}
+		out.Write(field)
+	}
+	out.Write(make([]byte, 4))
+	out.Write(values.Bytes())
+
+	data := out.Bytes()
+	if opts.order == binary.LittleEndian {
+		copy(data, "II")
+	} else {
+		copy(data, "MM")
+	}
+	opts.order.PutUint16(data[2:], 42)
+	opts.order.PutUint32(data[4:], uint32(directory))
+	return data
+}
+
+func TestReadGeoTIFF(t *testing.T) {
+	tests := []struct {
+		name string
+		opts tiffOptions
+	}{
+		{name: "stripped", opts: tiffOptions{order: binary.LittleEndian, rowsPerStrip: 4}},
+		{name: "stripped deflate", opts: tiffOptions{order: binary.LittleEndian, rowsPerStrip: 4, deflate: true}},
+		{name: "stripped float predictor", opts: tiffOptions{order: binary.LittleEndian, rowsPerStrip: 5, deflate: true, predictor: 3}},
+		{name: "tiled", opts: tiffOptions{order: binary.LittleEndian, tileSize: 16}},
+		{name: "tiled float predictor", opts: tiffOptions{order: binary.LittleEndian, tileSize: 16, deflate: true, predictor: 3}},
+		{name: "big-endian tiled float predictor", opts: tiffOptions{order: binary.BigEndian, tileSize: 16, deflate: true, predictor: 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := ReadGeoTIFF(bytes.NewReader(writeGeoTIFF(t, test.opts)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if grid.cols != testTIFFWidth || grid.rows != testTIFFHeight || grid.cellSize != 50 {
+				t.Fatalf("got a %dx%d grid of %vm cells", grid.cols, grid.rows, grid.cellSize)
+			}
+			// Centre of the south-west cell
+			if grid.x0 != 400025 || grid.y0 != 100900-50*testTIFFHeight+25 {
+				t.Fatalf("grid starts at %v, %v", grid.x0, grid.y0)
+			}
+
+			for row := range testTIFFHeight {
+				for col := range testTIFFWidth {
+					got, expected := grid.heights[row*testTIFFWidth+col], testTIFFSample(col, row)
+					if expected == -9999 {
+						if !math.IsNaN(float64(got)) {
+							t.Fatalf("nodata cell at %d, %d read as %v", col, row, got)
+						}
+						continue
+					}
+					if got != expected {
+						t.Fatalf("cell at %d, %d read as %v, expected %v", col, row, got, expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadGeoTIFFRejectsBadFiles(t *testing.T) {
+	valid := writeGeoTIFF(t, tiffOptions{order: binary.LittleEndian, rowsPerStrip: 4})
+	directory := int(binary.LittleEndian.Uint32(valid[4:]))
+	entries := int(binary.LittleEndian.Uint16(valid[directory:]))
+
+	// field returns the directory entry for a tag
+	field := func(data []byte, tag uint16) []byte {
+		for i := range entries {
+			entry := data[directory+2+12*i:]
+			if binary.LittleEndian.Uint16(entry) == tag {
+				return entry[:12]
+			}
+		}
+		t.Fatalf("no tag %d", tag)
+		return nil
+	}
+
+	tests := []struct {
+		name   string
+		modify func(data []byte) []byte
+		err    string
+	}{
+		{name: "not a TIFF", modify: func(data []byte) []byte { return []byte("GIF89a\x00\x00") }, err: "not a TIFF file"},
+		{name: "BigTIFF", modify: func(data []byte) []byte {
+			binary.LittleEndian.PutUint16(data[2:], 43)
+			return data
+		}, err: "BigTIFF is not supported"},
+		{name: "truncated directory", modify: func(data []byte) []byte { return data[:directory+20] }, err: "image directory is truncated"},
+		{name: "tag past the end", modify: func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(field(data, TIFF_MODEL_TIEPOINT)[8:], uint32(len(data)-8))
+			return data
+		}, err: "lies outside the file"},
+		{name: "block past the end", modify: func(data []byte) []byte {
+			counts := binary.LittleEndian.Uint32(field(data, TIFF_STRIP_BYTE_COUNTS)[8:])
+			binary.LittleEndian.PutUint32(data[counts:], 1<<30)
+			return data
+		}, err: "image block 0 lies outside the file"},
+		{name: "huge tag count", modify: func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(field(data, TIFF_MODEL_TIEPOINT)[4:], math.MaxUint32)
+			return data
+		}, err: "lies outside the file"},
+		{name: "unsupported compression", modify: func(data []byte) []byte {
+			binary.LittleEndian.PutUint16(field(data, TIFF_COMPRESSION)[8:], 5)
+			return data
+		}, err: "unsupported compression type 5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadGeoTIFF(bytes.NewReader(test.modify(bytes.Clone(valid))))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package elevation
+
+import (
+	"math"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Spacing (in metres) of the heights sampled along each link to measure its
+// climb, half the resolution of OS Terrain 50
+const SAMPLE_SPACING_M = 25.0
+
+// Minimum distance (in metres) that gradients are measured over, so that
+// they are not dominated by the noise in the model over short runs
+const GRADIENT_RUN_M = 50.0
+
+// LinkElevation samples the model along a centre line, given in British
+// National Grid coordinates. It reports false if any part of the line is not
+// covered by the model.
+func (dem *DEM) LinkElevation(linkID int64, line models.LineString) (*models.LinkElevation, bool) {
+	result := &models.LinkElevation{LinkID: linkID, Elevations: make([]float32, len(line))}
+	for i, pos := range line {
+		h, ok := dem.Height(pos[0], pos[1])
+		if !ok {
+			return nil, false
+		}
+		result.Elevations[i] = float32(h)
+	}
+	if len(line) < 2 {
+		return result, true
+	}
+
+	// Heights at every vertex and every SAMPLE_SPACING_M in between, with the
+	// distance along the line of each
+	distances := []float64{0}
+	heights := []float64{float64(result.Elevations[0])}
+	travelled := 0.0
+	for i := 1; i < len(line); i++ {
+		from, to := line[i-1], line[i]
+		length := math.Hypot(to[0]-from[0], to[1]-from[1])
+		for along := SAMPLE_SPACING_M; along < length; along += SAMPLE_SPACING_M {
+			t := along / length
+			h, ok := dem.Height(from[0]+t*(to[0]-from[0]), from[1]+t*(to[1]-from[1]))
+			if !ok {
+				return nil, false
+			}
+			distances = append(distances, travelled+along)
+			heights = append(heights, h)
+		}
+		travelled += length
+		distances = append(distances, travelled)
+		heights = append(heights, float64(result.Elevations[i]))
+	}
+
+	for i := 1; i < len(heights); i++ {
+		if rise := heights[i] - heights[i-1]; rise > 0 {
+			result.AscentM += rise
+		} else {
+			result.DescentM -= rise
+		}
+	}
+
+	// Steepest gradient between each sample and the first one at least
+	// GRADIENT_RUN_M further on, or over the whole line if it is shorter
+	j := 0
+	for i := range heights {
+		for j < len(distances) && distances[j]-distances[i] < GRADIENT_RUN_M {
+			j++
+		}
+		if j == len(distances) {
+			break
+		}
+		result.MaxGradient = math.Max(result.MaxGradient, math.Abs(heights[j]-heights[i])/(distances[j]-distances[i]))
+	}
+	if travelled > 0 && travelled < GRADIENT_RUN_M {
+		result.MaxGradient = math.Abs(heights[len(heights)-1]-heights[0]) / travelled
+	}
+	return result, true
+}
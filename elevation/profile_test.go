@@ -0,0 +1,82 @@
+package elevation
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// slopeDEM is a 20 x 20 grid of 50m cells whose height rises by a tenth of
+// a metre for every metre east, up to x = 500, then falls again at the same
+// rate.
+func slopeDEM(t *testing.T) *DEM {
+	t.Helper()
+	var text strings.Builder
+	text.WriteString("ncols 20\nnrows 20\nxllcorner 0\nyllcorner 0\ncellsize 50\n")
+	for range 20 {
+		for col := range 20 {
+			x := 25 + 50*float64(col)
+			fmt.Fprintf(&text, "%g ", 0.1*(500-math.Abs(500-x)))
+		}
+		text.WriteString("\n")
+	}
+
+	grid, err := ReadASCIIGrid(strings.NewReader(text.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dem := &DEM{index: make(map[[2]int32][]*Grid)}
+	dem.add(grid)
+	return dem
+}
+
+func TestLinkElevation(t *testing.T) {
+	dem := slopeDEM(t)
+	tests := []struct {
+		name        string
+		line        models.LineString
+		elevations  []float32
+		ascent      float64
+		descent     float64
+		maxGradient float64
+	}{
+		{name: "uphill", line: models.LineString{{100, 100}, {300, 100}}, elevations: []float32{10, 30}, ascent: 20, maxGradient: 0.1},
+		{name: "downhill", line: models.LineString{{300, 100}, {100, 100}}, elevations: []float32{30, 10}, descent: 20, maxGradient: 0.1},
+		{name: "across the slope", line: models.LineString{{200, 100}, {200, 700}}, elevations: []float32{20, 20}},
+		// Interpolation levels the ridge off between the cell centres either
+		// side of it
+		{name: "over the ridge", line: models.LineString{{400, 100}, {500, 100}, {600, 100}}, elevations: []float32{40, 47.5, 40}, ascent: 7.5, descent: 7.5, maxGradient: 0.1},
+		{name: "diagonal", line: models.LineString{{100, 100}, {400, 500}}, elevations: []float32{10, 40}, ascent: 30, maxGradient: 0.06},
+		{name: "shorter than a gradient run", line: models.LineString{{100, 100}, {130, 100}}, elevations: []float32{10, 13}, ascent: 3, maxGradient: 0.1},
+		{name: "single point", line: models.LineString{{100, 100}}, elevations: []float32{10}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, ok := dem.LinkElevation(42, test.line)
+			if !ok {
+				t.Fatal("expected the line to be covered")
+			}
+			if result.LinkID != 42 {
+				t.Fatalf("got link %d", result.LinkID)
+			}
+			for i, expected := range test.elevations {
+				if math.Abs(float64(result.Elevations[i]-expected)) > 1e-4 {
+					t.Fatalf("got elevations %v, expected %v", result.Elevations, test.elevations)
+				}
+			}
+			if math.Abs(result.AscentM-test.ascent) > 1e-6 || math.Abs(result.DescentM-test.descent) > 1e-6 {
+				t.Fatalf("got ascent %v and descent %v, expected %v and %v", result.AscentM, result.DescentM, test.ascent, test.descent)
+			}
+			if math.Abs(result.MaxGradient-test.maxGradient) > 1e-6 {
+				t.Fatalf("got max gradient %v, expected %v", result.MaxGradient, test.maxGradient)
+			}
+		})
+	}
+
+	if _, ok := dem.LinkElevation(42, models.LineString{{900, 100}, {1100, 100}}); ok {
+		t.Fatal("expected a line running off the model not to be covered")
+	}
+}
@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"github.com/rm-hull/route-planner/models"
+)
+
+// linkByGmlID finds a link by its gml_id.
+func (g *Graph) linkByGmlID(id string) (uint32, bool) {
+	g.linkGmlOnce.Do(func() {
+		g.linkGmlIndex = make(map[string]uint32, len(g.linkGmlIDs))
+		for l, gmlID := range g.linkGmlIDs {
+			g.linkGmlIndex[gmlID] = uint32(l)
+		}
+	})
+	l, ok := g.linkGmlIndex[id]
+	return l, ok
+}
+
+// avoidedLinks resolves the links a search must not use: those listed by
+// gml_id (unknown ids are ignored) and those whose centre line intersects
+// any of the avoid areas, found via the link grid.
+func (g *Graph) avoidedLinks(avoid *models.Avoid) map[uint32]bool {
+	avoided := make(map[uint32]bool, len(avoid.Links))
+	for _, id := range avoid.Links {
+		if l, ok := g.linkByGmlID(id); ok {
+			avoided[l] = true
+		}
+	}
+
+	for _, polygon := range avoid.Areas {
+		minLon, minLat, maxLon, maxLat := polygon.Bounds()
+		x0, y0 := cellOf(minLat, minLon)
+		x1, y1 := cellOf(maxLat, maxLon)
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				for _, l := range g.linkGrid.cell(x, y) {
+					if !avoided[l] && g.intersects(l, polygon) {
+						avoided[l] = true
+					}
+				}
+			}
+		}
+	}
+	return avoided
+}
+
+// intersects reports whether any segment of link l's centre line touches
+// the polygon.
+func (g *Graph) intersects(l uint32, polygon models.Polygon) bool {
+	coords := g.shapeCoords[2*g.shapeStart[l] : 2*g.shapeStart[l+1]]
+	position := func(i int) [2]float64 {
+		return [2]float64{float64(coords[2*i]), float64(coords[2*i+1])}
+	}
+	for i := 1; i < len(coords)/2; i++ {
+		if polygon.IntersectsSegment(position(i-1), position(i)) {
+			return true
+		}
+	}
+	return false
+}
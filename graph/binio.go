@@ -0,0 +1,154 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+)
+
+// Upper bound on the length of any slice read back from input of unknown
+// size, so that corrupt input fails cleanly rather than attempting an absurd
+// allocation. Slices read from files are also limited to the bytes left.
+const MAX_SLICE_LENGTH = 1 << 28
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// binaryWriter writes little-endian values and slices, keeping a CRC-32 of
+// everything written. The first error is latched and returned by finish, so
+// callers need not check every write.
+type binaryWriter struct {
+	buf *bufio.Writer
+	w   io.Writer
+	crc hash.Hash32
+	err error
+}
+
+func newBinaryWriter(w io.Writer) *binaryWriter {
+	buf := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	return &binaryWriter{buf: buf, w: io.MultiWriter(buf, crc), crc: crc}
+}
+
+func (bw *binaryWriter) write(data any) {
+	if bw.err == nil {
+		bw.err = binary.Write(bw.w, binary.LittleEndian, data)
+	}
+}
+
+// slice writes the length of a slice followed by its elements.
+func (bw *binaryWriter) slice(data any, length int) {
+	bw.write(uint64(length))
+	bw.write(data)
+}
+
+func (bw *binaryWriter) string(s string) {
+	bw.slice([]byte(s), len(s))
+}
+
+// finish appends the checksum and flushes the output.
+func (bw *binaryWriter) finish() error {
+	if bw.err != nil {
+		return bw.err
+	}
+	if err := binary.Write(bw.buf, binary.LittleEndian, bw.crc.Sum32()); err != nil {
+		return err
+	}
+	return bw.buf.Flush()
+}
+
+// binaryReader is the counterpart of binaryWriter.
+type binaryReader struct {
+	buf *bufio.Reader
+	r   io.Reader
+	crc hash.Hash32
+	err error
+	// Bytes left to read, or -1 if the size of the input is unknown
+	remaining int64
+}
+
+func newBinaryReader(r io.Reader) *binaryReader {
+	buf := bufio.NewReader(r)
+	crc := crc32.NewIEEE()
+	return &binaryReader{buf: buf, r: io.TeeReader(buf, crc), crc: crc, remaining: inputSize(r)}
+}
+
+// inputSize returns the number of bytes left in a regular file, or -1 for
+// any other reader.
+func inputSize(r io.Reader) int64 {
+	file, ok := r.(interface {
+		io.Seeker
+		Stat() (fs.FileInfo, error)
+	})
+	if !ok {
+		return -1
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return -1
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	return info.Size() - offset
+}
+
+func (br *binaryReader) read(data any) {
+	if br.err == nil {
+		br.err = binary.Read(br.r, binary.LittleEndian, data)
+	}
+	if br.err == nil && br.remaining >= 0 {
+		br.remaining -= int64(binary.Size(data))
+	}
+}
+
+// length reads a slice length, checking that that many elements of the
+// given size could fit in what is left of the input.
+func (br *binaryReader) length(elementSize int) int {
+	var length uint64
+	br.read(&length)
+	if br.err == nil && length > MAX_SLICE_LENGTH && br.remaining < 0 {
+		br.err = fmt.Errorf("implausible length %d", length)
+	}
+	if br.err == nil && br.remaining >= 0 && length > uint64(br.remaining)/uint64(max(elementSize, 1)) {
+		br.err = fmt.Errorf("length %d exceeds the %d bytes left", length, br.remaining)
+	}
+	if br.err != nil {
+		return 0
+	}
+	return int(length)
+}
+
+// readSlice reads a slice written by binaryWriter.slice.
+func readSlice[T any](br *binaryReader) []T {
+	var element T
+	data := make([]T, br.length(binary.Size(element)))
+	br.read(data)
+	return data
+}
+
+func (br *binaryReader) string() string {
+	return string(readSlice[byte](br))
+}
+
+// finish reads the trailing checksum and compares it against the data read.
+func (br *binaryReader) finish() error {
+	if br.err != nil {
+		return br.err
+	}
+
+	expected := br.crc.Sum32()
+	var checksum uint32
+	if err := binary.Read(br.buf, binary.LittleEndian, &checksum); err != nil {
+		return err
+	}
+	if checksum != expected {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
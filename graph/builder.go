@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Builder accumulates nodes and then links, and assembles them into a Graph.
+// All nodes must be added before any link that refers to them.
+type Builder struct {
+	g         *Graph
+	nameIndex map[string]uint32
+}
+
+func NewBuilder(refData *models.NetworkRefData) *Builder {
+	return &Builder{
+		g: &Graph{
+			refData:    *refData,
+			names:      []string{""},
+			nodeIndex:  make(map[int64]uint32),
+			linkIndex:  make(map[int64]uint32),
+			shapeStart: []uint32{0},
+		},
+		nameIndex: map[string]uint32{"": 0},
+	}
+}
+
+func (b *Builder) AddNode(node models.NetworkNode) error {
+	g := b.g
+	if _, exists := g.nodeIndex[node.ID]; exists {
+		return fmt.Errorf("duplicate road node %s", node.GmlID)
+	}
+
+	g.nodeIndex[node.ID] = uint32(len(g.nodeIDs))
+	g.nodeIDs = append(g.nodeIDs, node.ID)
+	g.nodeGmlIDs = append(g.nodeGmlIDs, node.GmlID)
+	g.nodeLats = append(g.nodeLats, node.Location.Lat)
+	g.nodeLons = append(g.nodeLons, node.Location.Lon)
+	return nil
+}
+
+func (b *Builder) AddLink(link models.NetworkLink) error {
+	g := b.g
+	source, ok := g.nodeIndex[link.SourceID]
+	if !ok {
+		return fmt.Errorf("road link %s refers to unknown source node", link.GmlID)
+	}
+	target, ok := g.nodeIndex[link.TargetID]
+	if !ok {
+		return fmt.Errorf("road link %s refers to unknown target node", link.GmlID)
+	}
+	if _, exists := g.linkIndex[link.ID]; exists {
+		return fmt.Errorf("duplicate road link %s", link.GmlID)
+	}
+
+	var flags uint8
+	if link.PrimaryRoute {
+		flags |= FLAG_PRIMARY_ROUTE
+	}
+	if link.TrunkRoad {
+		flags |= FLAG_TRUNK_ROAD
+	}
+
+	g.linkIndex[link.ID] = uint32(len(g.linkIDs))
+	g.linkIDs = append(g.linkIDs, link.ID)
+	g.linkGmlIDs = append(g.linkGmlIDs, link.GmlID)
+	g.linkSource = append(g.linkSource, source)
+	g.linkTarget = append(g.linkTarget, target)
+	g.lengthM = append(g.lengthM, float32(link.LengthM))
+	g.durationS = append(g.durationS, float32(link.DurationS))
+	g.roadClassification = append(g.roadClassification, uint16(link.RoadClassificationID))
+	g.roadFunction = append(g.roadFunction, uint16(link.RoadFunctionID))
+	g.formOfWay = append(g.formOfWay, uint16(link.FormOfWayID))
+	g.flags = append(g.flags, flags)
+	g.name1 = append(g.name1, b.intern(link.Name1))
+	g.roadNumber = append(g.roadNumber, b.intern(link.RoadClassificationNumber))
+	g.ascentM = append(g.ascentM, float32(link.AscentM))
+	g.descentM = append(g.descentM, float32(link.DescentM))
+	g.maxGradient = append(g.maxGradient, float32(link.MaxGradient))
+
+	hasElevations := len(link.Elevations) == len(link.CenterLine)
+	for i, pos := range link.CenterLine {
+		g.shapeCoords = append(g.shapeCoords, float32(pos[0]), float32(pos[1]))
+		if hasElevations {
+			g.shapeElevations = append(g.shapeElevations, link.Elevations[i])
+		} else {
+			g.shapeElevations = append(g.shapeElevations, float32(math.NaN()))
+		}
+	}
+	g.shapeStart = append(g.shapeStart, uint32(len(g.shapeCoords)/2))
+	return nil
+}
+
+func (b *Builder) intern(text *string) uint32 {
+	if text == nil {
+		return 0
+	}
+	if index, ok := b.nameIndex[*text]; ok {
+		return index
+	}
+	index := uint32(len(b.g.names))
+	b.g.names = append(b.g.names, *text)
+	b.nameIndex[*text] = index
+	return index
+}
+
+// Build assembles the adjacency arrays and spatial indexes. The builder
+// must not be used afterwards.
+func (b *Builder) Build() *Graph {
+	g := b.g
+	g.index()
+	b.g = nil
+	return g
+}
+
+// index derives everything that is not stored in a snapshot from the node
+// and link arrays.
+func (g *Graph) index() {
+	if g.nodeIndex == nil {
+		g.nodeIndex = make(map[int64]uint32, len(g.nodeIDs))
+		for n, id := range g.nodeIDs {
+			g.nodeIndex[id] = uint32(n)
+		}
+	}
+	if g.linkIndex == nil {
+		g.linkIndex = make(map[int64]uint32, len(g.linkIDs))
+		for l, id := range g.linkIDs {
+			g.linkIndex[id] = uint32(l)
+		}
+	}
+
+	g.buildAdjacency()
+	g.nodeGrid = newNodeGrid(g.nodeLats, g.nodeLons)
+	g.linkGrid = newLinkGrid(g)
+	g.weights = make(map[string][]float32)
+	g.hierarchies = make(map[string]*Hierarchy)
+}
+
+// buildAdjacency lays out the CSR arrays with a counting sort on the node
+// at each end of every link.
+func (g *Graph) buildAdjacency() {
+	nodes := len(g.nodeIDs)
+	g.firstAdj = make([]uint32, nodes+1)
+	for l := range g.linkIDs {
+		g.firstAdj[g.linkSource[l]+1]++
+		g.firstAdj[g.linkTarget[l]+1]++
+	}
+	for n := 0; n < nodes; n++ {
+		g.firstAdj[n+1] += g.firstAdj[n]
+	}
+
+	next := make([]uint32, nodes)
+	copy(next, g.firstAdj[:nodes])
+	g.adjNode = make([]uint32, g.firstAdj[nodes])
+	g.adjLink = make([]uint32, g.firstAdj[nodes])
+	for l := range g.linkIDs {
+		source, target := g.linkSource[l], g.linkTarget[l]
+
+		g.adjNode[next[source]] = target
+		g.adjLink[next[source]] = uint32(l)
+		next[source]++
+
+		g.adjNode[next[target]] = source
+		g.adjLink[next[target]] = uint32(l)
+		next[target]++
+	}
+}
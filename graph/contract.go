@@ -0,0 +1,260 @@
+package graph
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Limits on the nodes a witness search settles, and the number of links it
+// follows from the source, before giving up: when contracting a node, and
+// when just estimating its priority. Giving up early only costs a (possibly
+// unnecessary) shortcut, never correctness.
+const WITNESS_SETTLE_LIMIT = 500
+const WITNESS_HOP_LIMIT = 8
+const PRIORITY_SETTLE_LIMIT = 50
+const PRIORITY_HOP_LIMIT = 3
+
+type witnessLimits struct {
+	settled int
+	hops    int32
+}
+
+var contractLimits = witnessLimits{settled: WITNESS_SETTLE_LIMIT, hops: WITNESS_HOP_LIMIT}
+var priorityLimits = witnessLimits{settled: PRIORITY_SETTLE_LIMIT, hops: PRIORITY_HOP_LIMIT}
+
+// How often progress is logged while contracting, in nodes
+const CONTRACT_LOG_INTERVAL = 250_000
+
+type arc struct {
+	node   uint32
+	weight float32
+	edge   uint32
+}
+
+// contraction holds the working state while a hierarchy is being built: the
+// remaining (uncontracted) graph, the edges created so far, and a scratch
+// search state for witness searches.
+type contraction struct {
+	g          *Graph
+	h          *Hierarchy
+	adj        [][]arc
+	contracted []bool
+	deleted    []int32
+	level      []int32
+	priority   []int32
+	up         [][]arc
+	witness    *searchState
+	// Marks the nodes a witness search is looking for
+	targets   []uint32
+	targetGen uint32
+}
+
+// Contract builds a contraction hierarchy over the graph for the profile.
+// Nodes are contracted in order of edge difference (the shortcuts needed
+// less the links removed) plus the number of already contracted neighbours,
+// with priorities updated lazily.
+func (g *Graph) Contract(profile *models.Profile) (*Hierarchy, error) {
+	weights, err := g.weightsFor(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	nodes := len(g.nodeIDs)
+	c := &contraction{
+		g: g,
+		h: &Hierarchy{
+			Profile:      profile.Name,
+			Metric:       profile.Metric,
+			fingerprint:  g.fingerprint(weights),
+			linkCount:    uint32(len(g.linkIDs)),
+			rank:         make([]uint32, nodes),
+			edgeLength:   append([]float32{}, g.lengthM...),
+			edgeDuration: make([]float32, len(g.linkIDs)),
+		},
+		adj:        make([][]arc, nodes),
+		contracted: make([]bool, nodes),
+		deleted:    make([]int32, nodes),
+		level:      make([]int32, nodes),
+		priority:   make([]int32, nodes),
+		up:         make([][]arc, nodes),
+		targets:    make([]uint32, nodes),
+		witness: &searchState{
+			dist:       make([]float64, nodes),
+			parentLink: make([]int32, nodes),
+			stamp:      make([]uint32, nodes),
+			gen:        1,
+		},
+	}
+
+	for l := range c.h.edgeDuration {
+		c.h.edgeDuration[l] = float32(g.duration(uint32(l)))
+	}
+
+	for l, weight := range weights {
+		source, target := g.linkSource[l], g.linkTarget[l]
+		if source == target || math.IsInf(float64(weight), 1) {
+			continue
+		}
+		c.connect(source, target, weight, uint32(l))
+	}
+
+	queue := make(minHeap, 0, nodes)
+	for n := range c.adj {
+		c.priority[n] = c.computePriority(uint32(n))
+		queue.push(uint32(n), float64(c.priority[n]))
+	}
+
+	for order := uint32(0); len(queue) > 0; {
+		item := queue.pop()
+		n := item.node
+		if c.contracted[n] || item.dist != float64(c.priority[n]) {
+			continue
+		}
+
+		// Lazy update: only contract if the node is still (one of) the best
+		if priority := c.computePriority(n); priority > c.priority[n] && float64(priority) > queue.peek() {
+			c.priority[n] = priority
+			queue.push(n, float64(priority))
+			continue
+		}
+
+		c.contractNode(n)
+		c.h.rank[n] = order
+		order++
+
+		for _, a := range c.up[n] {
+			c.deleted[a.node]++
+			c.level[a.node] = max(c.level[a.node], c.level[n]+1)
+			c.priority[a.node] = c.computePriority(a.node)
+			queue.push(a.node, float64(c.priority[a.node]))
+		}
+
+		if order%CONTRACT_LOG_INTERVAL == 0 {
+			log.Printf("Contracted %d of %d nodes (%d shortcuts)", order, nodes, len(c.h.shortcutFrom))
+		}
+	}
+
+	c.h.buildUpward(c.up)
+	log.Printf("Built contraction hierarchy for profile '%s' (%s) with %d shortcuts in %s",
+		profile.Name, profile.Metric, len(c.h.shortcutFrom), time.Since(start).Round(time.Millisecond))
+	return c.h, nil
+}
+
+// connect adds (or lowers the weight of) the arc between two nodes of the
+// remaining graph.
+func (c *contraction) connect(a, b uint32, weight float32, edge uint32) {
+	c.setArc(a, arc{node: b, weight: weight, edge: edge})
+	c.setArc(b, arc{node: a, weight: weight, edge: edge})
+}
+
+func (c *contraction) setArc(n uint32, a arc) {
+	for i := range c.adj[n] {
+		if c.adj[n][i].node == a.node {
+			if a.weight < c.adj[n][i].weight {
+				c.adj[n][i] = a
+			}
+			return
+		}
+	}
+	c.adj[n] = append(c.adj[n], a)
+}
+
+func (c *contraction) computePriority(n uint32) int32 {
+	shortcuts := c.shortcuts(n, priorityLimits, nil)
+	return 2*int32(shortcuts-len(c.adj[n])) + c.deleted[n] + c.level[n]
+}
+
+// contractNode removes the node from the remaining graph, adding shortcuts
+// between its neighbours wherever it lies on the only shortest path between
+// them. The node's remaining arcs become its upward arcs in the hierarchy.
+func (c *contraction) contractNode(n uint32) {
+	c.shortcuts(n, contractLimits, func(u, w arc) {
+		edge := c.h.addShortcut(u, w)
+		c.connect(u.node, w.node, u.weight+w.weight, edge)
+	})
+
+	c.up[n] = c.adj[n]
+	c.adj[n] = nil
+	c.contracted[n] = true
+	for _, a := range c.up[n] {
+		neighbours := c.adj[a.node]
+		for i := range neighbours {
+			if neighbours[i].node == n {
+				neighbours[i] = neighbours[len(neighbours)-1]
+				c.adj[a.node] = neighbours[:len(neighbours)-1]
+				break
+			}
+		}
+	}
+}
+
+// shortcuts counts the shortcuts needed to contract the node, calling add
+// (if not nil) with the pair of arcs each one replaces.
+func (c *contraction) shortcuts(n uint32, limits witnessLimits, add func(u, w arc)) int {
+	arcs := c.adj[n]
+	count := 0
+	for i, u := range arcs[:max(len(arcs)-1, 0)] {
+		c.targetGen++
+		if c.targetGen == 0 {
+			clear(c.targets)
+			c.targetGen = 1
+		}
+		var maxWeight float32
+		for _, w := range arcs[i+1:] {
+			maxWeight = max(maxWeight, w.weight)
+			c.targets[w.node] = c.targetGen
+		}
+
+		c.witnessSearch(u.node, n, float64(u.weight+maxWeight), len(arcs)-i-1, limits)
+		for _, w := range arcs[i+1:] {
+			if c.witness.distance(w.node) > float64(u.weight+w.weight) {
+				count++
+				if add != nil {
+					add(u, w)
+				}
+			}
+		}
+	}
+	return count
+}
+
+// witnessSearch runs a bounded Dijkstra search from source over the
+// remaining graph, avoiding the node being contracted, until every marked
+// target has been settled or a limit is reached. The hop count of each node
+// is held in place of its parent link, which is not needed.
+func (c *contraction) witnessSearch(source, avoid uint32, limit float64, targets int, limits witnessLimits) {
+	state := c.witness
+	state.reset()
+	state.label(source, 0, 0)
+
+	for settled := 0; len(state.heap) > 0 && settled < limits.settled && targets > 0; {
+		item := state.heap.pop()
+		if item.dist > state.distance(item.node) {
+			continue
+		}
+		if item.dist > limit {
+			break
+		}
+		settled++
+		if c.targets[item.node] == c.targetGen {
+			targets--
+		}
+
+		hops := state.parentLink[item.node] + 1
+		if hops > limits.hops {
+			continue
+		}
+		for _, a := range c.adj[item.node] {
+			if a.node == avoid {
+				continue
+			}
+			if dist := item.dist + float64(a.weight); dist < state.distance(a.node) {
+				state.label(a.node, dist, hops)
+			}
+		}
+	}
+}
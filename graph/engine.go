@@ -0,0 +1,435 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+// NearestNode returns the closest road node to the coordinate.
+func (g *Graph) NearestNode(ctx context.Context, coord models.Coordinate) (*models.SnappedNode, error) {
+	n, distance, ok := g.nodeGrid.nearest(coord, func(n uint32) float64 {
+		return coord.DistanceTo(g.nodeLocation(n))
+	})
+	if !ok {
+		return nil, repository.ErrNoNodeFound
+	}
+	return g.snappedNode(n, distance), nil
+}
+
+// NearestLinks snaps each coordinate onto the closest road link that the
+// profile allows and is not avoided (which may be nil), returning them in
+// the same order.
+func (g *Graph) NearestLinks(ctx context.Context, coords []models.Coordinate, profile *models.Profile, avoid *models.Avoid) ([]*models.SnappedLink, error) {
+	weights, err := g.weightsFor(profile)
+	if err != nil {
+		return nil, err
+	}
+	var avoided map[uint32]bool
+	if !avoid.IsEmpty() {
+		avoided = g.avoidedLinks(avoid)
+	}
+
+	links := make([]*models.SnappedLink, len(coords))
+	for i, coord := range coords {
+		l, _, ok := g.linkGrid.nearest(coord, func(l uint32) float64 {
+			if weights[l] == infinity || avoided[l] {
+				return math.Inf(1)
+			}
+			return g.project(l, coord).distanceM
+		})
+		if !ok {
+			return nil, repository.ErrNoLinkFound
+		}
+		links[i] = g.snappedLink(l, g.project(l, coord))
+	}
+	return links, nil
+}
+
+// NearestLinkNodes snaps each coordinate onto the closest road link that the
+// profile allows, as NearestLinks does, and returns the end of that link
+// nearer the snapped point.
+func (g *Graph) NearestLinkNodes(ctx context.Context, coords []models.Coordinate, profile *models.Profile) ([]*models.SnappedNode, error) {
+	links, err := g.NearestLinks(ctx, coords, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*models.SnappedNode, len(links))
+	for i, link := range links {
+		l := g.linkIndex[link.ID]
+		n := g.linkTarget[l]
+		if link.Fraction <= 0.5 {
+			n = g.linkSource[l]
+		}
+		nodes[i] = g.snappedNode(n, coords[i].DistanceTo(g.nodeLocation(n)))
+	}
+	return nodes, nil
+}
+
+// NearestLink finds the road link whose centre line passes closest to the
+// coordinate, returning the projected point and how far along the link
+// (0.0 = start node, 1.0 = end node) it lies.
+func (g *Graph) NearestLink(ctx context.Context, coord models.Coordinate) (*models.SnappedLink, error) {
+	l, _, ok := g.linkGrid.nearest(coord, func(l uint32) float64 {
+		return g.project(l, coord).distanceM
+	})
+	if !ok {
+		return nil, repository.ErrNoLinkFound
+	}
+	return g.snappedLink(l, g.project(l, coord)), nil
+}
+
+// NearestNamedLink is NearestLink restricted to the links that have a road
+// name or number.
+func (g *Graph) NearestNamedLink(ctx context.Context, coord models.Coordinate) (*models.SnappedLink, error) {
+	l, _, ok := g.linkGrid.nearest(coord, func(l uint32) float64 {
+		if g.name1[l] == 0 && g.roadNumber[l] == 0 {
+			return math.Inf(1)
+		}
+		return g.project(l, coord).distanceM
+	})
+	if !ok {
+		return nil, repository.ErrNoLinkFound
+	}
+	return g.snappedLink(l, g.project(l, coord)), nil
+}
+
+func (g *Graph) snappedLink(l uint32, p projection) *models.SnappedLink {
+	return &models.SnappedLink{
+		ID:                       g.linkIDs[l],
+		GmlID:                    g.linkGmlIDs[l],
+		Name1:                    g.name(g.name1[l]),
+		RoadClassificationNumber: g.name(g.roadNumber[l]),
+		Point:                    p.point,
+		Fraction:                 p.fraction,
+		DistanceM:                p.distanceM,
+	}
+}
+
+func (g *Graph) snappedNode(n uint32, distance float64) *models.SnappedNode {
+	return &models.SnappedNode{
+		ID:        g.nodeIDs[n],
+		GmlID:     g.nodeGmlIDs[n],
+		Location:  g.nodeLocation(n),
+		DistanceM: distance,
+	}
+}
+
+func (g *Graph) nodeOf(node *models.SnappedNode) (uint32, error) {
+	n, ok := g.nodeIndex[node.ID]
+	if !ok {
+		return 0, fmt.Errorf("road node %s is not in the routing graph", node.GmlID)
+	}
+	return n, nil
+}
+
+// ShortestPath finds the cheapest path between two points on links, with
+// the profile's contraction hierarchy if one is attached, or a bidirectional
+// Dijkstra search otherwise. Each point is treated as a virtual node
+// splitting its link, so the searches start from both ends of the link at
+// the cost of reaching them from the point. The cost of any penalised link
+// is multiplied by its penalty, and avoided links are not used at all; as
+// both change the link weights, such queries always use Dijkstra. An empty
+// result means the points are not connected.
+func (g *Graph) ShortestPath(ctx context.Context, from, to *models.SnappedLink, profile *models.Profile, opts models.PathOptions) ([]models.PathSegment, error) {
+	start, err := g.linkOf(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := g.linkOf(to)
+	if err != nil {
+		return nil, err
+	}
+
+	weights, err := g.edgeWeights(profile, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var h *Hierarchy
+	if len(opts.Penalties) == 0 && opts.Avoid.IsEmpty() {
+		h = g.hierarchyFor(profile)
+	}
+	segments, _ := g.pointPath(start, from.Fraction, end, to.Fraction, weights, h)
+	return segments, nil
+}
+
+// pointPath finds the cheapest path from the point at fraction fromFraction
+// along link start to the point at toFraction along link end, with the
+// hierarchy if one is given (which must have been built with the same
+// weights) or bidirectional Dijkstra otherwise. It returns the segments of
+// the path and its cost, which is +Inf (with no segments) if the points are
+// not connected.
+func (g *Graph) pointPath(start uint32, fromFraction float64, end uint32, toFraction float64, weights edgeWeights, h *Hierarchy) ([]models.PathSegment, float64) {
+	startWeight, endWeight := weights.of(start), weights.of(end)
+	sources := []seed{
+		{node: g.linkSource[start], cost: fromFraction * startWeight},
+		{node: g.linkTarget[start], cost: (1 - fromFraction) * startWeight},
+	}
+	targets := []seed{
+		{node: g.linkSource[end], cost: toFraction * endWeight},
+		{node: g.linkTarget[end], cost: (1 - toFraction) * endWeight},
+	}
+
+	var path []uint32
+	var n uint32
+	var cost float64
+	if h != nil {
+		path, n, cost = g.hierarchyPath(h, sources, targets)
+	} else {
+		path, n, cost = g.bidirectional(sources, targets, weights)
+	}
+
+	// Both points on the same link may be joined directly along it
+	if start == end && !math.IsInf(startWeight, 1) {
+		if direct := math.Abs(toFraction-fromFraction) * startWeight; direct <= cost {
+			return g.partialSegments(start, fromFraction, toFraction), direct
+		}
+	}
+	if math.IsInf(cost, 1) {
+		return nil, cost
+	}
+
+	segments := g.partialSegments(start, fromFraction, g.fractionAt(start, n))
+	for _, l := range path {
+		segments = append(segments, models.PathSegment{
+			LinkID:    g.linkIDs[l],
+			GmlID:     g.linkGmlIDs[l],
+			LengthM:   float64(g.lengthM[l]),
+			DurationS: g.duration(l),
+			Forward:   g.linkSource[l] == n,
+		})
+		n = g.otherEnd(l, n)
+	}
+	return append(segments, g.partialSegments(end, g.fractionAt(end, n), toFraction)...), cost
+}
+
+// partialSegments returns the segment covering link l between the two
+// fractions along it, or nothing if they are the same.
+func (g *Graph) partialSegments(l uint32, from, to float64) []models.PathSegment {
+	if from == to {
+		return []models.PathSegment{}
+	}
+	portion := math.Abs(to - from)
+	return []models.PathSegment{{
+		LinkID:    g.linkIDs[l],
+		GmlID:     g.linkGmlIDs[l],
+		LengthM:   float64(g.lengthM[l]) * portion,
+		DurationS: g.duration(l) * portion,
+		Forward:   to > from,
+		Portion:   &models.LinkPortion{From: from, To: to},
+	}}
+}
+
+// fractionAt is how far along link l its node n lies.
+func (g *Graph) fractionAt(l uint32, n uint32) float64 {
+	if g.linkSource[l] == n {
+		return 0
+	}
+	return 1
+}
+
+func (g *Graph) linkOf(link *models.SnappedLink) (uint32, error) {
+	l, ok := g.linkIndex[link.ID]
+	if !ok {
+		return 0, fmt.Errorf("road link %s is not in the routing graph", link.GmlID)
+	}
+	return l, nil
+}
+
+func (g *Graph) edgeWeights(profile *models.Profile, opts models.PathOptions) (edgeWeights, error) {
+	weights, err := g.weightsFor(profile)
+	if err != nil {
+		return edgeWeights{}, err
+	}
+
+	result := edgeWeights{weights: weights}
+	if len(opts.Penalties) > 0 {
+		result.penalties = make(map[uint32]float64, len(opts.Penalties))
+		for id, penalty := range opts.Penalties {
+			if l, ok := g.linkIndex[id]; ok {
+				result.penalties[l] = penalty
+			}
+		}
+	}
+	if !opts.Avoid.IsEmpty() {
+		result.avoided = g.avoidedLinks(opts.Avoid)
+	}
+	return result, nil
+}
+
+// CostMatrix computes the cost of the cheapest path between every pair of
+// nodes. Entry [i][j] is the cost from nodes[i] to nodes[j], or +Inf if
+// there is no path between them.
+func (g *Graph) CostMatrix(ctx context.Context, nodes []*models.SnappedNode, profile *models.Profile) ([][]float64, error) {
+	indexes, err := g.nodesOf(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	if h := g.hierarchyFor(profile); h != nil {
+		costs, _, _, err := g.hierarchyMatrix(ctx, h, indexes, indexes)
+		return costs, err
+	}
+
+	weights, err := g.edgeWeights(profile, models.PathOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	matrix := make([][]float64, len(nodes))
+	err = g.manyToMany(ctx, indexes, indexes, weights, func(i int, state *searchState, targets []uint32) {
+		matrix[i] = make([]float64, len(targets))
+		for j, target := range targets {
+			matrix[i][j] = state.distance(target)
+		}
+	})
+	return matrix, err
+}
+
+// DistanceMatrix finds the cheapest path (as per the profile) from every
+// origin to every destination, and returns the total length and duration of
+// each path. Entry [i][j] is for origins[i] to destinations[j], or +Inf if
+// there is no path between them.
+func (g *Graph) DistanceMatrix(ctx context.Context, origins, destinations []*models.SnappedNode, profile *models.Profile) ([][]float64, [][]float64, error) {
+	sources, err := g.nodesOf(origins)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets, err := g.nodesOf(destinations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if h := g.hierarchyFor(profile); h != nil {
+		_, distances, durations, err := g.hierarchyMatrix(ctx, h, sources, targets)
+		return distances, durations, err
+	}
+
+	weights, err := g.edgeWeights(profile, models.PathOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	distances := make([][]float64, len(origins))
+	durations := make([][]float64, len(origins))
+	err = g.manyToMany(ctx, sources, targets, weights, func(i int, state *searchState, targets []uint32) {
+		distances[i] = make([]float64, len(targets))
+		durations[i] = make([]float64, len(targets))
+		for j, target := range targets {
+			if math.IsInf(state.distance(target), 1) {
+				distances[i][j], durations[i][j] = math.Inf(1), math.Inf(1)
+				continue
+			}
+			for n := target; state.parentLink[n] != -1; {
+				l := uint32(state.parentLink[n])
+				distances[i][j] += float64(g.lengthM[l])
+				durations[i][j] += g.duration(l)
+				n = g.otherEnd(l, n)
+			}
+		}
+	})
+	return distances, durations, err
+}
+
+// nodesOf resolves the index of each snapped node in the graph.
+func (g *Graph) nodesOf(nodes []*models.SnappedNode) ([]uint32, error) {
+	results := make([]uint32, len(nodes))
+	for i, node := range nodes {
+		n, err := g.nodeOf(node)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = n
+	}
+	return results, nil
+}
+
+// manyToMany runs a one-to-many search from each origin, spread across the
+// available CPUs, and hands each completed search to collect along with the
+// destination node indexes.
+func (g *Graph) manyToMany(ctx context.Context, sources, targets []uint32, weights edgeWeights, collect func(i int, state *searchState, targets []uint32)) error {
+	return parallel(ctx, len(sources), func(i int) {
+		state := g.oneToMany(sources[i], targets, weights)
+		collect(i, state, targets)
+		g.releaseState(state)
+	})
+}
+
+// parallel calls fn for each of 0..n-1, spread across the available CPUs,
+// stopping early if the context is cancelled.
+func parallel(ctx context.Context, n int, fn func(i int)) error {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := range n {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// FetchRouteLinks returns the attributes and geometry of the links with the
+// given ids. Centre lines are returned in digitised order, and roundabout
+// links count the exits at each end.
+func (g *Graph) FetchRouteLinks(ctx context.Context, ids []int64) (map[int64]models.RouteLink, error) {
+	results := make(map[int64]models.RouteLink, len(ids))
+	for _, id := range ids {
+		l, ok := g.linkIndex[id]
+		if !ok {
+			continue
+		}
+
+		link := models.RouteLink{
+			ID:                       id,
+			GmlID:                    g.linkGmlIDs[l],
+			Name1:                    g.name(g.name1[l]),
+			RoadClassificationNumber: g.name(g.roadNumber[l]),
+			LengthM:                  float64(g.lengthM[l]),
+			DurationS:                g.duration(l),
+			PrimaryRoute:             g.flags[l]&FLAG_PRIMARY_ROUTE != 0,
+			TrunkRoad:                g.flags[l]&FLAG_TRUNK_ROAD != 0,
+			CenterLine:               g.centerLine(l),
+			Elevations:               g.elevations(l),
+		}
+		link.RoadClassification, link.RoadClassificationDescription = refValue(g.refData.RoadClassifications, g.roadClassification[l])
+		link.RoadFunction, link.RoadFunctionDescription = refValue(g.refData.RoadFunctions, g.roadFunction[l])
+		link.FormOfWay, link.FormOfWayDescription = refValue(g.refData.FormOfWayTypes, g.formOfWay[l])
+		if link.FormOfWay == FORM_OF_WAY_ROUNDABOUT {
+			link.StartExits, link.EndExits = g.exits(g.linkSource[l]), g.exits(g.linkTarget[l])
+		}
+		results[id] = link
+	}
+	return results, nil
+}
+
+// exits counts the links at a node that are not part of a roundabout.
+func (g *Graph) exits(n uint32) int {
+	count := 0
+	for _, l := range g.adjLink[g.firstAdj[n]:g.firstAdj[n+1]] {
+		if value, _ := refValue(g.refData.FormOfWayTypes, g.formOfWay[l]); value != FORM_OF_WAY_ROUNDABOUT {
+			count++
+		}
+	}
+	return count
+}
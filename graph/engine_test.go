@@ -0,0 +1,97 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+func TestFetchRouteLinksCountsRoundaboutExits(t *testing.T) {
+	b := NewBuilder(&models.NetworkRefData{
+		FormOfWayTypes: []models.RefData{{ID: 1, Value: "Single Carriageway"}, {ID: 2, Value: FORM_OF_WAY_ROUNDABOUT}},
+	})
+	for n := range 7 {
+		err := b.AddNode(models.NetworkNode{ID: int64(n + 1), GmlID: fmt.Sprintf("node-%d", n), Location: models.Coordinate{Lat: 51, Lon: float64(n) / 1000}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A roundabout of nodes 1, 2 and 3, entered at 1, with one road off at 2
+	// and two at 3
+	links := [][3]int64{{1, 2, 2}, {2, 3, 2}, {3, 1, 2}, {4, 1, 1}, {2, 5, 1}, {3, 6, 1}, {7, 3, 1}}
+	for i, link := range links {
+		err := b.AddLink(models.NetworkLink{ID: int64(i + 1), GmlID: fmt.Sprintf("link-%d", i), SourceID: link[0], TargetID: link[1], FormOfWayID: int32(link[2]), LengthM: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := b.Build()
+
+	fetched, err := g.FetchRouteLinks(context.Background(), []int64{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int64][2]int{1: {1, 1}, 2: {1, 2}, 3: {2, 1}, 4: {0, 0}}
+	for id, exits := range expected {
+		if link := fetched[id]; link.StartExits != exits[0] || link.EndExits != exits[1] {
+			t.Errorf("link %d has %d and %d exits, expected %v", id, link.StartExits, link.EndExits, exits)
+		}
+	}
+}
+
+func TestNearestLinkNodesSkipsExcludedLinks(t *testing.T) {
+	b := NewBuilder(&models.NetworkRefData{
+		FormOfWayTypes: []models.RefData{{ID: 1, Value: "Single Carriageway"}, {ID: 2, Value: "Track"}},
+	})
+	// A track running beside the coordinate, and a road parallel to it
+	// further off
+	locations := []models.Coordinate{{Lat: 51, Lon: 0}, {Lat: 51, Lon: 0.002}, {Lat: 51.001, Lon: 0}, {Lat: 51.001, Lon: 0.002}}
+	for n, location := range locations {
+		err := b.AddNode(models.NetworkNode{ID: int64(n + 1), GmlID: fmt.Sprintf("node-%d", n), Location: location})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, link := range [][3]int64{{1, 2, 2}, {3, 4, 1}} {
+		from, to := locations[link[0]-1], locations[link[1]-1]
+		err := b.AddLink(models.NetworkLink{
+			ID:          int64(i + 1),
+			GmlID:       fmt.Sprintf("link-%d", i),
+			SourceID:    link[0],
+			TargetID:    link[1],
+			FormOfWayID: int32(link[2]),
+			LengthM:     from.DistanceTo(to),
+			CenterLine:  models.LineString{{from.Lon, from.Lat}, {to.Lon, to.Lat}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := b.Build()
+	coord := models.Coordinate{Lat: 51.0001, Lon: 0.0015}
+
+	// The coordinate is nearer the second node along either link
+
+	tests := []struct {
+		name     string
+		profile  *models.Profile
+		expected string
+	}{
+		{name: "any link", profile: &models.Profile{Name: "any", Metric: models.METRIC_DISTANCE}, expected: "node-1"},
+		{name: "tracks excluded", profile: &models.Profile{Name: "no-tracks", Metric: models.METRIC_DISTANCE, Exclude: models.ProfileExclusions{FormOfWay: []string{"Track"}}}, expected: "node-3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes, err := g.NearestLinkNodes(context.Background(), []models.Coordinate{coord}, test.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nodes[0].GmlID != test.expected {
+				t.Fatalf("snapped to %s, expected %s", nodes[0].GmlID, test.expected)
+			}
+		})
+	}
+}
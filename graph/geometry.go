@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"math"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// projection is the closest point on a link's centre line to a coordinate.
+type projection struct {
+	point models.Coordinate
+	// How far along the centre line (in digitised order) the point lies,
+	// from 0.0 at the source node to 1.0 at the target node
+	fraction  float64
+	distanceM float64
+}
+
+// project finds the closest point on link l's centre line to the
+// coordinate. Segments are projected in a local equirectangular plane
+// around the coordinate, which is accurate over the short distances
+// involved in snapping.
+func (g *Graph) project(l uint32, coord models.Coordinate) projection {
+	coords := g.shapeCoords[2*g.shapeStart[l] : 2*g.shapeStart[l+1]]
+	scale := math.Cos(coord.Lat * math.Pi / 180)
+
+	// Plane coordinates (in degrees of latitude) of point i of the line
+	xy := func(i int) (float64, float64) {
+		return (float64(coords[2*i]) - coord.Lon) * scale, float64(coords[2*i+1]) - coord.Lat
+	}
+
+	points := len(coords) / 2
+	if points == 1 {
+		point := models.Coordinate{Lat: float64(coords[1]), Lon: float64(coords[0])}
+		return projection{point: point, distanceM: coord.DistanceTo(point)}
+	}
+
+	bestSq, bestAlong, bestX, bestY := math.Inf(1), 0.0, 0.0, 0.0
+	total := 0.0
+	for i := 1; i < points; i++ {
+		x0, y0 := xy(i - 1)
+		x1, y1 := xy(i)
+		dx, dy := x1-x0, y1-y0
+		lengthSq := dx*dx + dy*dy
+
+		t := 0.0
+		if lengthSq > 0 {
+			t = math.Max(0, math.Min(1, -(x0*dx+y0*dy)/lengthSq))
+		}
+		px, py := x0+t*dx, y0+t*dy
+		if distSq := px*px + py*py; distSq < bestSq {
+			bestSq, bestAlong, bestX, bestY = distSq, total+t*math.Sqrt(lengthSq), px, py
+		}
+		total += math.Sqrt(lengthSq)
+	}
+
+	point := models.Coordinate{Lat: coord.Lat + bestY, Lon: coord.Lon + bestX/scale}
+	fraction := 0.0
+	if total > 0 {
+		fraction = bestAlong / total
+	}
+	return projection{point: point, fraction: fraction, distanceM: coord.DistanceTo(point)}
+}
@@ -0,0 +1,146 @@
+package graph
+
+import (
+	"math"
+	"sync"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Bit flags held per link
+const (
+	FLAG_PRIMARY_ROUTE = 1 << iota
+	FLAG_TRUNK_ROAD
+)
+
+// Form of way value of the links that make up a roundabout
+const FORM_OF_WAY_ROUNDABOUT = "Roundabout"
+
+// Graph is a compact, read-only, in-memory copy of the road network. Nodes
+// and links are addressed by their index; adjacency is held in compressed
+// sparse row (CSR) form, with every link appearing in the adjacency list of
+// both of its nodes, as the network is undirected.
+type Graph struct {
+	nodeIDs    []int64
+	nodeGmlIDs []string
+	nodeLats   []float64
+	nodeLons   []float64
+
+	// The adjacency entries for node n are [firstAdj[n], firstAdj[n+1])
+	firstAdj []uint32
+	adjNode  []uint32
+	adjLink  []uint32
+
+	linkIDs            []int64
+	linkGmlIDs         []string
+	linkSource         []uint32
+	linkTarget         []uint32
+	lengthM            []float32
+	durationS          []float32
+	roadClassification []uint16
+	roadFunction       []uint16
+	formOfWay          []uint16
+	flags              []uint8
+	name1              []uint32
+	roadNumber         []uint32
+	ascentM            []float32
+	descentM           []float32
+	maxGradient        []float32
+
+	// The centre line of link l is the [lon, lat] pairs in
+	// shapeCoords[2*shapeStart[l] : 2*shapeStart[l+1]]
+	shapeStart  []uint32
+	shapeCoords []float32
+	// Height of each centre line position, NaN if not imported
+	shapeElevations []float32
+
+	// Interned road names and numbers; index 0 means none
+	names []string
+
+	refData models.NetworkRefData
+
+	nodeIndex map[int64]uint32
+	linkIndex map[int64]uint32
+	nodeGrid  *grid
+	linkGrid  *grid
+
+	// gml_id lookup for links, only built once something needs it
+	linkGmlOnce  sync.Once
+	linkGmlIndex map[string]uint32
+
+	weightsMu sync.Mutex
+	weights   map[string][]float32
+	states    sync.Pool
+
+	hierarchiesMu sync.RWMutex
+	hierarchies   map[string]*Hierarchy
+}
+
+func (g *Graph) NodeCount() int {
+	return len(g.nodeIDs)
+}
+
+func (g *Graph) LinkCount() int {
+	return len(g.linkIDs)
+}
+
+func (g *Graph) nodeLocation(n uint32) models.Coordinate {
+	return models.Coordinate{Lat: g.nodeLats[n], Lon: g.nodeLons[n]}
+}
+
+// otherEnd returns the node at the opposite end of link l to node n.
+func (g *Graph) otherEnd(l uint32, n uint32) uint32 {
+	if g.linkSource[l] == n {
+		return g.linkTarget[l]
+	}
+	return g.linkSource[l]
+}
+
+func (g *Graph) centerLine(l uint32) models.LineString {
+	coords := g.shapeCoords[2*g.shapeStart[l] : 2*g.shapeStart[l+1]]
+	line := make(models.LineString, len(coords)/2)
+	for i := range line {
+		line[i] = [2]float64{float64(coords[2*i]), float64(coords[2*i+1])}
+	}
+	return line
+}
+
+// elevations returns the heights along the centre line of link l, or nil if
+// none have been imported.
+func (g *Graph) elevations(l uint32) []float32 {
+	heights := g.shapeElevations[g.shapeStart[l]:g.shapeStart[l+1]]
+	if len(heights) == 0 || math.IsNaN(float64(heights[0])) {
+		return nil
+	}
+	return append([]float32(nil), heights...)
+}
+
+// duration returns the time taken to travel link l, falling back to the
+// speed model's default speed where it has no stored duration.
+func (g *Graph) duration(l uint32) float64 {
+	if g.durationS[l] == 0 {
+		return float64(g.lengthM[l]) / (models.DefaultSpeedModel.DefaultMph * models.MPH_TO_METRES_PER_SECOND)
+	}
+	return float64(g.durationS[l])
+}
+
+func (g *Graph) name(index uint32) *string {
+	if index == 0 {
+		return nil
+	}
+	name := g.names[index]
+	return &name
+}
+
+// refValue looks up the value and description of a ref-data id.
+func refValue(table []models.RefData, id uint16) (string, *string) {
+	for _, entry := range table {
+		if entry.ID == int32(id) {
+			return entry.Value, entry.Description
+		}
+	}
+	return "", nil
+}
+
+// float32 representation of an impassable link
+var infinity = float32(math.Inf(1))
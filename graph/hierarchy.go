@@ -0,0 +1,160 @@
+package graph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Hierarchy is a contraction hierarchy over a graph for one profile and
+// metric. Edges are numbered with the graph's links first, followed by the
+// shortcuts, each of which replaces a pair of edges meeting at a contracted
+// (middle) node. As the network is undirected, a single upward graph serves
+// both directions of a query.
+type Hierarchy struct {
+	Profile string
+	Metric  string
+
+	// Identifies the graph and link weights the hierarchy was built from
+	fingerprint uint64
+	linkCount   uint32
+
+	rank []uint32
+
+	// The upward arcs of node n are [firstUp[n], firstUp[n+1]), leading to
+	// higher ranked nodes
+	firstUp  []uint32
+	upNode   []uint32
+	upEdge   []uint32
+	upWeight []float32
+
+	// Totals per edge, so path lengths can be summed without unpacking
+	edgeLength   []float32
+	edgeDuration []float32
+
+	// Shortcut s (edge linkCount+s) runs from shortcutFrom[s] to shortcutTo[s]
+	// via edges shortcutFirst[s] then shortcutSecond[s]
+	shortcutFrom   []uint32
+	shortcutTo     []uint32
+	shortcutFirst  []uint32
+	shortcutSecond []uint32
+}
+
+func (h *Hierarchy) key() string {
+	return h.Profile + "/" + h.Metric
+}
+
+// HierarchyFileName is the conventional name of the file holding the
+// hierarchy for the profile.
+func HierarchyFileName(profile *models.Profile) string {
+	return fmt.Sprintf("%s.%s.ch", profile.Name, profile.Metric)
+}
+
+func (h *Hierarchy) addShortcut(first, second arc) uint32 {
+	edge := h.linkCount + uint32(len(h.shortcutFrom))
+	h.shortcutFrom = append(h.shortcutFrom, first.node)
+	h.shortcutTo = append(h.shortcutTo, second.node)
+	h.shortcutFirst = append(h.shortcutFirst, first.edge)
+	h.shortcutSecond = append(h.shortcutSecond, second.edge)
+	h.edgeLength = append(h.edgeLength, h.edgeLength[first.edge]+h.edgeLength[second.edge])
+	h.edgeDuration = append(h.edgeDuration, h.edgeDuration[first.edge]+h.edgeDuration[second.edge])
+	return edge
+}
+
+func (h *Hierarchy) buildUpward(up [][]arc) {
+	h.firstUp = make([]uint32, len(up)+1)
+	for n, arcs := range up {
+		h.firstUp[n+1] = h.firstUp[n] + uint32(len(arcs))
+	}
+
+	total := h.firstUp[len(up)]
+	h.upNode = make([]uint32, 0, total)
+	h.upEdge = make([]uint32, 0, total)
+	h.upWeight = make([]float32, 0, total)
+	for _, arcs := range up {
+		for _, a := range arcs {
+			h.upNode = append(h.upNode, a.node)
+			h.upEdge = append(h.upEdge, a.edge)
+			h.upWeight = append(h.upWeight, a.weight)
+		}
+	}
+}
+
+// otherEnd returns the node at the opposite end of edge e to node n.
+func (h *Hierarchy) otherEnd(g *Graph, e uint32, n uint32) uint32 {
+	if e < h.linkCount {
+		return g.otherEnd(e, n)
+	}
+	s := e - h.linkCount
+	if h.shortcutFrom[s] == n {
+		return h.shortcutTo[s]
+	}
+	return h.shortcutFrom[s]
+}
+
+// unpack appends the links that edge e stands for, in order of travel from
+// node n.
+func (h *Hierarchy) unpack(g *Graph, e uint32, n uint32, links []uint32) []uint32 {
+	if e < h.linkCount {
+		return append(links, e)
+	}
+
+	s := e - h.linkCount
+	first, second := h.shortcutFirst[s], h.shortcutSecond[s]
+	if h.shortcutFrom[s] != n {
+		first, second = second, first
+	}
+	links = h.unpack(g, first, n, links)
+	return h.unpack(g, second, h.otherEnd(g, first, n), links)
+}
+
+// fingerprint hashes the structure of the graph and the given link weights,
+// so that a hierarchy can be matched to the graph it was built from.
+func (g *Graph) fingerprint(weights []float32) uint64 {
+	hash := fnv.New64a()
+	buf := make([]byte, 0, 32)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(g.nodeIDs)))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(g.linkIDs)))
+	hash.Write(buf)
+
+	for l, id := range g.linkIDs {
+		buf = buf[:0]
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(id))
+		buf = binary.LittleEndian.AppendUint32(buf, g.linkSource[l])
+		buf = binary.LittleEndian.AppendUint32(buf, g.linkTarget[l])
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(weights[l]))
+		hash.Write(buf)
+	}
+	return hash.Sum64()
+}
+
+// UseHierarchy attaches a hierarchy to the graph, so that unpenalised
+// queries for its profile and metric are answered with it. The hierarchy
+// must have been built from the same network and profile weights.
+func (g *Graph) UseHierarchy(h *Hierarchy, profile *models.Profile) error {
+	weights, err := g.weightsFor(profile)
+	if err != nil {
+		return err
+	}
+	if h.Profile != profile.Name || h.Metric != profile.Metric {
+		return fmt.Errorf("hierarchy was built for profile '%s' (%s), not '%s' (%s)",
+			h.Profile, h.Metric, profile.Name, profile.Metric)
+	}
+	if h.fingerprint != g.fingerprint(weights) || len(h.firstUp) != len(g.nodeIDs)+1 {
+		return fmt.Errorf("hierarchy for profile '%s' does not match the road network or profile; re-run prepare", h.Profile)
+	}
+
+	g.hierarchiesMu.Lock()
+	defer g.hierarchiesMu.Unlock()
+	g.hierarchies[h.key()] = h
+	return nil
+}
+
+func (g *Graph) hierarchyFor(profile *models.Profile) *Hierarchy {
+	g.hierarchiesMu.RLock()
+	defer g.hierarchiesMu.RUnlock()
+	return g.hierarchies[profile.Name+"/"+profile.Metric]
+}
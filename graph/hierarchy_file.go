@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+)
+
+const HIERARCHY_MAGIC = "RPCH"
+
+// Bumped whenever the layout or contents of hierarchy files change
+const HIERARCHY_VERSION = 2
+
+// Write serialises the hierarchy in a compact, checksummed binary format.
+func (h *Hierarchy) Write(w io.Writer) error {
+	bw := newBinaryWriter(w)
+	bw.write([]byte(HIERARCHY_MAGIC))
+	bw.write(uint32(HIERARCHY_VERSION))
+	bw.string(h.Profile)
+	bw.string(h.Metric)
+	bw.write(h.fingerprint)
+	bw.write(h.linkCount)
+
+	bw.slice(h.rank, len(h.rank))
+	bw.slice(h.firstUp, len(h.firstUp))
+	bw.slice(h.upNode, len(h.upNode))
+	bw.slice(h.upEdge, len(h.upEdge))
+	bw.slice(h.upWeight, len(h.upWeight))
+	bw.slice(h.edgeLength, len(h.edgeLength))
+	bw.slice(h.edgeDuration, len(h.edgeDuration))
+	bw.slice(h.shortcutFrom, len(h.shortcutFrom))
+	bw.slice(h.shortcutTo, len(h.shortcutTo))
+	bw.slice(h.shortcutFirst, len(h.shortcutFirst))
+	bw.slice(h.shortcutSecond, len(h.shortcutSecond))
+
+	if err := bw.finish(); err != nil {
+		return fmt.Errorf("failed to write hierarchy: %v", err)
+	}
+	return nil
+}
+
+// ReadHierarchy reads a hierarchy written by Hierarchy.Write. It still has
+// to be attached to a graph with UseHierarchy, which checks that it matches.
+func ReadHierarchy(r io.Reader) (*Hierarchy, error) {
+	br := newBinaryReader(r)
+
+	magic := make([]byte, len(HIERARCHY_MAGIC))
+	var version uint32
+	br.read(magic)
+	br.read(&version)
+	if br.err != nil {
+		return nil, fmt.Errorf("failed to read hierarchy header: %v", br.err)
+	}
+	if string(magic) != HIERARCHY_MAGIC {
+		return nil, fmt.Errorf("not a contraction hierarchy file")
+	}
+	if version != HIERARCHY_VERSION {
+		return nil, fmt.Errorf("unsupported hierarchy file version %d (expected %d); re-run prepare", version, HIERARCHY_VERSION)
+	}
+
+	h := &Hierarchy{}
+	h.Profile = br.string()
+	h.Metric = br.string()
+	br.read(&h.fingerprint)
+	br.read(&h.linkCount)
+
+	h.rank = readSlice[uint32](br)
+	h.firstUp = readSlice[uint32](br)
+	h.upNode = readSlice[uint32](br)
+	h.upEdge = readSlice[uint32](br)
+	h.upWeight = readSlice[float32](br)
+	h.edgeLength = readSlice[float32](br)
+	h.edgeDuration = readSlice[float32](br)
+	h.shortcutFrom = readSlice[uint32](br)
+	h.shortcutTo = readSlice[uint32](br)
+	h.shortcutFirst = readSlice[uint32](br)
+	h.shortcutSecond = readSlice[uint32](br)
+
+	if err := br.finish(); err != nil {
+		return nil, fmt.Errorf("failed to read hierarchy: %v", err)
+	}
+	return h, nil
+}
@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+func writeHierarchy(t *testing.T, h *Hierarchy) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := h.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestHierarchyFileRoundTrip(t *testing.T) {
+	profile := &models.Profile{Name: "quickest", Metric: models.METRIC_DURATION}
+	g := randomNetwork(t, 5, 60, 100)
+	h, err := g.Contract(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := writeHierarchy(t, h)
+
+	read, err := ReadHierarchy(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Profile != h.Profile || read.Metric != h.Metric || read.fingerprint != h.fingerprint || read.linkCount != h.linkCount {
+		t.Fatalf("header did not round trip: %s/%s %x %d", read.Profile, read.Metric, read.fingerprint, read.linkCount)
+	}
+	if !bytes.Equal(writeHierarchy(t, read), data) {
+		t.Fatal("hierarchy file of the read hierarchy differs from the original")
+	}
+	if err := g.UseHierarchy(read, profile); err != nil {
+		t.Fatal(err)
+	}
+
+	for source := range uint32(g.NodeCount()) {
+		_, _, cost := g.hierarchyPath(read, []seed{{node: source}}, []seed{{node: 0}})
+		_, _, expected := g.hierarchyPath(h, []seed{{node: source}}, []seed{{node: 0}})
+		if cost != expected {
+			t.Fatalf("%d -> 0 costs %v after reading, expected %v", source, cost, expected)
+		}
+	}
+}
+
+func TestHierarchyFileRejectsFlippedBytes(t *testing.T) {
+	g := randomNetwork(t, 6, 10, 15)
+	h, err := g.Contract(&models.Profile{Name: "shortest", Metric: models.METRIC_DISTANCE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := writeHierarchy(t, h)
+
+	for i := range data {
+		if _, err := ReadHierarchy(openCorrupted(t, data, i)); err == nil {
+			t.Fatalf("hierarchy with byte %d of %d flipped was read without error", i, len(data))
+		}
+	}
+}
+
+func TestUseHierarchyRejectsOtherProfiles(t *testing.T) {
+	g := randomNetwork(t, 7, 10, 15)
+	h, err := g.Contract(&models.Profile{Name: "shortest", Metric: models.METRIC_DISTANCE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.UseHierarchy(h, &models.Profile{Name: "shortest", Metric: models.METRIC_DURATION}); err == nil {
+		t.Fatal("expected a hierarchy for another metric to be rejected")
+	}
+}
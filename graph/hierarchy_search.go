@@ -0,0 +1,185 @@
+package graph
+
+import (
+	"context"
+	"math"
+)
+
+// settleUp pops the closest node off the state's heap and relaxes its
+// upward arcs. It returns the node, or false if the popped entry was stale.
+// A node is stalled (left unrelaxed) if it can be reached more cheaply back
+// down from a higher node, as it then cannot be on a shortest path.
+func (h *Hierarchy) settleUp(state *searchState) (uint32, bool) {
+	item := state.heap.pop()
+	if item.dist > state.distance(item.node) {
+		return 0, false
+	}
+
+	for up := h.firstUp[item.node]; up < h.firstUp[item.node+1]; up++ {
+		if state.distance(h.upNode[up])+float64(h.upWeight[up]) < item.dist {
+			return item.node, true
+		}
+	}
+
+	for up := h.firstUp[item.node]; up < h.firstUp[item.node+1]; up++ {
+		next := h.upNode[up]
+		if dist := item.dist + float64(h.upWeight[up]); dist < state.distance(next) {
+			state.label(next, dist, int32(h.upEdge[up]))
+		}
+	}
+	return item.node, true
+}
+
+// hierarchyPath finds the cheapest path between the seeds at either end
+// with an upward search from each end, which meet at the highest ranked node
+// on the path. Each search stops once its frontier is no closer than the
+// best meeting point found. Like bidirectional, it returns the links of the
+// path in travel order, the seed node the path starts from and its cost.
+func (g *Graph) hierarchyPath(h *Hierarchy, sources, targets []seed) ([]uint32, uint32, float64) {
+	forward, backward := g.acquireState(), g.acquireState()
+	defer g.releaseState(forward)
+	defer g.releaseState(backward)
+
+	best, meet := math.Inf(1), uint32(0)
+	for _, s := range sources {
+		if s.cost < forward.distance(s.node) {
+			forward.label(s.node, s.cost, -1)
+		}
+	}
+	for _, t := range targets {
+		if t.cost < backward.distance(t.node) {
+			backward.label(t.node, t.cost, -1)
+		}
+		if dist := forward.distance(t.node) + backward.distance(t.node); dist < best {
+			best, meet = dist, t.node
+		}
+	}
+
+	for {
+		state, other := forward, backward
+		if backward.heap.peek() < forward.heap.peek() {
+			state, other = backward, forward
+		}
+		if state.heap.peek() >= best {
+			break
+		}
+
+		if n, ok := h.settleUp(state); ok {
+			if dist := state.distance(n) + other.distance(n); dist < best {
+				best, meet = dist, n
+			}
+		}
+	}
+
+	if math.IsInf(best, 1) {
+		return nil, 0, best
+	}
+
+	// The forward edges are found from the meeting point backwards, so are
+	// unpacked once their starting nodes are known
+	edges := make([]uint32, 0)
+	start := meet
+	for forward.parentLink[start] != -1 {
+		e := uint32(forward.parentLink[start])
+		edges = append(edges, e)
+		start = h.otherEnd(g, e, start)
+	}
+
+	path := make([]uint32, 0)
+	n := start
+	for i := len(edges) - 1; i >= 0; i-- {
+		path = h.unpack(g, edges[i], n, path)
+		n = h.otherEnd(g, edges[i], n)
+	}
+	for n := meet; backward.parentLink[n] != -1; {
+		e := uint32(backward.parentLink[n])
+		path = h.unpack(g, e, n, path)
+		n = h.otherEnd(g, e, n)
+	}
+	return path, start, best
+}
+
+// An entry in the search space of an exhaustive upward search
+type upwardLabel struct {
+	node      uint32
+	cost      float64
+	lengthM   float64
+	durationS float64
+}
+
+// upwardSearch settles every node reachable upwards from the source, along
+// with the length and duration of the path to each.
+func (g *Graph) upwardSearch(h *Hierarchy, source uint32) []upwardLabel {
+	state := g.acquireState()
+	defer g.releaseState(state)
+	state.label(source, 0, -1)
+
+	labels := make([]upwardLabel, 0)
+	index := make(map[uint32]int)
+	for len(state.heap) > 0 {
+		n, ok := h.settleUp(state)
+		if !ok {
+			continue
+		}
+
+		label := upwardLabel{node: n, cost: state.distance(n)}
+		if e := state.parentLink[n]; e != -1 {
+			parent := labels[index[h.otherEnd(g, uint32(e), n)]]
+			label.lengthM = parent.lengthM + float64(h.edgeLength[e])
+			label.durationS = parent.durationS + float64(h.edgeDuration[e])
+		}
+		index[n] = len(labels)
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+// hierarchyMatrix computes the cost, length and duration of the cheapest
+// path from every source to every target with the bucket-based many-to-many
+// algorithm: the upward search space of each target is recorded in buckets
+// at the nodes it reaches, which are then scanned by an upward search from
+// each source.
+func (g *Graph) hierarchyMatrix(ctx context.Context, h *Hierarchy, sources, targets []uint32) ([][]float64, [][]float64, [][]float64, error) {
+	type bucketEntry struct {
+		target int
+		label  upwardLabel
+	}
+
+	searches := make([][]upwardLabel, len(targets))
+	err := parallel(ctx, len(targets), func(j int) {
+		searches[j] = g.upwardSearch(h, targets[j])
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	buckets := make(map[uint32][]bucketEntry)
+	for j, labels := range searches {
+		for _, label := range labels {
+			buckets[label.node] = append(buckets[label.node], bucketEntry{target: j, label: label})
+		}
+	}
+
+	costs := make([][]float64, len(sources))
+	lengths := make([][]float64, len(sources))
+	durations := make([][]float64, len(sources))
+	err = parallel(ctx, len(sources), func(i int) {
+		costs[i] = make([]float64, len(targets))
+		lengths[i] = make([]float64, len(targets))
+		durations[i] = make([]float64, len(targets))
+		for j := range targets {
+			costs[i][j], lengths[i][j], durations[i][j] = math.Inf(1), math.Inf(1), math.Inf(1)
+		}
+
+		for _, label := range g.upwardSearch(h, sources[i]) {
+			for _, entry := range buckets[label.node] {
+				if cost := label.cost + entry.label.cost; cost < costs[i][entry.target] {
+					costs[i][entry.target] = cost
+					lengths[i][entry.target] = label.lengthM + entry.label.lengthM
+					durations[i][entry.target] = label.durationS + entry.label.durationS
+				}
+			}
+		}
+	})
+	return costs, lengths, durations, err
+}
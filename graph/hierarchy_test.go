@@ -0,0 +1,136 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// randomNetwork builds a graph of nodes scattered over a small area, joined
+// by random links (including parallel links, loops and isolated nodes). Some
+// links have no duration, so fall back to the default speed.
+func randomNetwork(t *testing.T, seed int64, nodes, links int) *Graph {
+	t.Helper()
+	random := rand.New(rand.NewSource(seed))
+	b := NewBuilder(&models.NetworkRefData{
+		RoadClassifications: []models.RefData{{ID: 1, Value: "A Road"}, {ID: 2, Value: "Unclassified"}},
+	})
+
+	locations := make([]models.Coordinate, nodes)
+	for n := range nodes {
+		locations[n] = models.Coordinate{Lat: 51 + random.Float64()/10, Lon: -1 + random.Float64()/10}
+		err := b.AddNode(models.NetworkNode{ID: int64(n + 1), GmlID: fmt.Sprintf("node-%d", n), Location: locations[n]})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for l := range links {
+		source, target := random.Intn(nodes), random.Intn(nodes)
+		link := models.NetworkLink{
+			ID:                   int64(l + 1),
+			GmlID:                fmt.Sprintf("link-%d", l),
+			SourceID:             int64(source + 1),
+			TargetID:             int64(target + 1),
+			RoadClassificationID: int32(1 + random.Intn(2)),
+			LengthM:              float64(10 + random.Intn(1000)),
+			CenterLine: models.LineString{
+				{locations[source].Lon, locations[source].Lat},
+				{locations[target].Lon, locations[target].Lat},
+			},
+		}
+		if random.Intn(4) != 0 {
+			link.DurationS = float64(1 + random.Intn(100))
+		}
+		if err := b.AddLink(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Build()
+}
+
+func closeTo(a, b float64) bool {
+	if math.IsInf(a, 1) || math.IsInf(b, 1) {
+		return a == b
+	}
+	return math.Abs(a-b) <= 1e-6*math.Max(1, math.Abs(b))
+}
+
+func TestHierarchyMatchesUncontractedSearch(t *testing.T) {
+	profiles := []*models.Profile{
+		{Name: "shortest", Metric: models.METRIC_DISTANCE},
+		{Name: "quickest", Metric: models.METRIC_DURATION},
+		{Name: "weighted", Metric: models.METRIC_DURATION, RoadClassification: map[string]float64{"Unclassified": 1.5}},
+	}
+
+	for _, profile := range profiles {
+		t.Run(profile.Name, func(t *testing.T) {
+			g := randomNetwork(t, 42, 150, 250)
+			h, err := g.Contract(profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			weights, err := g.edgeWeights(profile, models.PathOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nodes := make([]uint32, len(g.nodeIDs))
+			for n := range nodes {
+				nodes[n] = uint32(n)
+			}
+			costs, lengths, durations, err := g.hierarchyMatrix(context.Background(), h, nodes, nodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, source := range nodes {
+				state := g.oneToMany(source, nodes, weights)
+				for _, target := range nodes {
+					expected := state.distance(target)
+					if !closeTo(costs[source][target], expected) {
+						t.Fatalf("matrix %d -> %d costs %v, expected %v", source, target, costs[source][target], expected)
+					}
+
+					path, start, cost := g.hierarchyPath(h, []seed{{node: source}}, []seed{{node: target}})
+					if !closeTo(cost, expected) {
+						t.Fatalf("path %d -> %d costs %v, expected %v", source, target, cost, expected)
+					}
+					if math.IsInf(expected, 1) {
+						continue
+					}
+
+					// The unpacked path must be a walk along real links with
+					// the same cost as the matrix entry
+					n, total := start, 0.0
+					for _, l := range path {
+						if g.linkSource[l] != n && g.linkTarget[l] != n {
+							t.Fatalf("path %d -> %d: link %d does not touch node %d", source, target, l, n)
+						}
+						n = g.otherEnd(l, n)
+						total += weights.of(l)
+					}
+					if start != source || n != target {
+						t.Fatalf("path %d -> %d runs from %d to %d", source, target, start, n)
+					}
+					if !closeTo(total, expected) {
+						t.Fatalf("path %d -> %d weighs %v, expected %v", source, target, total, expected)
+					}
+
+					// Unweighted, the cost is the length or duration itself
+					if profile.Name == "shortest" && !closeTo(lengths[source][target], expected) {
+						t.Fatalf("matrix %d -> %d is %vm long, expected %vm", source, target, lengths[source][target], expected)
+					}
+					if profile.Name == "quickest" && !closeTo(durations[source][target], expected) {
+						t.Fatalf("matrix %d -> %d takes %vs, expected %vs", source, target, durations[source][target], expected)
+					}
+				}
+				g.releaseState(state)
+			}
+		})
+	}
+}
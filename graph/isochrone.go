@@ -0,0 +1,361 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+// Number of cells across the wider side of the grid that isochrone hulls
+// are traced on
+const ISOCHRONE_HULL_CELLS = 64
+
+// Most cells across the wider side of the grid that buffered isochrones are
+// traced on
+const ISOCHRONE_BUFFER_CELLS = 1024
+
+// Isochrones finds every node reachable from the origin within the largest
+// budget with one bounded Dijkstra search. For each budget, largest first,
+// the links with both ends reached within it are drawn onto a grid whose
+// outline gives the polygon: for "hull", a coarse grid with any holes
+// filled, and for "buffer", the cells within ISOCHRONE_BUFFER_M of the
+// links. The search is bounded by cost alone, so radiusM is not used.
+func (g *Graph) Isochrones(ctx context.Context, origin *models.SnappedNode, budgets []float64, radiusM float64, shape string, profile *models.Profile) ([]models.Isochrone, error) {
+	if shape != "hull" && shape != "buffer" {
+		return nil, fmt.Errorf("unknown isochrone shape '%s'", shape)
+	}
+	source, err := g.nodeOf(origin)
+	if err != nil {
+		return nil, err
+	}
+	weights, err := g.edgeWeights(profile, models.PathOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := append([]float64{}, budgets...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+	if len(sorted) == 0 {
+		return []models.Isochrone{}, nil
+	}
+
+	nodes, costs := g.within(source, sorted[0], weights)
+	cost := make(map[uint32]float64, len(nodes))
+	for i, n := range nodes {
+		cost[n] = costs[i]
+	}
+
+	isochrones := make([]models.Isochrone, 0, len(sorted))
+	for _, budget := range sorted {
+		// Nodes are settled in order of cost, so those within the budget
+		// come first
+		reached := sort.SearchFloat64s(costs, math.Nextafter(budget, math.Inf(1)))
+		links := make([]uint32, 0)
+		for _, n := range nodes[:reached] {
+			for adj := g.firstAdj[n]; adj < g.firstAdj[n+1]; adj++ {
+				l := g.adjLink[adj]
+				if g.linkSource[l] != n || math.IsInf(weights.of(l), 1) {
+					continue
+				}
+				if c, ok := cost[g.linkTarget[l]]; ok && c <= budget {
+					links = append(links, l)
+				}
+			}
+		}
+		// A loop appears twice in its node's adjacency
+		slices.Sort(links)
+		links = slices.Compact(links)
+
+		var polygons []models.Polygon
+		isochrone := models.Isochrone{Budget: budget}
+		if shape == "hull" {
+			polygons = g.hullOutline(nodes[:reached], links)
+			isochrone.Reached = reached
+		} else {
+			if len(links) == 0 {
+				continue
+			}
+			polygons = g.bufferOutline(links)
+			isochrone.Reached = len(links)
+		}
+
+		if len(polygons) == 1 {
+			isochrone.Geometry = models.GeoJSONGeometry{Type: "Polygon", Coordinates: polygons[0]}
+		} else {
+			isochrone.Geometry = models.GeoJSONGeometry{Type: "MultiPolygon", Coordinates: polygons}
+		}
+		isochrones = append(isochrones, isochrone)
+	}
+	return isochrones, nil
+}
+
+// hullOutline draws the links and nodes onto a grid of ISOCHRONE_HULL_CELLS
+// across, fills any holes and returns the outline.
+func (g *Graph) hullOutline(nodes []uint32, links []uint32) []models.Polygon {
+	coords := make([]models.Coordinate, len(nodes))
+	for i, n := range nodes {
+		coords[i] = g.nodeLocation(n)
+	}
+	grid := newOutlineGrid(models.BoundsOf(coords, 0), ISOCHRONE_HULL_CELLS, 0)
+	for _, coord := range coords {
+		grid.drawSegment(coord, coord, 0)
+	}
+	for _, l := range links {
+		g.drawLink(grid, l, 0)
+	}
+	grid.fillHoles()
+	return grid.outline()
+}
+
+// bufferOutline draws the cells within ISOCHRONE_BUFFER_M of the links onto
+// a grid of up to ISOCHRONE_BUFFER_CELLS across and returns the outline.
+func (g *Graph) bufferOutline(links []uint32) []models.Polygon {
+	coords := make([]models.Coordinate, 0, 2*len(links))
+	for _, l := range links {
+		coords = append(coords, g.nodeLocation(g.linkSource[l]), g.nodeLocation(g.linkTarget[l]))
+		for _, pos := range g.centerLine(l) {
+			coords = append(coords, models.Coordinate{Lat: pos[1], Lon: pos[0]})
+		}
+	}
+	grid := newOutlineGrid(models.BoundsOf(coords, 0), ISOCHRONE_BUFFER_CELLS, repository.ISOCHRONE_BUFFER_M)
+	for _, l := range links {
+		g.drawLink(grid, l, repository.ISOCHRONE_BUFFER_M)
+	}
+	return grid.outline()
+}
+
+// drawLink fills the cells within reachM metres of link l's centre line, or
+// of the straight line between its nodes if it has no geometry.
+func (g *Graph) drawLink(grid *outlineGrid, l uint32, reachM float64) {
+	line := g.centerLine(l)
+	if len(line) < 2 {
+		grid.drawSegment(g.nodeLocation(g.linkSource[l]), g.nodeLocation(g.linkTarget[l]), reachM)
+		return
+	}
+	for i := 1; i < len(line); i++ {
+		a := models.Coordinate{Lat: line[i-1][1], Lon: line[i-1][0]}
+		b := models.Coordinate{Lat: line[i][1], Lon: line[i][0]}
+		grid.drawSegment(a, b, reachM)
+	}
+}
+
+// outlineGrid is a raster of square cells over a local equirectangular
+// plane, onto which reached links are drawn so that the outline of the
+// filled cells can be traced as isochrone polygons. Plane coordinates are in
+// metres east and north of the grid's south-west corner.
+type outlineGrid struct {
+	minLat, minLon float64
+	// Metres per degree of longitude across the grid
+	lonScale   float64
+	cellM      float64
+	cols, rows int
+	filled     []bool
+}
+
+// newOutlineGrid covers the bounding box plus marginM metres on each side
+// with cells no smaller than half ISOCHRONE_BUFFER_M, at most maxCells
+// across the wider side of the box.
+func newOutlineGrid(bbox models.BoundingBox, maxCells int, marginM float64) *outlineGrid {
+	lonScale := repository.METRES_PER_DEGREE * math.Max(math.Cos((bbox.MinLat+bbox.MaxLat)/2*math.Pi/180), 0.01)
+	width := (bbox.MaxLon - bbox.MinLon) * lonScale
+	height := (bbox.MaxLat - bbox.MinLat) * repository.METRES_PER_DEGREE
+	cellM := math.Max(math.Max(width, height)/float64(maxCells), repository.ISOCHRONE_BUFFER_M/2)
+
+	// Leave a border of at least one empty cell, so every filled region has
+	// an outline inside the grid
+	marginM += cellM
+	grid := &outlineGrid{
+		minLat:   bbox.MinLat - marginM/repository.METRES_PER_DEGREE,
+		minLon:   bbox.MinLon - marginM/lonScale,
+		lonScale: lonScale,
+		cellM:    cellM,
+		cols:     int(math.Ceil((width+2*marginM)/cellM)) + 1,
+		rows:     int(math.Ceil((height+2*marginM)/cellM)) + 1,
+	}
+	grid.filled = make([]bool, grid.cols*grid.rows)
+	return grid
+}
+
+func (grid *outlineGrid) xy(coord models.Coordinate) (float64, float64) {
+	return (coord.Lon - grid.minLon) * grid.lonScale, (coord.Lat - grid.minLat) * repository.METRES_PER_DEGREE
+}
+
+// position returns the [lon, lat] position of a point given in cells from
+// the grid's south-west corner.
+func (grid *outlineGrid) position(x, y float64) [2]float64 {
+	return [2]float64{grid.minLon + x*grid.cellM/grid.lonScale, grid.minLat + y*grid.cellM/repository.METRES_PER_DEGREE}
+}
+
+func (grid *outlineGrid) isFilled(c, r int) bool {
+	return c >= 0 && r >= 0 && c < grid.cols && r < grid.rows && grid.filled[r*grid.cols+c]
+}
+
+// drawSegment fills every cell whose centre is within reachM metres of the
+// segment between a and b. Cells are also filled within three quarters of a
+// cell of the segment, so that a line crossing the grid diagonally is drawn
+// as edge-connected cells.
+func (grid *outlineGrid) drawSegment(a, b models.Coordinate, reachM float64) {
+	ax, ay := grid.xy(a)
+	bx, by := grid.xy(b)
+	reachM = math.Max(reachM, 0.75*grid.cellM)
+
+	c0 := max(0, int(math.Floor((math.Min(ax, bx)-reachM)/grid.cellM)))
+	c1 := min(grid.cols-1, int(math.Floor((math.Max(ax, bx)+reachM)/grid.cellM)))
+	r0 := max(0, int(math.Floor((math.Min(ay, by)-reachM)/grid.cellM)))
+	r1 := min(grid.rows-1, int(math.Floor((math.Max(ay, by)+reachM)/grid.cellM)))
+
+	dx, dy := bx-ax, by-ay
+	lengthSq := dx*dx + dy*dy
+	for r := r0; r <= r1; r++ {
+		for c := c0; c <= c1; c++ {
+			px, py := (float64(c)+0.5)*grid.cellM-ax, (float64(r)+0.5)*grid.cellM-ay
+			t := 0.0
+			if lengthSq > 0 {
+				t = math.Max(0, math.Min(1, (px*dx+py*dy)/lengthSq))
+			}
+			if ex, ey := px-t*dx, py-t*dy; ex*ex+ey*ey <= reachM*reachM {
+				grid.filled[r*grid.cols+c] = true
+			}
+		}
+	}
+}
+
+// fillHoles fills every empty cell that cannot be reached from the edge of
+// the grid without crossing a filled cell.
+func (grid *outlineGrid) fillHoles() {
+	outside := make([]bool, len(grid.filled))
+	queue := make([]int, 0)
+	visit := func(c, r int) {
+		if c < 0 || r < 0 || c >= grid.cols || r >= grid.rows {
+			return
+		}
+		if i := r*grid.cols + c; !grid.filled[i] && !outside[i] {
+			outside[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for c := range grid.cols {
+		visit(c, 0)
+		visit(c, grid.rows-1)
+	}
+	for r := range grid.rows {
+		visit(0, r)
+		visit(grid.cols-1, r)
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		c, r := i%grid.cols, i/grid.cols
+		visit(c-1, r)
+		visit(c+1, r)
+		visit(c, r-1)
+		visit(c, r+1)
+	}
+	for i := range grid.filled {
+		grid.filled[i] = !outside[i]
+	}
+}
+
+// Unit steps east, north, west and south, in that (anticlockwise) order
+var outlineSteps = [4][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+
+// outline traces the boundary of the filled cells into polygons, each an
+// anticlockwise outer ring followed by any clockwise holes, in [lon, lat]
+// positions.
+func (grid *outlineGrid) outline() []models.Polygon {
+	// Each cell side between a filled and an empty cell is an edge, directed
+	// to keep the filled cell on its left, from the grid corner it starts at
+	corner := func(c, r int) int { return r*(grid.cols+1) + c }
+	edges := make(map[int][]int)
+	starts := make([]int, 0)
+	for r := range grid.rows {
+		for c := range grid.cols {
+			if !grid.isFilled(c, r) {
+				continue
+			}
+			if !grid.isFilled(c, r-1) {
+				edges[corner(c, r)] = append(edges[corner(c, r)], 0)
+				starts = append(starts, corner(c, r))
+			}
+			if !grid.isFilled(c+1, r) {
+				edges[corner(c+1, r)] = append(edges[corner(c+1, r)], 1)
+			}
+			if !grid.isFilled(c, r+1) {
+				edges[corner(c+1, r+1)] = append(edges[corner(c+1, r+1)], 2)
+			}
+			if !grid.isFilled(c-1, r) {
+				edges[corner(c, r+1)] = append(edges[corner(c, r+1)], 3)
+			}
+		}
+	}
+
+	// Every ring has an edge running east along the bottom of a cell, so
+	// each is traced from the first such unused edge. Where two filled cells
+	// meet only at a corner, the trace turns left to keep them apart.
+	type ring struct {
+		positions [][2]float64
+		area      float64
+		// Centre of a cell just outside the ring, used to place holes
+		outside [2]float64
+	}
+	used := make(map[[2]int]bool)
+	rings := make([]ring, 0)
+	for _, start := range starts {
+		if used[[2]int{start, 0}] {
+			continue
+		}
+		c, r := start%(grid.cols+1), start/(grid.cols+1)
+		current := ring{outside: grid.position(float64(c)+0.5, float64(r)-0.5)}
+		k, dir, previous := start, 0, -1
+		for {
+			used[[2]int{k, dir}] = true
+			if dir != previous {
+				current.positions = append(current.positions, grid.position(float64(c), float64(r)))
+			}
+			previous = dir
+			nc, nr := c+outlineSteps[dir][0], r+outlineSteps[dir][1]
+			current.area += float64(c*nr - nc*r)
+			c, r, k = nc, nr, corner(nc, nr)
+
+			next := edges[k][0]
+			if len(edges[k]) > 1 {
+				next = (dir + 1) % 4
+			}
+			if k == start && next == 0 {
+				break
+			}
+			dir = next
+		}
+		current.positions = append(current.positions, current.positions[0])
+		rings = append(rings, current)
+	}
+
+	polygons := make([]models.Polygon, 0)
+	areas := make([]float64, 0)
+	for _, ring := range rings {
+		if ring.area > 0 {
+			polygons = append(polygons, models.Polygon{ring.positions})
+			areas = append(areas, ring.area)
+		}
+	}
+	for _, hole := range rings {
+		if hole.area > 0 {
+			continue
+		}
+		best := -1
+		for i, polygon := range polygons {
+			if polygon[:1].Contains(hole.outside) && (best < 0 || areas[i] < areas[best]) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			polygons[best] = append(polygons[best], hole.positions)
+		}
+	}
+	return polygons
+}
@@ -0,0 +1,175 @@
+package graph
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+// cellGrid fills an outline grid of one degree cells from rows of '#' (filled)
+// and '.' (empty), the first row being the northernmost.
+func cellGrid(rows ...string) *outlineGrid {
+	grid := &outlineGrid{
+		lonScale: repository.METRES_PER_DEGREE,
+		cellM:    repository.METRES_PER_DEGREE,
+		cols:     len(rows[0]),
+		rows:     len(rows),
+	}
+	grid.filled = make([]bool, grid.cols*grid.rows)
+	for i, row := range rows {
+		for c, cell := range row {
+			grid.filled[(len(rows)-1-i)*grid.cols+c] = cell == '#'
+		}
+	}
+	return grid
+}
+
+// ringArea is the signed area of a closed ring, positive if anticlockwise.
+func ringArea(ring [][2]float64) float64 {
+	area := 0.0
+	for i := 1; i < len(ring); i++ {
+		area += ring[i-1][0]*ring[i][1] - ring[i][0]*ring[i-1][1]
+	}
+	return area / 2
+}
+
+func TestOutline(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  []string
+		fill  bool
+		holes []int
+		cells float64
+	}{
+		{name: "single cell", rows: []string{"...", ".#.", "..."}, holes: []int{0}, cells: 1},
+		{name: "L shape", rows: []string{"....", ".#..", ".##.", "...."}, holes: []int{0}, cells: 3},
+		{name: "ring", rows: []string{".....", ".###.", ".#.#.", ".###.", "....."}, holes: []int{1}, cells: 8},
+		{name: "ring filled", rows: []string{".....", ".###.", ".#.#.", ".###.", "....."}, fill: true, holes: []int{0}, cells: 9},
+		{name: "touching corners", rows: []string{"....", ".#..", "..#.", "...."}, holes: []int{0, 0}, cells: 2},
+		{name: "island in a ring", rows: []string{".......", ".#####.", ".#...#.", ".#.#.#.", ".#...#.", ".#####.", "......."}, holes: []int{1, 0}, cells: 17},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid := cellGrid(test.rows...)
+			if test.fill {
+				grid.fillHoles()
+			}
+			polygons := grid.outline()
+			if len(polygons) != len(test.holes) {
+				t.Fatalf("got %d polygons, expected %d: %v", len(polygons), len(test.holes), polygons)
+			}
+
+			cells := 0.0
+			for i, polygon := range polygons {
+				if holes := len(polygon) - 1; holes != test.holes[i] {
+					t.Fatalf("polygon %d has %d holes, expected %d: %v", i, holes, test.holes[i], polygon)
+				}
+				for j, ring := range polygon {
+					if ring[0] != ring[len(ring)-1] {
+						t.Fatalf("ring %v is not closed", ring)
+					}
+					if area := ringArea(ring); (j == 0) != (area > 0) {
+						t.Fatalf("ring %d of polygon %d has area %v, so runs the wrong way", j, i, area)
+					}
+					cells += ringArea(ring)
+				}
+			}
+			if cells != test.cells {
+				t.Fatalf("outline covers %v cells, expected %v", cells, test.cells)
+			}
+		})
+	}
+
+	// Corners are only kept where the outline turns
+	if ring := cellGrid("....", ".##.", ".##.", "....").outline()[0][0]; len(ring) != 5 {
+		t.Fatalf("expected a square of 4 corners, got %v", ring)
+	}
+}
+
+// polygonsOf returns the polygons of a Polygon or MultiPolygon geometry.
+func polygonsOf(t *testing.T, geometry models.GeoJSONGeometry) []models.Polygon {
+	t.Helper()
+	switch coordinates := geometry.Coordinates.(type) {
+	case models.Polygon:
+		return []models.Polygon{coordinates}
+	case []models.Polygon:
+		return coordinates
+	}
+	t.Fatalf("unexpected %s geometry %v", geometry.Type, geometry.Coordinates)
+	return nil
+}
+
+func covers(polygons []models.Polygon, coord models.Coordinate) bool {
+	for _, polygon := range polygons {
+		if polygon.Contains([2]float64{coord.Lon, coord.Lat}) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIsochrones(t *testing.T) {
+	g := gridNetwork(t, 11)
+	profile := &models.Profile{Name: "shortest", Metric: models.METRIC_DISTANCE}
+	origin, err := g.NearestNode(context.Background(), gridCorner(5, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Within 700m, the nodes up to three blocks away (by street) are reached,
+	// along with the 36 links between them; within 300m, those up to one
+	// block away and the 4 links between them
+	tests := []struct {
+		shape   string
+		reached []int
+	}{
+		{shape: "hull", reached: []int{25, 5}},
+		{shape: "buffer", reached: []int{36, 4}},
+	}
+	for _, test := range tests {
+		t.Run(test.shape, func(t *testing.T) {
+			isochrones, err := g.Isochrones(context.Background(), origin, []float64{300, 700}, 0, test.shape, profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(isochrones) != 2 || isochrones[0].Budget != 700 || isochrones[1].Budget != 300 {
+				t.Fatalf("expected isochrones for 700 and then 300m, got %+v", isochrones)
+			}
+
+			for i, isochrone := range isochrones {
+				if isochrone.Reached != test.reached[i] {
+					t.Errorf("%.0fm reached %d, expected %d", isochrone.Budget, isochrone.Reached, test.reached[i])
+				}
+				if isochrone.Geometry.Type != "Polygon" {
+					t.Errorf("%.0fm gave a %s, expected a single Polygon", isochrone.Budget, isochrone.Geometry.Type)
+				}
+
+				polygons := polygonsOf(t, isochrone.Geometry)
+				blocks := int(isochrone.Budget / testGridSpacingM)
+				for r := range 11 {
+					for c := range 11 {
+						distance := int(math.Abs(float64(r-5)) + math.Abs(float64(c-5)))
+						if inside := covers(polygons, gridCorner(float64(r), float64(c))); inside != (distance <= blocks) {
+							t.Fatalf("%.0fm: node %d blocks away at %d, %d is inside: %v", isochrone.Budget, distance, r, c, inside)
+						}
+					}
+				}
+			}
+
+			// Buffers leave out the middle of the blocks inside the area, but
+			// hulls fill them
+			inside := covers(polygonsOf(t, isochrones[0].Geometry), gridCorner(5.5, 5.5))
+			if inside != (test.shape == "hull") {
+				t.Fatalf("the middle of a reached block is inside: %v", inside)
+			}
+		})
+	}
+
+	if _, err := g.Isochrones(context.Background(), origin, []float64{300}, 0, "star", profile); err == nil || !strings.Contains(err.Error(), "unknown isochrone shape") {
+		t.Fatalf("expected an unknown shape error, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+// Load reads the whole road network from the database and builds a graph
+// from it.
+func Load(ctx context.Context, repo repository.NetworkRepository) (*Graph, error) {
+	start := time.Now()
+
+	g, err := load(ctx, repo, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Loaded routing graph with %d nodes and %d links in %s", g.NodeCount(), g.LinkCount(), time.Since(start).Round(time.Millisecond))
+	return g, nil
+}
+
+// LoadRegion builds a graph of just the road links passing through the
+// region, and the nodes at either end of them.
+func LoadRegion(ctx context.Context, repo repository.NetworkRepository, region models.BoundingBox) (*Graph, error) {
+	return load(ctx, repo, &region)
+}
+
+func load(ctx context.Context, repo repository.NetworkRepository, region *models.BoundingBox) (*Graph, error) {
+	refData, err := repo.FetchRefData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := NewBuilder(refData)
+	if err := repo.StreamNodes(ctx, region, builder.AddNode); err != nil {
+		return nil, fmt.Errorf("failed to load road nodes: %w", err)
+	}
+	if err := repo.StreamLinks(ctx, region, builder.AddLink); err != nil {
+		return nil, fmt.Errorf("failed to load road links: %w", err)
+	}
+	return builder.Build(), nil
+}
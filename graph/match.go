@@ -0,0 +1,361 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+// Standard deviation (in metres) of GPS measurement error
+const MATCH_GPS_SIGMA_M = 10.0
+
+// Scale (in metres) of the exponential distribution of the difference
+// between the route distance and the great-circle distance between
+// consecutive trace points
+const MATCH_BETA_M = 5.0
+
+// Radius (in metres) searched for candidate links around each trace point
+const MATCH_RADIUS_M = 50.0
+
+// Maximum number of candidate links considered for each trace point
+const MATCH_MAX_CANDIDATES = 8
+
+// Transitions whose route distance is more than this multiple of the
+// great-circle distance between the trace points (plus the margin below) are
+// treated as impossible
+const MATCH_DETOUR_FACTOR = 3.0
+
+// Allowance (in metres) on top of the detour factor, for points recorded
+// close together
+const MATCH_DETOUR_MARGIN_M = 250.0
+
+// Margin (in metres) around a trace of the region loaded to match it against
+const MATCH_REGION_MARGIN_M = 1000.0
+
+// A link that a trace point may have been recorded on
+type matchCandidate struct {
+	link uint32
+	projection
+	// Log probability of the point being observed from this candidate
+	emission float64
+}
+
+// MatchTrace finds the most probable sequence of links travelled along a
+// GPS trace with a hidden Markov model (after Newson & Krumm, 2009). Each
+// point's hidden state is one of the nearby links it may have been recorded
+// on: emission probabilities fall off with the distance from the point to
+// the link, and transition probabilities with the difference between the
+// route distance and the great-circle distance between consecutive points.
+// The Viterbi algorithm picks the most probable candidates, and the
+// forward-backward algorithm gives the posterior probability of each. Where
+// no candidate of a point can be reached from the previous point, the match
+// is broken and restarted there.
+func (g *Graph) MatchTrace(ctx context.Context, trace []models.Coordinate) (*models.MatchResult, error) {
+	candidates := make([][]matchCandidate, len(trace))
+	for t, coord := range trace {
+		candidates[t] = g.matchCandidates(coord)
+	}
+
+	// transitions[t][i][j] is the log probability of moving from candidate i
+	// of point t to candidate j of point t+1
+	transitions := make([][][]float64, max(len(trace)-1, 0))
+	err := parallel(ctx, len(transitions), func(t int) {
+		transitions[t] = g.matchTransitions(trace[t], trace[t+1], candidates[t], candidates[t+1])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.MatchResult{Links: make([]string, 0), Points: make([]models.MatchedPoint, len(trace))}
+	for t, coord := range trace {
+		result.Points[t].Location = coord
+	}
+
+	lines := make([]models.LineString, 0)
+	matched := 0
+	for start := 0; start < len(trace); {
+		if len(candidates[start]) == 0 {
+			start++
+			continue
+		}
+
+		chosen, posteriors := viterbi(candidates[start:], transitions[start:])
+		for i, c := range chosen {
+			candidate := candidates[start+i][c]
+			result.Points[start+i].Link = g.snappedLink(candidate.link, candidate.projection)
+			result.Points[start+i].Confidence = posteriors[i]
+			result.Confidence += posteriors[i]
+			matched++
+		}
+
+		path := make([]models.PathSegment, 0)
+		for i := 1; i < len(chosen); i++ {
+			from, to := candidates[start+i-1][chosen[i-1]], candidates[start+i][chosen[i]]
+			segments, _ := g.pointPath(from.link, from.fraction, to.link, to.fraction, edgeWeights{weights: g.lengthM}, nil)
+			for _, segment := range segments {
+				path = g.joinSegment(path, segment)
+			}
+		}
+
+		line := make(models.LineString, 0)
+		for _, segment := range path {
+			if n := len(result.Links); n == 0 || result.Links[n-1] != segment.GmlID {
+				result.Links = append(result.Links, segment.GmlID)
+			}
+			result.DistanceM += segment.LengthM
+			line = appendLine(line, g.segmentLine(segment))
+		}
+		if len(line) > 1 {
+			lines = append(lines, line)
+		}
+		start += len(chosen)
+	}
+
+	if matched == 0 {
+		return nil, fmt.Errorf("%w within %.0fm of any point of the trace", repository.ErrNoLinkFound, MATCH_RADIUS_M)
+	}
+	result.Confidence /= float64(matched)
+
+	switch len(lines) {
+	case 0:
+	case 1:
+		geometry := lines[0].AsGeoJSON()
+		result.Geometry = &geometry
+	default:
+		result.Geometry = &models.GeoJSONGeometry{Type: "MultiLineString", Coordinates: lines}
+	}
+	return result, nil
+}
+
+// matchCandidates finds the closest links within MATCH_RADIUS_M of the
+// point.
+func (g *Graph) matchCandidates(coord models.Coordinate) []matchCandidate {
+	seen := make(map[uint32]bool)
+	candidates := make([]matchCandidate, 0)
+	g.linkGrid.within(coord, MATCH_RADIUS_M, func(l uint32) {
+		if seen[l] {
+			return
+		}
+		seen[l] = true
+
+		p := g.project(l, coord)
+		if p.distanceM <= MATCH_RADIUS_M {
+			emission := -0.5 * (p.distanceM / MATCH_GPS_SIGMA_M) * (p.distanceM / MATCH_GPS_SIGMA_M)
+			candidates = append(candidates, matchCandidate{link: l, projection: p, emission: emission})
+		}
+	})
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].distanceM < candidates[j].distanceM })
+	return candidates[:min(len(candidates), MATCH_MAX_CANDIDATES)]
+}
+
+// matchTransitions computes the log transition probabilities between the
+// candidates of two consecutive points, with one bounded Dijkstra search
+// (over link lengths) from each candidate of the first.
+func (g *Graph) matchTransitions(from, to models.Coordinate, fromCandidates, toCandidates []matchCandidate) [][]float64 {
+	weights := edgeWeights{weights: g.lengthM}
+	straight := from.DistanceTo(to)
+	limit := straight*MATCH_DETOUR_FACTOR + MATCH_DETOUR_MARGIN_M
+
+	transitions := make([][]float64, len(fromCandidates))
+	for i, a := range fromCandidates {
+		state := g.acquireState()
+		length := float64(g.lengthM[a.link])
+		for _, s := range []seed{
+			{node: g.linkSource[a.link], cost: a.fraction * length},
+			{node: g.linkTarget[a.link], cost: (1 - a.fraction) * length},
+		} {
+			if s.cost < state.distance(s.node) {
+				state.label(s.node, s.cost, -1)
+			}
+		}
+		for len(state.heap) > 0 && state.heap.peek() <= limit {
+			g.settle(state, weights)
+		}
+
+		transitions[i] = make([]float64, len(toCandidates))
+		for j, b := range toCandidates {
+			length := float64(g.lengthM[b.link])
+			distance := math.Min(
+				state.distance(g.linkSource[b.link])+b.fraction*length,
+				state.distance(g.linkTarget[b.link])+(1-b.fraction)*length)
+			if a.link == b.link {
+				distance = math.Min(distance, math.Abs(b.fraction-a.fraction)*length)
+			}
+
+			transitions[i][j] = math.Inf(-1)
+			if distance <= limit {
+				transitions[i][j] = -math.Abs(distance-straight) / MATCH_BETA_M
+			}
+		}
+		g.releaseState(state)
+	}
+	return transitions
+}
+
+// viterbi finds the most probable sequence of candidates from the first
+// point onwards, stopping before the first point that cannot be reached
+// (or has no candidates). It returns the index of the chosen candidate of
+// each point matched, and its posterior probability.
+func viterbi(candidates [][]matchCandidate, transitions [][][]float64) ([]int, []float64) {
+	// Log probabilities of the most probable sequence ending at each
+	// candidate (delta), the candidate it came from (back), and of all
+	// sequences ending at each candidate (alpha)
+	delta := [][]float64{make([]float64, len(candidates[0]))}
+	alpha := [][]float64{make([]float64, len(candidates[0]))}
+	back := [][]int{nil}
+	for i, c := range candidates[0] {
+		delta[0][i], alpha[0][i] = c.emission, c.emission
+	}
+
+	for t := 1; t < len(candidates) && len(candidates[t]) > 0; t++ {
+		d, a, b := make([]float64, len(candidates[t])), make([]float64, len(candidates[t])), make([]int, len(candidates[t]))
+		reachable := false
+		for j, c := range candidates[t] {
+			d[j], a[j] = math.Inf(-1), math.Inf(-1)
+			terms := make([]float64, len(candidates[t-1]))
+			for i := range candidates[t-1] {
+				if p := delta[t-1][i] + transitions[t-1][i][j]; p > d[j] {
+					d[j], b[j] = p, i
+				}
+				terms[i] = alpha[t-1][i] + transitions[t-1][i][j]
+			}
+			if !math.IsInf(d[j], -1) {
+				d[j] += c.emission
+				a[j] = logSumExp(terms) + c.emission
+				reachable = true
+			}
+		}
+		if !reachable {
+			break
+		}
+		delta, alpha, back = append(delta, d), append(alpha, a), append(back, b)
+	}
+
+	n := len(delta)
+	chosen := make([]int, n)
+	for i, p := range delta[n-1] {
+		if p > delta[n-1][chosen[n-1]] {
+			chosen[n-1] = i
+		}
+	}
+	for t := n - 1; t > 0; t-- {
+		chosen[t-1] = back[t][chosen[t]]
+	}
+
+	// Backward pass, for the posterior probability of each chosen candidate
+	beta := make([][]float64, n)
+	beta[n-1] = make([]float64, len(candidates[n-1]))
+	for t := n - 2; t >= 0; t-- {
+		beta[t] = make([]float64, len(candidates[t]))
+		for i := range candidates[t] {
+			terms := make([]float64, len(candidates[t+1]))
+			for j, c := range candidates[t+1] {
+				terms[j] = transitions[t][i][j] + c.emission + beta[t+1][j]
+			}
+			beta[t][i] = logSumExp(terms)
+		}
+	}
+
+	total := logSumExp(alpha[n-1])
+	posteriors := make([]float64, n)
+	for t, c := range chosen {
+		posteriors[t] = math.Exp(alpha[t][c] + beta[t][c] - total)
+	}
+	return chosen, posteriors
+}
+
+func logSumExp(values []float64) float64 {
+	maximum := math.Inf(-1)
+	for _, v := range values {
+		maximum = math.Max(maximum, v)
+	}
+	if math.IsInf(maximum, -1) {
+		return maximum
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += math.Exp(v - maximum)
+	}
+	return maximum + math.Log(sum)
+}
+
+// joinSegment appends next to a matched path. Consecutive segments on the
+// same link are merged into one, so that a point recorded a little way down
+// a side road (through GPS error) does not leave an out-and-back excursion
+// in the path.
+func (g *Graph) joinSegment(path []models.PathSegment, next models.PathSegment) []models.PathSegment {
+	n := len(path)
+	if n == 0 || path[n-1].LinkID != next.LinkID {
+		return append(path, next)
+	}
+
+	l := g.linkIndex[next.LinkID]
+	from, _ := segmentFractions(path[n-1])
+	_, to := segmentFractions(next)
+	path = path[:n-1]
+	if math.Abs(to-from)*float64(g.lengthM[l]) < 0.01 {
+		return path
+	}
+	joined := g.partialSegments(l, from, to)
+	if math.Abs(to-from) == 1 {
+		joined[0].Portion = nil
+	}
+	return append(path, joined...)
+}
+
+// segmentFractions is where a path segment starts and ends along its link.
+func segmentFractions(segment models.PathSegment) (float64, float64) {
+	if segment.Portion != nil {
+		return segment.Portion.From, segment.Portion.To
+	}
+	if segment.Forward {
+		return 0, 1
+	}
+	return 1, 0
+}
+
+// segmentLine returns the part of a link's centre line traversed by a path
+// segment, in the direction of travel.
+func (g *Graph) segmentLine(segment models.PathSegment) models.LineString {
+	line := g.centerLine(g.linkIndex[segment.LinkID])
+	if portion := segment.Portion; portion != nil {
+		line = line.Slice(math.Min(portion.From, portion.To), math.Max(portion.From, portion.To))
+	}
+	if !segment.Forward {
+		line = line.Reversed()
+	}
+	return line
+}
+
+// appendLine joins next onto the end of line, without repeating the
+// position they share.
+func appendLine(line, next models.LineString) models.LineString {
+	if len(line) > 0 && len(next) > 0 && line[len(line)-1] == next[0] {
+		next = next[1:]
+	}
+	return append(line, next...)
+}
+
+// RegionMatcher matches traces against the road network in the database, by
+// loading just the region around each trace into a graph.
+type RegionMatcher struct {
+	repo repository.NetworkRepository
+}
+
+func NewRegionMatcher(repo repository.NetworkRepository) *RegionMatcher {
+	return &RegionMatcher{repo: repo}
+}
+
+func (m *RegionMatcher) MatchTrace(ctx context.Context, trace []models.Coordinate) (*models.MatchResult, error) {
+	g, err := LoadRegion(ctx, m.repo, models.BoundsOf(trace, MATCH_REGION_MARGIN_M))
+	if err != nil {
+		return nil, err
+	}
+	return g.MatchTrace(ctx, trace)
+}
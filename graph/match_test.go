@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+// Spacing (in metres) of the streets in the test grid
+const testGridSpacingM = 200.0
+
+// gridCorner is the position of the grid node at row r, column c, with
+// rows running north and columns east.
+func gridCorner(r, c float64) models.Coordinate {
+	lat := 51.5 + r*testGridSpacingM/111320
+	return models.Coordinate{Lat: lat, Lon: -0.1 + c*testGridSpacingM/(111320*math.Cos(lat*math.Pi/180))}
+}
+
+// gridNetwork builds a square grid of streets. The link east from the node
+// at row r, column c is "h-r-c", and the link north from it "v-r-c".
+func gridNetwork(t *testing.T, size int) *Graph {
+	t.Helper()
+	b := NewBuilder(&models.NetworkRefData{})
+	id := func(r, c int) int64 { return int64(r*size + c + 1) }
+	for r := range size {
+		for c := range size {
+			err := b.AddNode(models.NetworkNode{ID: id(r, c), GmlID: fmt.Sprintf("n-%d-%d", r, c), Location: gridCorner(float64(r), float64(c))})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	links := 0
+	addLink := func(gmlID string, r0, c0, r1, c1 int) {
+		from, to := gridCorner(float64(r0), float64(c0)), gridCorner(float64(r1), float64(c1))
+		links++
+		err := b.AddLink(models.NetworkLink{
+			ID:         int64(links),
+			GmlID:      gmlID,
+			SourceID:   id(r0, c0),
+			TargetID:   id(r1, c1),
+			LengthM:    from.DistanceTo(to),
+			CenterLine: models.LineString{{from.Lon, from.Lat}, {to.Lon, to.Lat}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for r := range size {
+		for c := range size {
+			if c+1 < size {
+				addLink(fmt.Sprintf("h-%d-%d", r, c), r, c, r, c+1)
+			}
+			if r+1 < size {
+				addLink(fmt.Sprintf("v-%d-%d", r, c), r, c, r+1, c)
+			}
+		}
+	}
+	return b.Build()
+}
+
+// noisyTrace samples points every stepM metres along the polyline through
+// the grid corners (and at its end), each displaced by GPS-like noise of the
+// given standard deviation.
+func noisyTrace(random *rand.Rand, corners [][2]float64, stepM, sigmaM float64) []models.Coordinate {
+	trace := make([]models.Coordinate, 0)
+	for i := 1; i < len(corners); i++ {
+		from, to := corners[i-1], corners[i]
+		length := math.Hypot(to[0]-from[0], to[1]-from[1]) * testGridSpacingM
+		for d := 0.0; d < length; d += stepM {
+			f := d / length
+			r := from[0] + f*(to[0]-from[0]) + random.NormFloat64()*sigmaM/testGridSpacingM
+			c := from[1] + f*(to[1]-from[1]) + random.NormFloat64()*sigmaM/testGridSpacingM
+			trace = append(trace, gridCorner(r, c))
+		}
+	}
+	end := corners[len(corners)-1]
+	return append(trace, gridCorner(end[0]+random.NormFloat64()*sigmaM/testGridSpacingM, end[1]+random.NormFloat64()*sigmaM/testGridSpacingM))
+}
+
+func TestMatchTraceFollowsNoisyPath(t *testing.T) {
+	g := gridNetwork(t, 5)
+
+	// East along the bottom row, then north up the fourth column, starting
+	// and ending part way along links
+	corners := [][2]float64{{0, 0.2}, {0, 3}, {3.6, 3}}
+	expected := []string{"h-0-0", "h-0-1", "h-0-2", "v-0-3", "v-1-3", "v-2-3", "v-3-3"}
+
+	for seed := range int64(10) {
+		trace := noisyTrace(rand.New(rand.NewSource(seed)), corners, 25, 5)
+		result, err := g.MatchTrace(context.Background(), trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(result.Links, expected) {
+			t.Fatalf("seed %d: matched links %v, expected %v", seed, result.Links, expected)
+		}
+		for i, point := range result.Points {
+			// Points recorded at the turn may snap just past it
+			if point.Link == nil || !slices.Contains(expected, point.Link.GmlID) && point.Link.Point.DistanceTo(gridCorner(0, 3)) > 10 {
+				t.Fatalf("seed %d: point %d matched to %+v, off the path", seed, i, point.Link)
+			}
+		}
+		if result.Geometry == nil || result.Geometry.Type != "LineString" {
+			t.Fatalf("seed %d: expected a LineString, got %+v", seed, result.Geometry)
+		}
+
+		// 2.8 links east and 3.6 north
+		if math.Abs(result.DistanceM-6.4*testGridSpacingM) > 25 {
+			t.Fatalf("seed %d: matched path is %.1fm long, expected about %.1fm", seed, result.DistanceM, 6.4*testGridSpacingM)
+		}
+	}
+}
+
+func TestMatchTraceSinglePoint(t *testing.T) {
+	g := gridNetwork(t, 3)
+
+	result, err := g.MatchTrace(context.Background(), []models.Coordinate{gridCorner(1.02, 0.5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Points) != 1 || result.Points[0].Link == nil || result.Points[0].Link.GmlID != "h-1-0" {
+		t.Fatalf("expected the point to match h-1-0, got %+v", result.Points)
+	}
+	if math.Abs(result.Points[0].Link.Fraction-0.5) > 0.01 {
+		t.Fatalf("expected the point half way along the link, got %v", result.Points[0].Link.Fraction)
+	}
+	if result.Confidence != 1 || len(result.Links) != 0 || result.Geometry != nil {
+		t.Fatalf("expected a certain match with no path, got %+v", result)
+	}
+}
+
+func TestMatchTraceAcrossGap(t *testing.T) {
+	g := gridNetwork(t, 4)
+
+	// Along the bottom row, with one point well away from any street
+	trace := noisyTrace(rand.New(rand.NewSource(1)), [][2]float64{{0, 0.2}, {0, 2.8}}, 25, 0)
+	gap := len(trace) / 2
+	trace[gap] = gridCorner(-2, 1.5)
+
+	result, err := g.MatchTrace(context.Background(), trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points[gap].Link != nil {
+		t.Fatalf("expected the point in the gap not to be matched, got %+v", result.Points[gap].Link)
+	}
+	for i, point := range result.Points {
+		if i != gap && point.Link == nil {
+			t.Fatalf("point %d was not matched", i)
+		}
+	}
+	if result.Geometry == nil || result.Geometry.Type != "MultiLineString" {
+		t.Fatalf("expected a MultiLineString either side of the gap, got %+v", result.Geometry)
+	}
+	if expected := []string{"h-0-0", "h-0-1", "h-0-2"}; !slices.Equal(result.Links, expected) {
+		t.Fatalf("matched links %v, expected %v", result.Links, expected)
+	}
+
+	_, err = g.MatchTrace(context.Background(), []models.Coordinate{gridCorner(-2, 1.5)})
+	if !errors.Is(err, repository.ErrNoLinkFound) {
+		t.Fatalf("expected no link to be found, got %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package graph
+
+import (
+	"math"
+)
+
+type heapItem struct {
+	node uint32
+	dist float64
+}
+
+// minHeap is a binary heap of nodes keyed on distance. Nodes are pushed
+// again rather than decreased, so stale entries must be skipped when popped.
+type minHeap []heapItem
+
+func (h *minHeap) push(node uint32, dist float64) {
+	*h = append(*h, heapItem{node: node, dist: dist})
+	items := *h
+	for i := len(items) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if items[parent].dist <= items[i].dist {
+			break
+		}
+		items[parent], items[i] = items[i], items[parent]
+		i = parent
+	}
+}
+
+func (h *minHeap) pop() heapItem {
+	items := *h
+	top := items[0]
+	last := len(items) - 1
+	items[0] = items[last]
+	items = items[:last]
+	for i := 0; ; {
+		smallest, left, right := i, 2*i+1, 2*i+2
+		if left < last && items[left].dist < items[smallest].dist {
+			smallest = left
+		}
+		if right < last && items[right].dist < items[smallest].dist {
+			smallest = right
+		}
+		if smallest == i {
+			break
+		}
+		items[smallest], items[i] = items[i], items[smallest]
+		i = smallest
+	}
+	*h = items
+	return top
+}
+
+func (h minHeap) peek() float64 {
+	if len(h) == 0 {
+		return math.Inf(1)
+	}
+	return h[0].dist
+}
+
+// searchState holds the per-node labels of a Dijkstra search. The arrays
+// span every node in the graph, so states are pooled and reused; labels are
+// only valid where stamp matches the current generation, which avoids
+// clearing the arrays between searches.
+type searchState struct {
+	dist       []float64
+	parentLink []int32
+	stamp      []uint32
+	gen        uint32
+	heap       minHeap
+}
+
+func (g *Graph) acquireState() *searchState {
+	if state, ok := g.states.Get().(*searchState); ok {
+		state.reset()
+		return state
+	}
+
+	nodes := len(g.nodeIDs)
+	return &searchState{
+		dist:       make([]float64, nodes),
+		parentLink: make([]int32, nodes),
+		stamp:      make([]uint32, nodes),
+		gen:        1,
+	}
+}
+
+func (g *Graph) releaseState(state *searchState) {
+	g.states.Put(state)
+}
+
+func (s *searchState) reset() {
+	s.gen++
+	if s.gen == 0 {
+		clear(s.stamp)
+		s.gen = 1
+	}
+	s.heap = s.heap[:0]
+}
+
+func (s *searchState) distance(n uint32) float64 {
+	if s.stamp[n] != s.gen {
+		return math.Inf(1)
+	}
+	return s.dist[n]
+}
+
+func (s *searchState) label(n uint32, dist float64, parentLink int32) {
+	s.stamp[n] = s.gen
+	s.dist[n] = dist
+	s.parentLink[n] = parentLink
+	s.heap.push(n, dist)
+}
+
+// edgeWeights resolves the cost of traversing a link, taking any penalties
+// and avoided links into account.
+type edgeWeights struct {
+	weights   []float32
+	penalties map[uint32]float64
+	avoided   map[uint32]bool
+}
+
+func (w edgeWeights) of(l uint32) float64 {
+	if w.avoided[l] {
+		return math.Inf(1)
+	}
+	weight := float64(w.weights[l])
+	if w.penalties != nil {
+		if penalty, ok := w.penalties[l]; ok {
+			weight *= penalty
+		}
+	}
+	return weight
+}
+
+// settle pops the closest node off the state's heap and relaxes its links.
+// It returns the node, or false if the popped entry was stale.
+func (g *Graph) settle(state *searchState, weights edgeWeights) (uint32, bool) {
+	item := state.heap.pop()
+	if item.dist > state.distance(item.node) {
+		return 0, false
+	}
+
+	for adj := g.firstAdj[item.node]; adj < g.firstAdj[item.node+1]; adj++ {
+		weight := weights.of(g.adjLink[adj])
+		if math.IsInf(weight, 1) {
+			continue
+		}
+		next := g.adjNode[adj]
+		if dist := item.dist + weight; dist < state.distance(next) {
+			state.label(next, dist, int32(g.adjLink[adj]))
+		}
+	}
+	return item.node, true
+}
+
+// A node that a search starts from, at an initial cost
+type seed struct {
+	node uint32
+	cost float64
+}
+
+// bidirectional runs Dijkstra's algorithm from both ends at once, always
+// advancing the search with the nearer frontier, and stops once the two
+// frontiers together are at least as far as the best meeting point found.
+// Each end may have several seeds, such as the two ends of the link a point
+// lies on. It returns the links of the path in travel order, the seed node
+// the path starts from and its cost, which is +Inf if the ends are not
+// connected.
+func (g *Graph) bidirectional(sources, targets []seed, weights edgeWeights) ([]uint32, uint32, float64) {
+	forward, backward := g.acquireState(), g.acquireState()
+	defer g.releaseState(forward)
+	defer g.releaseState(backward)
+
+	best, meet := math.Inf(1), uint32(0)
+	for _, s := range sources {
+		if s.cost < forward.distance(s.node) {
+			forward.label(s.node, s.cost, -1)
+		}
+	}
+	for _, t := range targets {
+		if t.cost < backward.distance(t.node) {
+			backward.label(t.node, t.cost, -1)
+		}
+		if dist := forward.distance(t.node) + backward.distance(t.node); dist < best {
+			best, meet = dist, t.node
+		}
+	}
+
+	for len(forward.heap) > 0 || len(backward.heap) > 0 {
+		if forward.heap.peek()+backward.heap.peek() >= best {
+			break
+		}
+
+		state, other := forward, backward
+		if backward.heap.peek() < forward.heap.peek() {
+			state, other = backward, forward
+		}
+
+		n, ok := g.settle(state, weights)
+		if !ok {
+			continue
+		}
+
+		// Check the settled node and its neighbours for a shorter meeting point
+		if dist := state.distance(n) + other.distance(n); dist < best {
+			best, meet = dist, n
+		}
+		for adj := g.firstAdj[n]; adj < g.firstAdj[n+1]; adj++ {
+			next := g.adjNode[adj]
+			if dist := state.distance(next) + other.distance(next); dist < best {
+				best, meet = dist, next
+			}
+		}
+	}
+
+	if math.IsInf(best, 1) {
+		return nil, 0, best
+	}
+
+	path := g.pathTo(forward, meet)
+	start := meet
+	for i := len(path) - 1; i >= 0; i-- {
+		start = g.otherEnd(path[i], start)
+	}
+	for n := meet; backward.parentLink[n] != -1; {
+		l := uint32(backward.parentLink[n])
+		path = append(path, l)
+		n = g.otherEnd(l, n)
+	}
+	return path, start, best
+}
+
+// pathTo walks the parent links back from n to the search's source, and
+// returns them in travel order.
+func (g *Graph) pathTo(state *searchState, n uint32) []uint32 {
+	path := make([]uint32, 0)
+	for state.parentLink[n] != -1 {
+		l := uint32(state.parentLink[n])
+		path = append(path, l)
+		n = g.otherEnd(l, n)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// oneToMany runs Dijkstra's algorithm from the source until every target
+// has been settled (or the reachable network is exhausted). The caller must
+// release the returned state.
+func (g *Graph) oneToMany(source uint32, targets []uint32, weights edgeWeights) *searchState {
+	state := g.acquireState()
+	state.label(source, 0, -1)
+
+	remaining := make(map[uint32]bool, len(targets))
+	for _, target := range targets {
+		remaining[target] = true
+	}
+	delete(remaining, source)
+
+	for len(state.heap) > 0 && len(remaining) > 0 {
+		if n, ok := g.settle(state, weights); ok {
+			delete(remaining, n)
+		}
+	}
+	return state
+}
+
+// within runs Dijkstra's algorithm from the source until every node whose
+// cost is at most limit has been settled, and returns those nodes in the
+// order settled along with their costs.
+func (g *Graph) within(source uint32, limit float64, weights edgeWeights) ([]uint32, []float64) {
+	state := g.acquireState()
+	defer g.releaseState(state)
+	state.label(source, 0, -1)
+
+	nodes, costs := make([]uint32, 0), make([]float64, 0)
+	for state.heap.peek() <= limit {
+		if n, ok := g.settle(state, weights); ok {
+			nodes = append(nodes, n)
+			costs = append(costs, state.distance(n))
+		}
+	}
+	return nodes, costs
+}
@@ -0,0 +1,189 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// buildNetwork builds a graph with the Builder from links given as
+// (source, target, length) between nodes numbered from 0, each link
+// numbered by its position.
+func buildNetwork(t *testing.T, nodes int, links [][3]int) *Graph {
+	t.Helper()
+	b := NewBuilder(&models.NetworkRefData{})
+	for n := range nodes {
+		err := b.AddNode(models.NetworkNode{ID: int64(n + 1), GmlID: fmt.Sprintf("node-%d", n), Location: models.Coordinate{Lat: 51, Lon: float64(n) / 1000}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for l, link := range links {
+		err := b.AddLink(models.NetworkLink{
+			ID:       int64(l + 1),
+			GmlID:    fmt.Sprintf("link-%d", l),
+			SourceID: int64(link[0] + 1),
+			TargetID: int64(link[1] + 1),
+			LengthM:  float64(link[2]),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Build()
+}
+
+// dijkstra is a plain O(n²) Dijkstra, returning the cost and links of the
+// cheapest path.
+func dijkstra(g *Graph, weights edgeWeights, source, target uint32) (float64, []uint32) {
+	nodes := len(g.nodeIDs)
+	dist := make([]float64, nodes)
+	parent := make([]int32, nodes)
+	done := make([]bool, nodes)
+	for n := range dist {
+		dist[n], parent[n] = math.Inf(1), -1
+	}
+	dist[source] = 0
+
+	for {
+		n := -1
+		for m := range nodes {
+			if !done[m] && !math.IsInf(dist[m], 1) && (n < 0 || dist[m] < dist[n]) {
+				n = m
+			}
+		}
+		if n < 0 {
+			break
+		}
+		done[n] = true
+		for adj := g.firstAdj[n]; adj < g.firstAdj[n+1]; adj++ {
+			next, l := g.adjNode[adj], g.adjLink[adj]
+			if cost := dist[n] + weights.of(l); cost < dist[next] {
+				dist[next], parent[next] = cost, int32(l)
+			}
+		}
+	}
+
+	if math.IsInf(dist[target], 1) {
+		return dist[target], nil
+	}
+	path := make([]uint32, 0)
+	for n := target; parent[n] != -1; n = g.otherEnd(uint32(parent[n]), n) {
+		path = append(path, uint32(parent[n]))
+	}
+	slices.Reverse(path)
+	return dist[target], path
+}
+
+// checkPath verifies that the links form a walk from source to target, and
+// returns its total weight.
+func checkPath(t *testing.T, g *Graph, weights edgeWeights, path []uint32, source, target uint32) float64 {
+	t.Helper()
+	n, total := source, 0.0
+	for _, l := range path {
+		if g.linkSource[l] != n && g.linkTarget[l] != n {
+			t.Fatalf("link %d does not touch node %d in path %v", l, n, path)
+		}
+		n = g.otherEnd(l, n)
+		total += weights.of(l)
+	}
+	if n != target {
+		t.Fatalf("path %v ends at node %d, not %d", path, n, target)
+	}
+	return total
+}
+
+func TestBidirectionalMatchesDijkstra(t *testing.T) {
+	// 0 - 1 - 2 - 3 in a line, with a cheaper detour 1 - 4 - 3 around 2, a
+	// dearer parallel link 0 = 1, a loop at 2 and an isolated pair 5 - 6
+	g := buildNetwork(t, 7, [][3]int{
+		{0, 1, 1},
+		{1, 2, 5},
+		{2, 3, 5},
+		{1, 4, 3},
+		{4, 3, 4},
+		{5, 6, 1},
+		{1, 0, 2},
+		{2, 2, 1},
+	})
+	weights := edgeWeights{weights: g.lengthM}
+
+	tests := []struct {
+		name           string
+		source, target uint32
+		avoided        []uint32
+		cost           float64
+		path           []uint32
+	}{
+		{name: "via detour", source: 0, target: 3, cost: 8, path: []uint32{0, 3, 4}},
+		{name: "reverse direction", source: 3, target: 0, cost: 8, path: []uint32{4, 3, 0}},
+		{name: "along the line", source: 0, target: 2, cost: 6, path: []uint32{0, 1}},
+		{name: "around an avoided link", source: 1, target: 3, avoided: []uint32{3}, cost: 10, path: []uint32{1, 2}},
+		{name: "parallel link", source: 0, target: 1, avoided: []uint32{0}, cost: 2, path: []uint32{6}},
+		{name: "unreachable target", source: 0, target: 5, cost: math.Inf(1)},
+		{name: "cut off by avoided links", source: 0, target: 4, avoided: []uint32{0, 6}, cost: math.Inf(1)},
+		{name: "source is target", source: 2, target: 2, cost: 0, path: []uint32{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			weights := weights
+			if len(test.avoided) > 0 {
+				weights.avoided = make(map[uint32]bool)
+				for _, l := range test.avoided {
+					weights.avoided[l] = true
+				}
+			}
+
+			path, start, cost := g.bidirectional([]seed{{node: test.source}}, []seed{{node: test.target}}, weights)
+			if cost != test.cost {
+				t.Fatalf("got cost %v, expected %v", cost, test.cost)
+			}
+			reference, referencePath := dijkstra(g, weights, test.source, test.target)
+			if cost != reference {
+				t.Fatalf("got cost %v, but Dijkstra gives %v", cost, reference)
+			}
+			if math.IsInf(cost, 1) {
+				if path != nil {
+					t.Fatalf("expected no path, got %v", path)
+				}
+				return
+			}
+			if start != test.source {
+				t.Fatalf("path starts from node %d, not %d", start, test.source)
+			}
+			if !slices.Equal(path, test.path) || !slices.Equal(path, referencePath) {
+				t.Fatalf("got path %v, expected %v (Dijkstra gives %v)", path, test.path, referencePath)
+			}
+			checkPath(t, g, weights, path, test.source, test.target)
+		})
+	}
+}
+
+func TestBidirectionalMatchesDijkstraOnRandomGraphs(t *testing.T) {
+	profile := &models.Profile{Name: "weighted", Metric: models.METRIC_DURATION, RoadClassification: map[string]float64{"Unclassified": 1.5}}
+	for round := range int64(10) {
+		g := randomNetwork(t, round, 40, 70)
+		weights, err := g.edgeWeights(profile, models.PathOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for source := range uint32(g.NodeCount()) {
+			for target := range uint32(g.NodeCount()) {
+				path, _, cost := g.bidirectional([]seed{{node: source}}, []seed{{node: target}}, weights)
+				reference, _ := dijkstra(g, weights, source, target)
+				if !closeTo(cost, reference) {
+					t.Fatalf("round %d: %d -> %d costs %v, but Dijkstra gives %v", round, source, target, cost, reference)
+				}
+				if !math.IsInf(cost, 1) {
+					if total := checkPath(t, g, weights, path, source, target); !closeTo(total, cost) {
+						t.Fatalf("round %d: %d -> %d path %v weighs %v, not %v", round, source, target, path, total, cost)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+const SNAPSHOT_MAGIC = "RPGR"
+
+// Bumped whenever the layout of snapshot files changes
+const SNAPSHOT_VERSION = 2
+
+// Upper bound on the entries in a ref-data table read back from a snapshot
+const MAX_REF_DATA_ENTRIES = 1000
+
+// WriteSnapshot serialises the graph (nodes, links with their attributes
+// and costs, centre lines, gml_id lookups and ref-data) in a compact,
+// checksummed binary format. Adjacency and spatial indexes are not stored,
+// as they are quick to rebuild.
+func (g *Graph) WriteSnapshot(w io.Writer) error {
+	bw := newBinaryWriter(w)
+	bw.write([]byte(SNAPSHOT_MAGIC))
+	bw.write(uint32(SNAPSHOT_VERSION))
+
+	writeRefData(bw, g.refData.RoadClassifications)
+	writeRefData(bw, g.refData.RoadFunctions)
+	writeRefData(bw, g.refData.FormOfWayTypes)
+
+	bw.slice(g.nodeIDs, len(g.nodeIDs))
+	writeStrings(bw, g.nodeGmlIDs)
+	bw.slice(g.nodeLats, len(g.nodeLats))
+	bw.slice(g.nodeLons, len(g.nodeLons))
+
+	bw.slice(g.linkIDs, len(g.linkIDs))
+	writeStrings(bw, g.linkGmlIDs)
+	bw.slice(g.linkSource, len(g.linkSource))
+	bw.slice(g.linkTarget, len(g.linkTarget))
+	bw.slice(g.lengthM, len(g.lengthM))
+	bw.slice(g.durationS, len(g.durationS))
+	bw.slice(g.roadClassification, len(g.roadClassification))
+	bw.slice(g.roadFunction, len(g.roadFunction))
+	bw.slice(g.formOfWay, len(g.formOfWay))
+	bw.slice(g.flags, len(g.flags))
+	bw.slice(g.name1, len(g.name1))
+	bw.slice(g.roadNumber, len(g.roadNumber))
+	bw.slice(g.ascentM, len(g.ascentM))
+	bw.slice(g.descentM, len(g.descentM))
+	bw.slice(g.maxGradient, len(g.maxGradient))
+
+	bw.slice(g.shapeStart, len(g.shapeStart))
+	bw.slice(g.shapeCoords, len(g.shapeCoords))
+	bw.slice(g.shapeElevations, len(g.shapeElevations))
+	writeStrings(bw, g.names)
+
+	if err := bw.finish(); err != nil {
+		return fmt.Errorf("failed to write graph snapshot: %v", err)
+	}
+	return nil
+}
+
+// ReadSnapshot reads a graph written by WriteSnapshot, streaming it in and
+// verifying its checksum, then rebuilds its indexes.
+func ReadSnapshot(r io.Reader) (*Graph, error) {
+	start := time.Now()
+	br := newBinaryReader(r)
+
+	magic := make([]byte, len(SNAPSHOT_MAGIC))
+	var version uint32
+	br.read(magic)
+	br.read(&version)
+	if br.err != nil {
+		return nil, fmt.Errorf("failed to read graph snapshot header: %v", br.err)
+	}
+	if string(magic) != SNAPSHOT_MAGIC {
+		return nil, fmt.Errorf("not a graph snapshot file")
+	}
+	if version != SNAPSHOT_VERSION {
+		return nil, fmt.Errorf("unsupported graph snapshot version %d (expected %d); re-run export-graph", version, SNAPSHOT_VERSION)
+	}
+
+	g := &Graph{}
+	g.refData.RoadClassifications = readRefData(br)
+	g.refData.RoadFunctions = readRefData(br)
+	g.refData.FormOfWayTypes = readRefData(br)
+
+	g.nodeIDs = readSlice[int64](br)
+	g.nodeGmlIDs = readStrings(br)
+	g.nodeLats = readSlice[float64](br)
+	g.nodeLons = readSlice[float64](br)
+
+	g.linkIDs = readSlice[int64](br)
+	g.linkGmlIDs = readStrings(br)
+	g.linkSource = readSlice[uint32](br)
+	g.linkTarget = readSlice[uint32](br)
+	g.lengthM = readSlice[float32](br)
+	g.durationS = readSlice[float32](br)
+	g.roadClassification = readSlice[uint16](br)
+	g.roadFunction = readSlice[uint16](br)
+	g.formOfWay = readSlice[uint16](br)
+	g.flags = readSlice[uint8](br)
+	g.name1 = readSlice[uint32](br)
+	g.roadNumber = readSlice[uint32](br)
+	g.ascentM = readSlice[float32](br)
+	g.descentM = readSlice[float32](br)
+	g.maxGradient = readSlice[float32](br)
+
+	g.shapeStart = readSlice[uint32](br)
+	g.shapeCoords = readSlice[float32](br)
+	g.shapeElevations = readSlice[float32](br)
+	g.names = readStrings(br)
+
+	if err := br.finish(); err != nil {
+		return nil, fmt.Errorf("failed to read graph snapshot: %v", err)
+	}
+	if err := g.checkConsistency(); err != nil {
+		return nil, fmt.Errorf("invalid graph snapshot: %v", err)
+	}
+
+	g.index()
+	log.Printf("Loaded routing graph with %d nodes and %d links in %s", g.NodeCount(), g.LinkCount(), time.Since(start).Round(time.Millisecond))
+	return g, nil
+}
+
+// checkConsistency guards against a snapshot that passes its checksum but
+// whose arrays do not line up (which would otherwise panic at query time).
+func (g *Graph) checkConsistency() error {
+	nodes, links := len(g.nodeIDs), len(g.linkIDs)
+	for _, length := range []int{len(g.nodeGmlIDs), len(g.nodeLats), len(g.nodeLons)} {
+		if length != nodes {
+			return fmt.Errorf("node arrays have mismatched lengths")
+		}
+	}
+	for _, length := range []int{len(g.linkGmlIDs), len(g.linkSource), len(g.linkTarget), len(g.lengthM),
+		len(g.durationS), len(g.roadClassification), len(g.roadFunction), len(g.formOfWay),
+		len(g.flags), len(g.name1), len(g.roadNumber), len(g.ascentM), len(g.descentM),
+		len(g.maxGradient), len(g.shapeStart) - 1} {
+		if length != links {
+			return fmt.Errorf("link arrays have mismatched lengths")
+		}
+	}
+
+	for l := range links {
+		if int(g.linkSource[l]) >= nodes || int(g.linkTarget[l]) >= nodes {
+			return fmt.Errorf("link %s refers to a node out of range", g.linkGmlIDs[l])
+		}
+		if int(g.name1[l]) >= len(g.names) || int(g.roadNumber[l]) >= len(g.names) {
+			return fmt.Errorf("link %s refers to a name out of range", g.linkGmlIDs[l])
+		}
+		if g.shapeStart[l] > g.shapeStart[l+1] {
+			return fmt.Errorf("link %s has an invalid centre line", g.linkGmlIDs[l])
+		}
+	}
+	if len(g.shapeStart) > 0 && 2*int(g.shapeStart[links]) != len(g.shapeCoords) {
+		return fmt.Errorf("centre line coordinates have the wrong length")
+	}
+	if len(g.shapeStart) > 0 && int(g.shapeStart[links]) != len(g.shapeElevations) {
+		return fmt.Errorf("centre line elevations have the wrong length")
+	}
+	if len(g.names) == 0 || g.names[0] != "" {
+		return fmt.Errorf("name table is invalid")
+	}
+	return nil
+}
+
+// writeStrings writes the strings as their end offsets followed by one
+// concatenated blob, which is far quicker to read back than one length
+// prefix per string.
+func writeStrings(bw *binaryWriter, strs []string) {
+	ends := make([]uint64, len(strs))
+	var total uint64
+	for i, s := range strs {
+		total += uint64(len(s))
+		ends[i] = total
+	}
+	bw.slice(ends, len(ends))
+	bw.string(strings.Join(strs, ""))
+}
+
+func readStrings(br *binaryReader) []string {
+	ends := readSlice[uint64](br)
+	blob := br.string()
+	if br.err != nil {
+		return nil
+	}
+
+	// The strings are slices of the one blob, so share its memory
+	strs := make([]string, len(ends))
+	var start uint64
+	for i, end := range ends {
+		if end < start || end > uint64(len(blob)) {
+			br.err = fmt.Errorf("string table is corrupt")
+			return nil
+		}
+		strs[i] = blob[start:end]
+		start = end
+	}
+	return strs
+}
+
+func writeRefData(bw *binaryWriter, table []models.RefData) {
+	bw.write(uint32(len(table)))
+	for _, entry := range table {
+		bw.write(entry.ID)
+		bw.string(entry.Value)
+		bw.write(entry.Description != nil)
+		if entry.Description != nil {
+			bw.string(*entry.Description)
+		}
+	}
+}
+
+func readRefData(br *binaryReader) []models.RefData {
+	var count uint32
+	br.read(&count)
+	if br.err != nil || count > MAX_REF_DATA_ENTRIES {
+		if br.err == nil {
+			br.err = fmt.Errorf("implausible ref-data count %d", count)
+		}
+		return nil
+	}
+
+	table := make([]models.RefData, count)
+	for i := range table {
+		br.read(&table[i].ID)
+		table[i].Value = br.string()
+		var hasDescription bool
+		br.read(&hasDescription)
+		if hasDescription {
+			description := br.string()
+			table[i].Description = &description
+		}
+	}
+	return table
+}
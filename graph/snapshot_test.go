@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+func writeSnapshot(t *testing.T, g *Graph) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := g.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// openCorrupted writes the data with one byte flipped to a file, so that
+// lengths are checked against its size as they would be in use.
+func openCorrupted(t *testing.T, data []byte, i int) *os.File {
+	t.Helper()
+	corrupt := bytes.Clone(data)
+	corrupt[i] ^= 0x5a
+	path := filepath.Join(t.TempDir(), "corrupt.bin")
+	if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	g := randomNetwork(t, 1, 50, 80)
+	description := "Minor road"
+	g.refData.RoadClassifications[1].Description = &description
+	data := writeSnapshot(t, g)
+
+	read, err := ReadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.NodeCount() != g.NodeCount() || read.LinkCount() != g.LinkCount() {
+		t.Fatalf("read %d nodes and %d links, expected %d and %d", read.NodeCount(), read.LinkCount(), g.NodeCount(), g.LinkCount())
+	}
+	if got := read.refData.RoadClassifications[1]; got.Value != "Unclassified" || got.Description == nil || *got.Description != description {
+		t.Fatalf("ref-data did not round trip: %+v", got)
+	}
+
+	// Every stored array is written out again byte for byte
+	if !bytes.Equal(writeSnapshot(t, read), data) {
+		t.Fatal("snapshot of the read graph differs from the original")
+	}
+
+	profile := &models.Profile{Name: "shortest", Metric: models.METRIC_DISTANCE}
+	expected, _ := g.edgeWeights(profile, models.PathOptions{})
+	weights, err := read.edgeWeights(profile, models.PathOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for source := range uint32(g.NodeCount()) {
+		_, _, cost := read.bidirectional([]seed{{node: source}}, []seed{{node: 0}}, weights)
+		_, _, expectedCost := g.bidirectional([]seed{{node: source}}, []seed{{node: 0}}, expected)
+		if !closeTo(cost, expectedCost) {
+			t.Fatalf("%d -> 0 costs %v after reading, expected %v", source, cost, expectedCost)
+		}
+	}
+}
+
+func TestSnapshotRejectsFlippedBytes(t *testing.T) {
+	data := writeSnapshot(t, randomNetwork(t, 2, 10, 15))
+
+	for i := range data {
+		if _, err := ReadSnapshot(openCorrupted(t, data, i)); err == nil {
+			t.Fatalf("snapshot with byte %d of %d flipped was read without error", i, len(data))
+		}
+	}
+
+	// A flipped byte that leaves the data readable is caught by the checksum
+	_, err := ReadSnapshot(openCorrupted(t, data, len(data)-1))
+	if err == nil || !strings.Contains(err.Error(), ErrChecksumMismatch.Error()) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+}
+
+func TestSnapshotChecksConsistency(t *testing.T) {
+	g := randomNetwork(t, 3, 10, 15)
+	g.linkSource[0] = uint32(g.NodeCount())
+
+	_, err := ReadSnapshot(bytes.NewReader(writeSnapshot(t, g)))
+	if err == nil || !strings.Contains(err.Error(), "refers to a node out of range") {
+		t.Fatalf("expected an out of range node, got %v", err)
+	}
+}
+
+func TestSnapshotRejectsLengthBeyondFile(t *testing.T) {
+	g := randomNetwork(t, 4, 10, 15)
+	g.refData = models.NetworkRefData{}
+	data := writeSnapshot(t, g)
+
+	// With no ref-data, the node ids' length follows the magic, version and
+	// three empty ref-data counts
+	binary.LittleEndian.PutUint64(data[20:], 1<<40)
+	path := filepath.Join(t.TempDir(), "graph.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = ReadSnapshot(file)
+	if err == nil || !strings.Contains(err.Error(), "exceeds the") {
+		t.Fatalf("expected the length to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"math"
+	"sort"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Size of each (square, in degrees) grid cell in the spatial indexes
+const GRID_CELL_DEGREES = 0.01
+
+// Number of rings of cells searched around a point before giving up
+const MAX_GRID_RINGS = 200
+
+// grid is a spatial index of items (nodes or links): each item is listed
+// under every cell it touches, with the (sorted) cell keys searched by
+// binary search.
+type grid struct {
+	keys   []uint64
+	starts []uint32
+	items  []uint32
+}
+
+type gridEntry struct {
+	key  uint64
+	item uint32
+}
+
+func cellOf(lat, lon float64) (int32, int32) {
+	return int32(math.Floor(lon / GRID_CELL_DEGREES)), int32(math.Floor(lat / GRID_CELL_DEGREES))
+}
+
+func cellKey(x, y int32) uint64 {
+	return uint64(uint32(x))<<32 | uint64(uint32(y))
+}
+
+func newGrid(entries []gridEntry) *grid {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+		return entries[i].item < entries[j].item
+	})
+
+	g := &grid{items: make([]uint32, 0, len(entries))}
+	for i, entry := range entries {
+		if i > 0 && entry == entries[i-1] {
+			continue
+		}
+		if len(g.keys) == 0 || g.keys[len(g.keys)-1] != entry.key {
+			g.keys = append(g.keys, entry.key)
+			g.starts = append(g.starts, uint32(len(g.items)))
+		}
+		g.items = append(g.items, entry.item)
+	}
+	g.starts = append(g.starts, uint32(len(g.items)))
+	return g
+}
+
+// newNodeGrid indexes each node under the cell it falls in.
+func newNodeGrid(lats, lons []float64) *grid {
+	entries := make([]gridEntry, len(lats))
+	for n := range lats {
+		entries[n] = gridEntry{key: cellKey(cellOf(lats[n], lons[n])), item: uint32(n)}
+	}
+	return newGrid(entries)
+}
+
+// newLinkGrid indexes each link under every cell touched by the bounding
+// box of any segment of its centre line.
+func newLinkGrid(g *Graph) *grid {
+	entries := make([]gridEntry, 0, len(g.linkIDs)*2)
+	for l := range g.linkIDs {
+		coords := g.shapeCoords[2*g.shapeStart[l] : 2*g.shapeStart[l+1]]
+		for i := 2; i+1 < len(coords); i += 2 {
+			x0, y0 := cellOf(float64(coords[i-1]), float64(coords[i-2]))
+			x1, y1 := cellOf(float64(coords[i+1]), float64(coords[i]))
+			for x := min(x0, x1); x <= max(x0, x1); x++ {
+				for y := min(y0, y1); y <= max(y0, y1); y++ {
+					entries = append(entries, gridEntry{key: cellKey(x, y), item: uint32(l)})
+				}
+			}
+		}
+	}
+	return newGrid(entries)
+}
+
+func (g *grid) cell(x, y int32) []uint32 {
+	key := cellKey(x, y)
+	i := sort.Search(len(g.keys), func(i int) bool { return g.keys[i] >= key })
+	if i == len(g.keys) || g.keys[i] != key {
+		return nil
+	}
+	return g.items[g.starts[i]:g.starts[i+1]]
+}
+
+// cellMetres is the smallest dimension of a grid cell at the latitude.
+func cellMetres(lat float64) float64 {
+	return GRID_CELL_DEGREES * models.EARTH_RADIUS_M * math.Pi / 180 * math.Cos(lat*math.Pi/180)
+}
+
+// nearest finds the item closest to the coordinate, as measured (in metres)
+// by distance, which returns +Inf for items that should not be considered.
+// Cells are searched in rings of increasing size, stopping once no
+// unsearched cell could hold anything closer than the best item found so
+// far.
+func (g *grid) nearest(coord models.Coordinate, distance func(item uint32) float64) (uint32, float64, bool) {
+	best, bestDistance, found := uint32(0), math.Inf(1), false
+	g.search(coord, func(ring int32, items []uint32) bool {
+		for _, item := range items {
+			if d := distance(item); d < bestDistance {
+				best, bestDistance, found = item, d, true
+			}
+		}
+		return !found || bestDistance > float64(ring)*cellMetres(coord.Lat)
+	})
+	return best, bestDistance, found
+}
+
+// within calls fn for every item in the cells within radiusM of the
+// coordinate. Items may be visited more than once.
+func (g *grid) within(coord models.Coordinate, radiusM float64, fn func(item uint32)) {
+	g.search(coord, func(ring int32, items []uint32) bool {
+		for _, item := range items {
+			fn(item)
+		}
+		return float64(ring)*cellMetres(coord.Lat) < radiusM
+	})
+}
+
+// search visits the cells around the coordinate in rings of increasing
+// size, for as long as visit (called once per ring) returns true.
+func (g *grid) search(coord models.Coordinate, visit func(ring int32, items []uint32) bool) {
+	cx, cy := cellOf(coord.Lat, coord.Lon)
+	items := make([]uint32, 0)
+	for ring := int32(0); ring <= MAX_GRID_RINGS; ring++ {
+		items = items[:0]
+		for x := cx - ring; x <= cx+ring; x++ {
+			for y := cy - ring; y <= cy+ring; y++ {
+				if x != cx-ring && x != cx+ring && y != cy-ring && y != cy+ring {
+					continue
+				}
+				items = append(items, g.cell(x, y)...)
+			}
+		}
+
+		if !visit(ring, items) {
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// weightsFor returns the cost of traversing every link under the profile,
+// mirroring the cost expression the database repository builds for
+// pgRouting. Excluded links cost +Inf. Weights are computed once per profile
+// and metric, then cached.
+func (g *Graph) weightsFor(profile *models.Profile) ([]float32, error) {
+	key := profile.Name + "/" + profile.Metric
+
+	g.weightsMu.Lock()
+	defer g.weightsMu.Unlock()
+	if weights, ok := g.weights[key]; ok {
+		return weights, nil
+	}
+
+	weights, err := g.computeWeights(profile)
+	if err != nil {
+		return nil, fmt.Errorf("profile '%s': %v", profile.Name, err)
+	}
+	g.weights[key] = weights
+	return weights, nil
+}
+
+func (g *Graph) computeWeights(profile *models.Profile) ([]float32, error) {
+	classMultipliers, err := multipliersById(profile.RoadClassification, g.refData.RoadClassifications, "road_classification_id")
+	if err != nil {
+		return nil, err
+	}
+	functionMultipliers, err := multipliersById(profile.RoadFunction, g.refData.RoadFunctions, "road_function_id")
+	if err != nil {
+		return nil, err
+	}
+	formMultipliers, err := multipliersById(profile.FormOfWay, g.refData.FormOfWayTypes, "form_of_way_id")
+	if err != nil {
+		return nil, err
+	}
+	excludedClasses, err := idSet(profile.Exclude.RoadClassification, g.refData.RoadClassifications, "road_classification_id")
+	if err != nil {
+		return nil, err
+	}
+	excludedFunctions, err := idSet(profile.Exclude.RoadFunction, g.refData.RoadFunctions, "road_function_id")
+	if err != nil {
+		return nil, err
+	}
+	excludedForms, err := idSet(profile.Exclude.FormOfWay, g.refData.FormOfWayTypes, "form_of_way_id")
+	if err != nil {
+		return nil, err
+	}
+
+	if profile.SpeedMph < 0 {
+		return nil, fmt.Errorf("speed must not be negative")
+	}
+	if profile.Climb < 0 {
+		return nil, fmt.Errorf("climb cost must not be negative")
+	}
+	if profile.Exclude.MaxGradient < 0 {
+		return nil, fmt.Errorf("max gradient must not be negative")
+	}
+
+	weights := make([]float32, len(g.linkIDs))
+	for l := range weights {
+		class, function, form := g.roadClassification[l], g.roadFunction[l], g.formOfWay[l]
+		tooSteep := profile.Exclude.MaxGradient > 0 && g.maxGradient[l] > float32(profile.Exclude.MaxGradient)
+		if excludedClasses[class] || excludedFunctions[function] || excludedForms[form] || tooSteep {
+			weights[l] = infinity
+			continue
+		}
+
+		cost := float64(g.lengthM[l])
+		if profile.Metric == models.METRIC_DURATION {
+			if duration, ok := profile.DurationSeconds(cost); ok {
+				cost = duration
+			} else {
+				cost = g.duration(uint32(l))
+			}
+		}
+
+		if multiplier, ok := classMultipliers[class]; ok {
+			cost *= multiplier
+		}
+		if multiplier, ok := functionMultipliers[function]; ok {
+			cost *= multiplier
+		}
+		if multiplier, ok := formMultipliers[form]; ok {
+			cost *= multiplier
+		}
+		if profile.PrimaryRoute > 0 && g.flags[l]&FLAG_PRIMARY_ROUTE != 0 {
+			cost *= profile.PrimaryRoute
+		}
+		if profile.TrunkRoad > 0 && g.flags[l]&FLAG_TRUNK_ROAD != 0 {
+			cost *= profile.TrunkRoad
+		}
+		cost += profile.Climb * float64(g.ascentM[l]+g.descentM[l]) / 2
+		weights[l] = float32(math.Max(cost, 0))
+	}
+	return weights, nil
+}
+
+func refId(table []models.RefData, value string, column string) (uint16, error) {
+	for _, entry := range table {
+		if entry.Value == value {
+			return uint16(entry.ID), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown %s value '%s' in profile", column, value)
+}
+
+func multipliersById(multipliers map[string]float64, table []models.RefData, column string) (map[uint16]float64, error) {
+	results := make(map[uint16]float64, len(multipliers))
+	for value, multiplier := range multipliers {
+		id, err := refId(table, value, column)
+		if err != nil {
+			return nil, err
+		}
+		if multiplier <= 0 {
+			return nil, fmt.Errorf("multiplier for '%s' must be positive", value)
+		}
+		results[id] = multiplier
+	}
+	return results, nil
+}
+
+func idSet(values []string, table []models.RefData, column string) (map[uint16]bool, error) {
+	results := make(map[uint16]bool, len(values))
+	for _, value := range values {
+		id, err := refId(table, value, column)
+		if err != nil {
+			return nil, err
+		}
+		results[id] = true
+	}
+	return results, nil
+}
+
+// ValidateProfile checks that every value referenced by the profile exists
+// in the graph's ref-data.
+func (g *Graph) ValidateProfile(profile *models.Profile) error {
+	if _, err := g.computeWeights(profile); err != nil {
+		return fmt.Errorf("profile '%s': %v", profile.Name, err)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/rm-hull/route-planner/cmds"
+	"github.com/rm-hull/route-planner/routing"
 )
 
 func main() {
@@ -44,6 +45,17 @@ func main() {
 		},
 	}
 
+	var importDemCmd = &cobra.Command{
+		Use:   "dem [path]",
+		Short: "Import road link elevations from OS Terrain 50 ASCII grid or GeoTIFF tiles (file or directory)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.ImportDEM(args[0]); err != nil {
+				log.Fatalf("failed to import elevations: %v", err)
+			}
+		},
+	}
+
 	var pingDbCmd = &cobra.Command{
 		Use:   "ping",
 		Short: "Ping Postgres database",
@@ -61,6 +73,146 @@ func main() {
 		},
 	}
 
+	var addr, profilesPath string
+	var engineOpts cmds.EngineOptions
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Start HTTP server",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.Serve(addr, profilesPath, engineOpts); err != nil {
+				log.Fatalf("server failed: %v", err)
+			}
+		},
+	}
+	serveCmd.Flags().StringVar(&addr, "addr", ":8080", "Address to listen on")
+	serveCmd.Flags().StringVar(&profilesPath, "profiles", "data/profiles.json", "Routing profiles file")
+	serveCmd.Flags().BoolVar(&engineOpts.InMemory, "in-memory", false, "Load the road network into memory at startup and route from there")
+	serveCmd.Flags().StringVar(&engineOpts.HierarchiesDir, "hierarchies", "", "Directory of contraction hierarchies from prepare (implies --in-memory)")
+	serveCmd.Flags().StringVar(&engineOpts.GraphPath, "graph", "", "Graph snapshot from export-graph to serve from, without a database")
+
+	var from, to, format, output, avoidAreasPath string
+	var via []string
+	var routeOpts routing.RouteOptions
+	var routeCmd = &cobra.Command{
+		Use:   "route",
+		Short: "Plan a route between lat,lon coordinates",
+		Run: func(cmd *cobra.Command, args []string) {
+			waypoints := append(append([]string{from}, via...), to)
+			if err := cmds.PlanRoute(waypoints, routeOpts, profilesPath, avoidAreasPath, format, output); err != nil {
+				log.Fatalf("failed to plan route: %v", err)
+			}
+		},
+	}
+	routeCmd.Flags().StringVar(&from, "from", "", "Origin as lat,lon")
+	routeCmd.Flags().StringArrayVar(&via, "via", nil, "Via point as lat,lon (repeatable, visited in order)")
+	routeCmd.Flags().StringVar(&to, "to", "", "Destination as lat,lon")
+	routeCmd.Flags().IntVar(&routeOpts.Alternatives, "alternatives", 0, "Number of alternative routes to look for")
+	routeCmd.Flags().StringVar(&routeOpts.Profile, "profile", "", "Routing profile (defaults to shortest)")
+	routeCmd.Flags().StringVar(&routeOpts.Minimise, "minimise", "", "Metric to minimise: distance or duration (defaults to the profile's)")
+	routeCmd.Flags().StringArrayVar(&routeOpts.Avoid.Links, "avoid-link", nil, "gml_id of a road link to avoid (repeatable)")
+	routeCmd.Flags().StringVar(&avoidAreasPath, "avoid-areas", "", "GeoJSON file of polygons to avoid")
+	routeCmd.Flags().StringVar(&profilesPath, "profiles", "data/profiles.json", "Routing profiles file")
+	routeCmd.Flags().StringVar(&format, "format", "gpx", "Output format: json, geojson or gpx")
+	routeCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (defaults to stdout)")
+	routeCmd.MarkFlagRequired("from")
+	routeCmd.MarkFlagRequired("to")
+
+	var matrixCmd = &cobra.Command{
+		Use:   "matrix [request.json]",
+		Short: "Compute a distance/duration matrix between origins and destinations",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.DistanceMatrix(args[0], profilesPath, output); err != nil {
+				log.Fatalf("failed to compute matrix: %v", err)
+			}
+		},
+	}
+	matrixCmd.Flags().StringVar(&profilesPath, "profiles", "data/profiles.json", "Routing profiles file")
+	matrixCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (defaults to stdout)")
+
+	var traceFormat string
+	var matchCmd = &cobra.Command{
+		Use:   "match [trace]",
+		Short: "Match a GPS trace (GPX or CSV) to the road links travelled",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.MatchTrace(args[0], traceFormat, profilesPath, output); err != nil {
+				log.Fatalf("failed to match trace: %v", err)
+			}
+		},
+	}
+	matchCmd.Flags().StringVar(&traceFormat, "format", "", "Trace format: gpx or csv (defaults to the file extension)")
+	matchCmd.Flags().StringVar(&profilesPath, "profiles", "data/profiles.json", "Routing profiles file")
+	matchCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (defaults to stdout)")
+
+	var searchLimit int
+	var searchCmd = &cobra.Command{
+		Use:   "search [query]",
+		Short: "Find roads by name or number, e.g. \"A303\" or \"Station Rd\"",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.SearchRoads(args[0], searchLimit, profilesPath, output); err != nil {
+				log.Fatalf("failed to search roads: %v", err)
+			}
+		},
+	}
+	searchCmd.Flags().IntVar(&searchLimit, "limit", 10, "Maximum number of roads to return")
+	searchCmd.Flags().StringVar(&profilesPath, "profiles", "data/profiles.json", "Routing profiles file")
+	searchCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (defaults to stdout)")
+
+	var durationsCmd = &cobra.Command{
+		Use:   "durations",
+		Short: "Recalculate road link durations from the speed model",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.UpdateDurations(); err != nil {
+				log.Fatalf("failed to update durations: %v", err)
+			}
+		},
+	}
+
+	var profileNames []string
+	var hierarchiesDir, graphPath string
+	var prepareCmd = &cobra.Command{
+		Use:   "prepare",
+		Short: "Build contraction hierarchies over the road network for fast routing",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.Prepare(profilesPath, profileNames, hierarchiesDir, graphPath); err != nil {
+				log.Fatalf("failed to prepare hierarchies: %v", err)
+			}
+		},
+	}
+	prepareCmd.Flags().StringVar(&profilesPath, "profiles", "data/profiles.json", "Routing profiles file")
+	prepareCmd.Flags().StringArrayVar(&profileNames, "profile", nil, "Profile to prepare (repeatable; defaults to all)")
+	prepareCmd.Flags().StringVarP(&hierarchiesDir, "output", "o", "data/ch", "Output directory")
+	prepareCmd.Flags().StringVar(&graphPath, "graph", "", "Graph snapshot from export-graph to use instead of the database")
+
+	var exportGraphCmd = &cobra.Command{
+		Use:   "export-graph [output]",
+		Short: "Export the routable road network to a graph snapshot file",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.ExportGraph(args[0]); err != nil {
+				log.Fatalf("failed to export graph: %v", err)
+			}
+		},
+	}
+
+	var minZoom, maxZoom int
+	var bbox string
+	var tilesCmd = &cobra.Command{
+		Use:   "tiles [output.pmtiles]",
+		Short: "Render vector tiles of the road network into a PMTiles archive",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cmds.GenerateTiles(args[0], minZoom, maxZoom, bbox); err != nil {
+				log.Fatalf("failed to generate tiles: %v", err)
+			}
+		},
+	}
+	tilesCmd.Flags().IntVar(&minZoom, "min-zoom", 5, "Lowest zoom level to render")
+	tilesCmd.Flags().IntVar(&maxZoom, "max-zoom", 14, "Highest zoom level to render")
+	tilesCmd.Flags().StringVar(&bbox, "bbox", "", "Area to render as min_lat,min_lon,max_lat,max_lon (defaults to the whole network)")
+
 	var versionCmd = &cobra.Command{
 		Use:   "version",
 		Short: "Show version",
@@ -71,8 +223,18 @@ func main() {
 
 	rootCmd.AddCommand(importGmlCmd)
 	rootCmd.AddCommand(importRefDataCmd)
+	rootCmd.AddCommand(importDemCmd)
 	rootCmd.AddCommand(pingDbCmd)
 	rootCmd.AddCommand(migrationCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(routeCmd)
+	rootCmd.AddCommand(matrixCmd)
+	rootCmd.AddCommand(matchCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(durationsCmd)
+	rootCmd.AddCommand(prepareCmd)
+	rootCmd.AddCommand(exportGraphCmd)
+	rootCmd.AddCommand(tilesCmd)
 	rootCmd.AddCommand(versionCmd)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// Maximum number of links a single request may avoid
+const MAX_AVOID_LINKS = 1000
+
+// Maximum number of areas a single request may avoid
+const MAX_AVOID_AREAS = 100
+
+var gmlIdPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// A polygon as per GeoJSON: an outer ring followed by any holes, each ring
+// being a closed sequence of [lon, lat] positions
+type Polygon [][][2]float64
+
+// Road links that a route must not use
+type Avoid struct {
+	// Links whose centre line intersects any of these areas are excluded
+	Areas []Polygon `json:"areas,omitempty"`
+	// gml_ids of individual links to exclude
+	Links []string `json:"links,omitempty"`
+}
+
+// Per-search adjustments to the links a path may use, on top of the profile
+type PathOptions struct {
+	// Multipliers for the cost of specific links, keyed by link id
+	Penalties map[int64]float64
+	// Links the path must not use
+	Avoid *Avoid
+}
+
+func (a *Avoid) IsEmpty() bool {
+	return a == nil || (len(a.Areas) == 0 && len(a.Links) == 0)
+}
+
+// Validate checks the gml_ids are well-formed and every polygon has closed
+// rings of valid coordinates.
+func (a *Avoid) Validate() error {
+	if len(a.Links) > MAX_AVOID_LINKS {
+		return fmt.Errorf("at most %d links may be avoided", MAX_AVOID_LINKS)
+	}
+	for _, id := range a.Links {
+		if !gmlIdPattern.MatchString(id) {
+			return fmt.Errorf("invalid road link gml_id '%s'", id)
+		}
+	}
+
+	if len(a.Areas) > MAX_AVOID_AREAS {
+		return fmt.Errorf("at most %d areas may be avoided", MAX_AVOID_AREAS)
+	}
+	for i, polygon := range a.Areas {
+		if len(polygon) == 0 {
+			return fmt.Errorf("avoid area %d has no rings", i+1)
+		}
+		for _, ring := range polygon {
+			if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+				return fmt.Errorf("avoid area %d has a ring that is not closed", i+1)
+			}
+			for _, pos := range ring {
+				if math.IsNaN(pos[0]) || math.IsNaN(pos[1]) || pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+					return fmt.Errorf("avoid area %d has a coordinate out of range", i+1)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ParseAvoidAreas reads the polygons in a GeoJSON Polygon, MultiPolygon,
+// Feature or FeatureCollection. Any other geometries are an error.
+func ParseAvoidAreas(data []byte) ([]Polygon, error) {
+	var object struct {
+		Type        string            `json:"type"`
+		Coordinates json.RawMessage   `json:"coordinates"`
+		Geometry    json.RawMessage   `json:"geometry"`
+		Features    []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %v", err)
+	}
+
+	switch object.Type {
+	case "Polygon":
+		var polygon Polygon
+		if err := json.Unmarshal(object.Coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %v", err)
+		}
+		return []Polygon{polygon}, nil
+
+	case "MultiPolygon":
+		var polygons []Polygon
+		if err := json.Unmarshal(object.Coordinates, &polygons); err != nil {
+			return nil, fmt.Errorf("invalid MultiPolygon coordinates: %v", err)
+		}
+		return polygons, nil
+
+	case "Feature":
+		return ParseAvoidAreas(object.Geometry)
+
+	case "FeatureCollection":
+		polygons := make([]Polygon, 0, len(object.Features))
+		for _, feature := range object.Features {
+			parsed, err := ParseAvoidAreas(feature)
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, parsed...)
+		}
+		return polygons, nil
+	}
+
+	return nil, fmt.Errorf("unsupported GeoJSON type '%s' (expected a Polygon or MultiPolygon)", object.Type)
+}
+
+// Bounds returns the polygon's bounding box as minLon, minLat, maxLon, maxLat.
+func (p Polygon) Bounds() (float64, float64, float64, float64) {
+	minLon, minLat, maxLon, maxLat := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, pos := range p[0] {
+		minLon, minLat = math.Min(minLon, pos[0]), math.Min(minLat, pos[1])
+		maxLon, maxLat = math.Max(maxLon, pos[0]), math.Max(maxLat, pos[1])
+	}
+	return minLon, minLat, maxLon, maxLat
+}
+
+// Contains reports whether the [lon, lat] position lies inside the polygon
+// (and outside its holes), by the even-odd rule.
+func (p Polygon) Contains(pos [2]float64) bool {
+	inside := false
+	for _, ring := range p {
+		for i := 1; i < len(ring); i++ {
+			a, b := ring[i-1], ring[i]
+			if (a[1] > pos[1]) != (b[1] > pos[1]) &&
+				pos[0] < a[0]+(pos[1]-a[1])*(b[0]-a[0])/(b[1]-a[1]) {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// IntersectsSegment reports whether the segment between the two [lon, lat]
+// positions touches the polygon. Like PostGIS geometry functions, this
+// treats coordinates as planar.
+func (p Polygon) IntersectsSegment(a, b [2]float64) bool {
+	if p.Contains(a) || p.Contains(b) {
+		return true
+	}
+	for _, ring := range p {
+		for i := 1; i < len(ring); i++ {
+			if segmentsIntersect(a, b, ring[i-1], ring[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func segmentsIntersect(a, b, c, d [2]float64) bool {
+	d1, d2 := orientation(c, d, a), orientation(c, d, b)
+	d3, d4 := orientation(a, b, c), orientation(a, b, d)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(c, d, a)) || (d2 == 0 && onSegment(c, d, b)) ||
+		(d3 == 0 && onSegment(a, b, c)) || (d4 == 0 && onSegment(a, b, d))
+}
+
+func orientation(a, b, c [2]float64) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// onSegment reports whether c, which is collinear with a and b, lies between them.
+func onSegment(a, b, c [2]float64) bool {
+	return math.Min(a[0], b[0]) <= c[0] && c[0] <= math.Max(a[0], b[0]) &&
+		math.Min(a[1], b[1]) <= c[1] && c[1] <= math.Max(a[1], b[1])
+}
@@ -0,0 +1,25 @@
+package models
+
+// Heights along a road link, sampled from a digital elevation model. Ascent
+// and descent are in the direction the link is digitised.
+type LinkElevation struct {
+	LinkID      int64
+	AscentM     float64
+	DescentM    float64
+	MaxGradient float64
+	// Height (in metres) at each vertex of the link's centre line
+	Elevations []float32
+}
+
+// Height of a route at a distance from its start
+type ElevationPoint struct {
+	DistanceM  float64 `json:"distance_m"`
+	ElevationM float64 `json:"elevation_m"`
+}
+
+// Total climb and descent along a route, and its height profile
+type RouteElevation struct {
+	AscentM  float64          `json:"ascent_m"`
+	DescentM float64          `json:"descent_m"`
+	Profile  []ElevationPoint `json:"profile"`
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Represents a WGS84 latitude/longitude pair
+type Coordinate struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// ParseCoordinate parses a "lat,lon" string as supplied on query strings.
+func ParseCoordinate(text string) (*Coordinate, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected 'lat,lon' but got '%s'", text)
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude '%s': %v", parts[0], err)
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude '%s': %v", parts[1], err)
+	}
+
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("coordinate out of range: %s", text)
+	}
+
+	return &Coordinate{Lat: lat, Lon: lon}, nil
+}
+
+func (c Coordinate) String() string {
+	return fmt.Sprintf("%f,%f", c.Lat, c.Lon)
+}
+
+// Rectangle of WGS84 coordinates
+type BoundingBox struct {
+	MinLat float64 `json:"min_lat"`
+	MinLon float64 `json:"min_lon"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLon float64 `json:"max_lon"`
+}
+
+// ParseBoundingBox parses "min_lat,min_lon,max_lat,max_lon".
+func ParseBoundingBox(text string) (*BoundingBox, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("expected 'min_lat,min_lon,max_lat,max_lon' but got '%s'", text)
+	}
+
+	southWest, err := ParseCoordinate(parts[0] + "," + parts[1])
+	if err != nil {
+		return nil, err
+	}
+	northEast, err := ParseCoordinate(parts[2] + "," + parts[3])
+	if err != nil {
+		return nil, err
+	}
+	if southWest.Lat >= northEast.Lat || southWest.Lon >= northEast.Lon {
+		return nil, fmt.Errorf("bounding box is empty: %s", text)
+	}
+
+	return &BoundingBox{MinLat: southWest.Lat, MinLon: southWest.Lon, MaxLat: northEast.Lat, MaxLon: northEast.Lon}, nil
+}
+
+// BoundsOf returns the smallest bounding box containing every coordinate,
+// grown by marginM metres on each side.
+func BoundsOf(coords []Coordinate, marginM float64) BoundingBox {
+	bbox := BoundingBox{MinLat: math.Inf(1), MinLon: math.Inf(1), MaxLat: math.Inf(-1), MaxLon: math.Inf(-1)}
+	for _, coord := range coords {
+		bbox.MinLat, bbox.MinLon = math.Min(bbox.MinLat, coord.Lat), math.Min(bbox.MinLon, coord.Lon)
+		bbox.MaxLat, bbox.MaxLon = math.Max(bbox.MaxLat, coord.Lat), math.Max(bbox.MaxLon, coord.Lon)
+	}
+
+	dLat := marginM / EARTH_RADIUS_M * 180 / math.Pi
+	dLon := dLat / math.Max(0.01, math.Cos(math.Max(math.Abs(bbox.MinLat), math.Abs(bbox.MaxLat))*math.Pi/180))
+	bbox.MinLat, bbox.MaxLat = bbox.MinLat-dLat, bbox.MaxLat+dLat
+	bbox.MinLon, bbox.MaxLon = bbox.MinLon-dLon, bbox.MaxLon+dLon
+	return bbox
+}
+
+// Sequence of [lon, lat] positions, as per GeoJSON
+type LineString [][2]float64
+
+// Reversed returns a copy of the line string running in the opposite direction.
+func (ls LineString) Reversed() LineString {
+	reversed := make(LineString, len(ls))
+	for i, pos := range ls {
+		reversed[len(ls)-1-i] = pos
+	}
+	return reversed
+}
+
+// Slice returns the part of the line string between the two fractions of
+// its length (0.0 = first position, 1.0 = last), in the same direction.
+// Lengths are measured in a local equirectangular plane.
+func (ls LineString) Slice(from, to float64) LineString {
+	if len(ls) < 2 {
+		return ls
+	}
+	from, to = math.Max(0, from), math.Min(1, to)
+	lengths, total := ls.segmentLengths()
+
+	// Position at a distance along segment i
+	interpolate := func(i int, along float64) [2]float64 {
+		t := 0.0
+		if lengths[i] > 0 {
+			t = along / lengths[i]
+		}
+		return [2]float64{ls[i][0] + t*(ls[i+1][0]-ls[i][0]), ls[i][1] + t*(ls[i+1][1]-ls[i][1])}
+	}
+
+	start, end := from*total, to*total
+	sliced := make(LineString, 0)
+	travelled := 0.0
+	for i, length := range lengths {
+		last := i == len(lengths)-1
+		if len(sliced) == 0 && (start <= travelled+length || last) {
+			sliced = append(sliced, interpolate(i, math.Min(start-travelled, length)))
+		}
+		if len(sliced) > 0 {
+			if end <= travelled+length || last {
+				return append(sliced, interpolate(i, math.Min(end-travelled, length)))
+			}
+			sliced = append(sliced, ls[i+1])
+		}
+		travelled += length
+	}
+	return sliced
+}
+
+// SliceValues cuts down values held at each position of the line string
+// (such as heights) in the same way as Slice, interpolating them at the ends.
+func (ls LineString) SliceValues(values []float32, from, to float64) []float32 {
+	if len(ls) < 2 || len(values) != len(ls) {
+		return values
+	}
+	from, to = math.Max(0, from), math.Min(1, to)
+	lengths, total := ls.segmentLengths()
+
+	interpolate := func(i int, along float64) float32 {
+		t := 0.0
+		if lengths[i] > 0 {
+			t = along / lengths[i]
+		}
+		return values[i] + float32(t)*(values[i+1]-values[i])
+	}
+
+	start, end := from*total, to*total
+	sliced := make([]float32, 0)
+	travelled := 0.0
+	for i, length := range lengths {
+		last := i == len(lengths)-1
+		if len(sliced) == 0 && (start <= travelled+length || last) {
+			sliced = append(sliced, interpolate(i, math.Min(start-travelled, length)))
+		}
+		if len(sliced) > 0 {
+			if end <= travelled+length || last {
+				return append(sliced, interpolate(i, math.Min(end-travelled, length)))
+			}
+			sliced = append(sliced, values[i+1])
+		}
+		travelled += length
+	}
+	return sliced
+}
+
+// segmentLengths measures each segment of the line string, and their total,
+// in a local equirectangular plane (in degrees of latitude).
+func (ls LineString) segmentLengths() ([]float64, float64) {
+	scale := math.Cos(ls[0][1] * math.Pi / 180)
+	lengths := make([]float64, len(ls)-1)
+	total := 0.0
+	for i := 1; i < len(ls); i++ {
+		lengths[i-1] = math.Hypot((ls[i][0]-ls[i-1][0])*scale, ls[i][1]-ls[i-1][1])
+		total += lengths[i-1]
+	}
+	return lengths, total
+}
+
+const EARTH_RADIUS_M = 6_371_008.8
+
+// DistanceTo returns the great-circle (haversine) distance in metres.
+func (c Coordinate) DistanceTo(other Coordinate) float64 {
+	lat1, lat2 := c.Lat*math.Pi/180, other.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (other.Lon - c.Lon) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EARTH_RADIUS_M * math.Asin(math.Min(1, math.Sqrt(a)))
+}
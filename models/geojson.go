@@ -0,0 +1,34 @@
+package models
+
+// Root object of a GeoJSON (RFC 7946) document
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   GeoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+func NewFeatureCollection(features ...GeoJSONFeature) *GeoJSONFeatureCollection {
+	return &GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+func NewFeature(geometry GeoJSONGeometry, properties map[string]any) GeoJSONFeature {
+	return GeoJSONFeature{Type: "Feature", Geometry: geometry, Properties: properties}
+}
+
+func (ls LineString) AsGeoJSON() GeoJSONGeometry {
+	return GeoJSONGeometry{Type: "LineString", Coordinates: ls}
+}
+
+func (c Coordinate) AsGeoJSON() GeoJSONGeometry {
+	return GeoJSONGeometry{Type: "Point", Coordinates: [2]float64{c.Lon, c.Lat}}
+}
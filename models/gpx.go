@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/xml"
+)
+
+// Root element of a GPX 1.1 document, see https://www.topografix.com/GPX/1/1/
+type GPX struct {
+	XMLName   xml.Name    `xml:"gpx"`
+	Xmlns     string      `xml:"xmlns,attr"`
+	Version   string      `xml:"version,attr"`
+	Creator   string      `xml:"creator,attr"`
+	Metadata  GPXMetadata `xml:"metadata"`
+	Waypoints []GPXPoint  `xml:"wpt"`
+	Routes    []GPXRoute  `xml:"rte"`
+	Tracks    []GPXTrack  `xml:"trk"`
+}
+
+type GPXMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Desc string `xml:"desc,omitempty"`
+}
+
+// Used for wpt, rtept and trkpt elements alike
+type GPXPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Name string  `xml:"name,omitempty"`
+	Desc string  `xml:"desc,omitempty"`
+}
+
+type GPXRoute struct {
+	Name   string     `xml:"name,omitempty"`
+	Points []GPXPoint `xml:"rtept"`
+}
+
+type GPXTrack struct {
+	Name     string            `xml:"name,omitempty"`
+	Segments []GPXTrackSegment `xml:"trkseg"`
+}
+
+type GPXTrackSegment struct {
+	Points []GPXPoint `xml:"trkpt"`
+}
+
+func NewGPX() *GPX {
+	return &GPX{
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Creator: "route-planner",
+	}
+}
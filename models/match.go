@@ -0,0 +1,21 @@
+package models
+
+// A point of a GPS trace with the road link it was matched to, or no link if
+// there was no road nearby (or the trace could not be followed through it)
+type MatchedPoint struct {
+	Location Coordinate   `json:"location"`
+	Link     *SnappedLink `json:"link"`
+	// Posterior probability of the chosen link, given the whole trace
+	Confidence float64 `json:"confidence"`
+}
+
+// The most probable sequence of road links travelled along a GPS trace. The
+// geometry is a LineString, or a MultiLineString if the trace had gaps that
+// could not be matched across.
+type MatchResult struct {
+	Links      []string         `json:"links"`
+	DistanceM  float64          `json:"distance_m"`
+	Confidence float64          `json:"confidence"`
+	Points     []MatchedPoint   `json:"points"`
+	Geometry   *GeoJSONGeometry `json:"geometry"`
+}
@@ -0,0 +1,39 @@
+package models
+
+// A road node as loaded into the in-memory routing graph
+type NetworkNode struct {
+	ID       int64
+	GmlID    string
+	Location Coordinate
+}
+
+// A road link as loaded into the in-memory routing graph, with its ref-data
+// attributes as ids
+type NetworkLink struct {
+	ID                       int64
+	GmlID                    string
+	SourceID                 int64
+	TargetID                 int64
+	RoadClassificationID     int32
+	RoadFunctionID           int32
+	FormOfWayID              int32
+	RoadClassificationNumber *string
+	Name1                    *string
+	LengthM                  float64
+	DurationS                float64
+	PrimaryRoute             bool
+	TrunkRoad                bool
+	CenterLine               LineString
+	// Zero (and Elevations nil) if no elevations have been imported
+	AscentM     float64
+	DescentM    float64
+	MaxGradient float64
+	Elevations  []float32
+}
+
+// Ref-data tables referenced by the attributes of network links
+type NetworkRefData struct {
+	RoadClassifications []RefData
+	RoadFunctions       []RefData
+	FormOfWayTypes      []RefData
+}
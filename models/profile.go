@@ -0,0 +1,47 @@
+package models
+
+const (
+	METRIC_DISTANCE = "distance"
+	METRIC_DURATION = "duration"
+)
+
+// Routing profile, deriving the cost of each road link from its attributes.
+// Multipliers are keyed by ref-data value (e.g. "Motorway", "Slip Road") and
+// applied to the link length or duration, depending on the metric being
+// minimised; links matching any of the excluded values are never traversed.
+// Unset (zero) multipliers are treated as 1. Climb adds a cost (in metres or
+// seconds) for every metre climbed, where elevations have been imported; as
+// links are undirected, each is charged for half its ascent and descent.
+// SpeedMph, if set, replaces the speed model for walking or cycling: every
+// link is taken to be travelled at that speed.
+type Profile struct {
+	Name               string             `json:"name"`
+	Description        string             `json:"description,omitempty"`
+	Metric             string             `json:"metric,omitempty"`
+	SpeedMph           float64            `json:"speed_mph,omitempty"`
+	RoadClassification map[string]float64 `json:"road_classification,omitempty"`
+	RoadFunction       map[string]float64 `json:"road_function,omitempty"`
+	FormOfWay          map[string]float64 `json:"form_of_way,omitempty"`
+	PrimaryRoute       float64            `json:"primary_route,omitempty"`
+	TrunkRoad          float64            `json:"trunk_road,omitempty"`
+	Climb              float64            `json:"climb,omitempty"`
+	Exclude            ProfileExclusions  `json:"exclude,omitempty"`
+}
+
+// Links excluded by a profile. MaxGradient (a fraction, e.g. 0.1 for 10%)
+// excludes links any steeper, where elevations have been imported.
+type ProfileExclusions struct {
+	RoadClassification []string `json:"road_classification,omitempty"`
+	RoadFunction       []string `json:"road_function,omitempty"`
+	FormOfWay          []string `json:"form_of_way,omitempty"`
+	MaxGradient        float64  `json:"max_gradient,omitempty"`
+}
+
+// DurationSeconds returns the time taken to travel the given length (in
+// metres) at the profile's fixed speed, or false if it has none.
+func (profile *Profile) DurationSeconds(lengthM float64) (float64, bool) {
+	if profile.SpeedMph <= 0 {
+		return 0, false
+	}
+	return lengthM / (profile.SpeedMph * MPH_TO_METRES_PER_SECOND), true
+}
@@ -0,0 +1,22 @@
+package models
+
+// A road found by name or number: the matching links that lie close
+// together, merged into one geometry
+type Road struct {
+	Name1                    *string         `json:"name1"`
+	RoadClassificationNumber *string         `json:"road_classification_number"`
+	Similarity               float64         `json:"similarity"`
+	Links                    int             `json:"links"`
+	LengthM                  float64         `json:"length_m"`
+	Bounds                   BoundingBox     `json:"bounds"`
+	Geometry                 GeoJSONGeometry `json:"geometry"`
+}
+
+// A numbered motorway junction, with the road node closest to it
+type Junction struct {
+	GmlID                    string     `json:"gml_id"`
+	RoadClassificationNumber *string    `json:"road_classification_number"`
+	JunctionNumber           string     `json:"junction_number"`
+	Location                 Coordinate `json:"location"`
+	Node                     *string    `json:"node"`
+}
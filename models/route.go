@@ -0,0 +1,142 @@
+package models
+
+// A road node that a requested coordinate was snapped to
+type SnappedNode struct {
+	ID        int64      `json:"-"`
+	GmlID     string     `json:"gml_id"`
+	Location  Coordinate `json:"location"`
+	DistanceM float64    `json:"distance_m"`
+}
+
+// A road link that a requested coordinate was snapped to, along with the
+// projected point on its centre line
+type SnappedLink struct {
+	ID                       int64      `json:"-"`
+	GmlID                    string     `json:"gml_id"`
+	Name1                    *string    `json:"name1"`
+	RoadClassificationNumber *string    `json:"road_classification_number"`
+	Point                    Coordinate `json:"point"`
+	Fraction                 float64    `json:"fraction"`
+	DistanceM                float64    `json:"distance_m"`
+}
+
+// A single road link traversed by a path, in travel order
+type PathSegment struct {
+	LinkID    int64   `json:"-"`
+	GmlID     string  `json:"gml_id"`
+	LengthM   float64 `json:"length_m"`
+	DurationS float64 `json:"duration_s"`
+	Forward   bool    `json:"forward"`
+	// Set when only part of the link is traversed, at the start or end of a
+	// path
+	Portion *LinkPortion `json:"portion,omitempty"`
+}
+
+// The part of a link traversed by a path, as fractions along its centre
+// line (0.0 = start node, 1.0 = end node), in travel order
+type LinkPortion struct {
+	From float64 `json:"from"`
+	To   float64 `json:"to"`
+}
+
+// A traversed road link with its attributes decoded from the ref-data
+// tables, and its centre line oriented in the direction of travel
+type RouteLink struct {
+	ID                            int64      `json:"-"`
+	GmlID                         string     `json:"gml_id"`
+	Name1                         *string    `json:"name1"`
+	RoadClassificationNumber      *string    `json:"road_classification_number"`
+	RoadClassification            string     `json:"road_classification"`
+	RoadClassificationDescription *string    `json:"road_classification_description"`
+	RoadFunction                  string     `json:"road_function"`
+	RoadFunctionDescription       *string    `json:"road_function_description"`
+	FormOfWay                     string     `json:"form_of_way"`
+	FormOfWayDescription          *string    `json:"form_of_way_description"`
+	LengthM                       float64    `json:"length_m"`
+	DurationS                     float64    `json:"duration_s"`
+	PrimaryRoute                  bool       `json:"primary_route"`
+	TrunkRoad                     bool       `json:"trunk_road"`
+	CenterLine                    LineString `json:"-"`
+	// Height at each position of the centre line, if imported
+	Elevations []float32 `json:"-"`
+	// For roundabout links, the number of links leaving the roundabout at
+	// each end (in travel order once the route is assembled)
+	StartExits int `json:"-"`
+	EndExits   int `json:"-"`
+}
+
+// A single turn-by-turn manoeuvre, covering the distance travelled until
+// the next instruction
+type Instruction struct {
+	Type      string     `json:"type"`
+	Text      string     `json:"text"`
+	Road      string     `json:"road,omitempty"`
+	FormOfWay string     `json:"form_of_way,omitempty"`
+	Exit      int        `json:"exit,omitempty"`
+	DistanceM float64    `json:"distance_m"`
+	DurationS float64    `json:"duration_s"`
+	Location  Coordinate `json:"location"`
+}
+
+// Part of a route between two consecutive waypoints
+type RouteLeg struct {
+	From      *SnappedLink  `json:"from"`
+	To        *SnappedLink  `json:"to"`
+	DistanceM float64       `json:"distance_m"`
+	DurationS float64       `json:"duration_s"`
+	Links     []string      `json:"links"`
+	Path      []PathSegment `json:"-"`
+}
+
+// Route between points snapped onto road links, passing through any via
+// points in order.
+// Links and Path cover the whole route, stitched together from each leg.
+type Route struct {
+	Profile      string           `json:"profile"`
+	Minimise     string           `json:"minimise"`
+	From         *SnappedLink     `json:"from"`
+	Via          []*SnappedLink   `json:"via,omitempty"`
+	To           *SnappedLink     `json:"to"`
+	DistanceM    float64          `json:"distance_m"`
+	DurationS    float64          `json:"duration_s"`
+	Links        []string         `json:"links"`
+	Legs         []RouteLeg       `json:"legs"`
+	Instructions []Instruction    `json:"instructions,omitempty"`
+	Geometry     *GeoJSONGeometry `json:"geometry,omitempty"`
+	Elevation    *RouteElevation  `json:"elevation,omitempty"`
+	Alternatives []*Route         `json:"alternatives,omitempty"`
+	Path         []PathSegment    `json:"-"`
+}
+
+// Route visiting a set of stops in the optimal order. Order holds the
+// (zero-based) index of each requested stop, in visiting order.
+type OptimisedRoute struct {
+	Order []int  `json:"order"`
+	Route *Route `json:"route"`
+}
+
+// Area reachable from an origin within a distance or duration budget.
+// Reached counts the nodes (for hulls) or links (for buffers) it covers.
+type Isochrone struct {
+	Budget   float64
+	Reached  int
+	Geometry GeoJSONGeometry
+}
+
+type MatrixRequest struct {
+	Origins      []Coordinate `json:"origins"`
+	Destinations []Coordinate `json:"destinations"`
+	Profile      string       `json:"profile"`
+	Minimise     string       `json:"minimise"`
+}
+
+// Network distances and durations from each origin (row) to each
+// destination (column). Unreachable pairs are null.
+type Matrix struct {
+	Profile      string         `json:"profile"`
+	Minimise     string         `json:"minimise"`
+	Origins      []*SnappedNode `json:"origins"`
+	Destinations []*SnappedNode `json:"destinations"`
+	DistancesM   [][]*float64   `json:"distances_m"`
+	DurationsS   [][]*float64   `json:"durations_s"`
+}
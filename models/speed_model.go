@@ -0,0 +1,65 @@
+package models
+
+const MPH_TO_METRES_PER_SECOND = 0.44704
+
+// Average speeds (in mph) used to estimate the time taken to drive along a
+// road link. The speed is looked up by road classification, depending on
+// whether the link is a single or dual carriageway; some forms of way (slip
+// roads, roundabouts, etc) then cap the speed regardless of classification.
+type SpeedModel struct {
+	RoadClassification map[string]CarriagewaySpeeds
+	FormOfWayLimits    map[string]float64
+	DefaultMph         float64
+}
+
+type CarriagewaySpeeds struct {
+	SingleMph float64
+	DualMph   float64
+}
+
+var DefaultSpeedModel = SpeedModel{
+	RoadClassification: map[string]CarriagewaySpeeds{
+		"Motorway":              {SingleMph: 70, DualMph: 70},
+		"A Road":                {SingleMph: 50, DualMph: 65},
+		"B Road":                {SingleMph: 40, DualMph: 50},
+		"Classified Unnumbered": {SingleMph: 35, DualMph: 45},
+		"Unclassified":          {SingleMph: 30, DualMph: 40},
+		"Not Classified":        {SingleMph: 20, DualMph: 30},
+		"Unknown":               {SingleMph: 20, DualMph: 30},
+	},
+	FormOfWayLimits: map[string]float64{
+		"Slip Road":                       30,
+		"Roundabout":                      15,
+		"Traffic Island Link At Junction": 15,
+		"Traffic Island Link":             20,
+		"Shared Use Carriageway":          15,
+		"Guided Busway":                   20,
+		"Enclosed Traffic Area":           10,
+		"Layby":                           10,
+		"Track":                           10,
+	},
+	DefaultMph: 20,
+}
+
+// SpeedMph returns the average speed for a link with the given road
+// classification and form of way ref-data values.
+func (model SpeedModel) SpeedMph(roadClassification string, formOfWay string) float64 {
+	speed := model.DefaultMph
+	if speeds, ok := model.RoadClassification[roadClassification]; ok {
+		speed = speeds.SingleMph
+		if formOfWay == "Dual Carriageway" || formOfWay == "Collapsed Dual Carriageway" {
+			speed = speeds.DualMph
+		}
+	}
+
+	if limit, ok := model.FormOfWayLimits[formOfWay]; ok && limit < speed {
+		speed = limit
+	}
+	return speed
+}
+
+// DurationSeconds estimates the time taken to travel the given length (in
+// metres) along a link.
+func (model SpeedModel) DurationSeconds(lengthM float64, roadClassification string, formOfWay string) float64 {
+	return lengthM / (model.SpeedMph(roadClassification, formOfWay) * MPH_TO_METRES_PER_SECOND)
+}
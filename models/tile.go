@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Highest zoom level that tiles are served at
+const MAX_TILE_ZOOM = 20
+
+// A tile in the (XYZ) web mercator tiling scheme
+type TileCoord struct {
+	Z int
+	X int
+	Y int
+}
+
+func (t TileCoord) Validate() error {
+	if t.Z < 0 || t.Z > MAX_TILE_ZOOM {
+		return fmt.Errorf("zoom must be between 0 and %d", MAX_TILE_ZOOM)
+	}
+	if n := 1 << t.Z; t.X < 0 || t.X >= n || t.Y < 0 || t.Y >= n {
+		return fmt.Errorf("tile %s is out of range", t)
+	}
+	return nil
+}
+
+func (t TileCoord) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y)
+}
+
+// TileAt returns the tile at zoom level z containing the coordinate.
+func TileAt(coord Coordinate, z int) TileCoord {
+	n := 1 << z
+	lat := coord.Lat * math.Pi / 180
+	x := int(math.Floor((coord.Lon + 180) / 360 * float64(n)))
+	y := int(math.Floor((1 - math.Asinh(math.Tan(lat))/math.Pi) / 2 * float64(n)))
+	return TileCoord{Z: z, X: min(max(x, 0), n-1), Y: min(max(y, 0), n-1)}
+}
+
+// TilesIn calls fn for every tile at zoom level z that overlaps the
+// bounding box.
+func TilesIn(bounds BoundingBox, z int, fn func(tile TileCoord) error) error {
+	topLeft := TileAt(Coordinate{Lat: bounds.MaxLat, Lon: bounds.MinLon}, z)
+	bottomRight := TileAt(Coordinate{Lat: bounds.MinLat, Lon: bounds.MaxLon}, z)
+	for x := topLeft.X; x <= bottomRight.X; x++ {
+		for y := topLeft.Y; y <= bottomRight.Y; y++ {
+			if err := fn(TileCoord{Z: z, X: x, Y: y}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Largest gradient the max_gradient NUMERIC(5,3) column can hold. Steeper
+// gradients only come from noise in the model over very short links.
+const MAX_STORED_GRADIENT = 99.999
+
+type ElevationRepository interface {
+	StreamLinkGeometries(ctx context.Context, fn func(id int64, line models.LineString) error) error
+	StoreLinkElevations(ctx context.Context, elevations ...models.LinkElevation) error
+}
+
+type ElevationRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewElevationRepository(pool *pgxpool.Pool) *ElevationRepositoryImpl {
+	return &ElevationRepositoryImpl{pool: pool}
+}
+
+// StreamLinkGeometries calls fn with the centre line of every road link, in
+// British National Grid coordinates (EPSG:27700) to match the OS elevation
+// models.
+func (repo *ElevationRepositoryImpl) StreamLinkGeometries(ctx context.Context, fn func(id int64, line models.LineString) error) error {
+	rows, err := repo.pool.Query(ctx, `SELECT id, ST_AsBinary(ST_Transform(center_line, 27700)) FROM road_links ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to fetch road links: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var wkb []byte
+		if err := rows.Scan(&id, &wkb); err != nil {
+			return fmt.Errorf("failed to scan road link: %v", err)
+		}
+
+		line, err := parseWkbLineString(wkb)
+		if err != nil {
+			return fmt.Errorf("failed to decode center line of link %d: %v", id, err)
+		}
+		if err := fn(id, line); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (repo *ElevationRepositoryImpl) StoreLinkElevations(ctx context.Context, elevations ...models.LinkElevation) error {
+	sql := `
+		UPDATE road_links SET ascent_m = $2, descent_m = $3, max_gradient = $4, elevations = $5
+		WHERE id = $1
+	`
+
+	batch := &pgx.Batch{}
+
+	for _, elevation := range elevations {
+		maxGradient := math.Min(elevation.MaxGradient, MAX_STORED_GRADIENT)
+		batch.Queue(sql, elevation.LinkID, elevation.AscentM, elevation.DescentM, maxGradient, elevation.Elevations)
+	}
+
+	results := repo.pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	// Ensure all queries in the batch succeed
+	for i := range batch.Len() {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("batch update on road_links failed at query %d (id=%d): %v", i, elevations[i].LinkID, err)
+		}
+	}
+
+	return nil
+}
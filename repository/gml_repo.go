@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -115,10 +116,10 @@ func (repo *GmlRepositoryImpl) StoreRoadLinks(ctx context.Context, roadLinks ...
 	sql := `
 		INSERT INTO road_links (
 			id, source_id, target_id, gml_id, center_line, start_node_id, end_node_id, road_classification_id, road_function_id,
-			form_of_way_id, road_classification_number, name1, length_m, loop, primary_route, trunk_road)
+			form_of_way_id, road_classification_number, name1, length_m, loop, primary_route, trunk_road, duration_s)
 		VALUES (
 			$1, $2, $3, $4, ST_Transform(ST_SetSRID(ST_GeomFromText($5), 27700), 4326), $6, $7, $8, $9,
-			$10, $11, $12, $13, $14, $15, $16
+			$10, $11, $12, $13, $14, $15, $16, $17
 		)
 		ON CONFLICT (id) DO UPDATE SET
 			source_id = EXCLUDED.source_id, target_id = EXCLUDED.target_id, gml_id = EXCLUDED.gml_id,
@@ -126,12 +127,13 @@ func (repo *GmlRepositoryImpl) StoreRoadLinks(ctx context.Context, roadLinks ...
 			road_classification_id = EXCLUDED.road_classification_id, road_function_id = EXCLUDED.road_function_id,
 			form_of_way_id = EXCLUDED.form_of_way_id, road_classification_number = EXCLUDED.road_classification_number,
 			name1 = EXCLUDED.name1, length_m = EXCLUDED.length_m, loop = EXCLUDED.loop, primary_route = EXCLUDED.primary_route,
-			trunk_road = EXCLUDED.trunk_road;
+			trunk_road = EXCLUDED.trunk_road, duration_s = EXCLUDED.duration_s;
 	`
 
 	batch := &pgx.Batch{}
 
 	for _, roadLink := range roadLinks {
+		length := roadLink.Length.ConvertTo("m")
 
 		batch.Queue(sql,
 			hash(roadLink.ID),
@@ -146,10 +148,11 @@ func (repo *GmlRepositoryImpl) StoreRoadLinks(ctx context.Context, roadLinks ...
 			repo.formOfWayTypes[roadLink.FormOfWay.Value].ID,
 			roadLink.RoadClassificationNumber,
 			roadLink.Name1,
-			roadLink.Length.ConvertTo("m"),
+			length,
 			roadLink.Loop,
 			roadLink.PrimaryRoute,
 			roadLink.TrunkRoad,
+			models.DefaultSpeedModel.DurationSeconds(length, roadLink.RoadClassification.Value, roadLink.FormOfWay.Value),
 		)
 	}
 
@@ -166,7 +169,97 @@ func (repo *GmlRepositoryImpl) StoreRoadLinks(ctx context.Context, roadLinks ...
 	return nil
 }
 
+// UpdateDurations recalculates duration_s for every road link from the speed
+// model, e.g. for links imported before durations were stored.
+func (repo *GmlRepositoryImpl) UpdateDurations(ctx context.Context, model models.SpeedModel) (int64, error) {
+	sql := `
+		UPDATE road_links l SET duration_s = l.length_m / s.speed
+		FROM unnest($1::int[], $2::int[], $3::float8[]) AS s(road_classification_id, form_of_way_id, speed)
+		WHERE l.road_classification_id = s.road_classification_id AND l.form_of_way_id = s.form_of_way_id
+	`
+
+	classificationIds := make([]int32, 0)
+	formOfWayIds := make([]int32, 0)
+	speeds := make([]float64, 0)
+	for _, classification := range repo.roadClassifications {
+		for _, formOfWay := range repo.formOfWayTypes {
+			classificationIds = append(classificationIds, classification.ID)
+			formOfWayIds = append(formOfWayIds, formOfWay.ID)
+			speeds = append(speeds, model.SpeedMph(classification.Value, formOfWay.Value)*models.MPH_TO_METRES_PER_SECOND)
+		}
+	}
+
+	tag, err := repo.pool.Exec(ctx, sql, classificationIds, formOfWayIds, speeds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update durations: %v", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Subqueries for the road node closest to a junction, and the number of the
+// motorway nearest to it (which the junction features do not carry). Only
+// one motorway is kept, as the junction number belongs to just one of the
+// motorways that meet at an interchange; where several are equally near,
+// such as when their links share the junction's node, the lowest numbered
+// (M4 before M25) is chosen.
+const junctionNodeSql = `(SELECT n.id FROM road_nodes n ORDER BY n.location <-> %[1]s LIMIT 1)`
+const junctionRoadSql = `(
+	SELECT l.road_classification_number
+	FROM road_links l
+	JOIN road_classifications rc ON rc.id = l.road_classification_id
+	WHERE rc.value = 'Motorway' AND l.road_classification_number IS NOT NULL
+	ORDER BY l.center_line <-> %[1]s, length(l.road_classification_number), l.road_classification_number
+	LIMIT 1
+)`
+
+// StoreMotorwayJunctions upserts the junctions. Their nearest road node and
+// motorway are filled in by LinkMotorwayJunctions once the whole road
+// network has been imported.
 func (repo *GmlRepositoryImpl) StoreMotorwayJunctions(ctx context.Context, motorwayJunctions ...models.MotorwayJunction) error {
-	// panic("not implemented")
+	sql := `
+		INSERT INTO motorway_junctions (id, gml_id, junction_number, location)
+		VALUES ($1, $2, $3, ST_Transform(ST_SetSRID(ST_GeomFromText($4), 27700), 4326))
+		ON CONFLICT (id) DO UPDATE SET
+			junction_number = EXCLUDED.junction_number, location = EXCLUDED.location;
+	`
+
+	batch := &pgx.Batch{}
+
+	for _, junction := range motorwayJunctions {
+		batch.Queue(sql,
+			hash(junction.ID),
+			junction.ID,
+			strings.TrimSpace(junction.JunctionNumber),
+			junction.Geometry.AsPoint(),
+		)
+	}
+
+	results := repo.pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	// Ensure all queries in the batch succeed
+	for i := range batch.Len() {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("batch insert on motorway_junctions failed at query %d (gml:id=%s): %v", i, motorwayJunctions[i].ID, err)
+		}
+	}
+
 	return nil
 }
+
+// LinkMotorwayJunctions (re)computes the nearest road node and motorway of
+// every junction. It must run after all road nodes and links are stored, as
+// a partly imported network would give the wrong matches.
+func (repo *GmlRepositoryImpl) LinkMotorwayJunctions(ctx context.Context) (int64, error) {
+	sql := fmt.Sprintf(`
+		UPDATE motorway_junctions j SET
+			road_node_id = %s,
+			road_classification_number = %s
+	`, fmt.Sprintf(junctionNodeSql, "j.location"), fmt.Sprintf(junctionRoadSql, "j.location"))
+
+	tag, err := repo.pool.Exec(ctx, sql)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update motorway_junctions: %v", err)
+	}
+	return tag.RowsAffected(), nil
+}
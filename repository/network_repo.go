@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rm-hull/route-planner/models"
+)
+
+// WKB geometry type code for a 2D LineString
+const WKB_LINESTRING = 2
+
+type NetworkRepository interface {
+	StreamNodes(ctx context.Context, region *models.BoundingBox, fn func(node models.NetworkNode) error) error
+	StreamLinks(ctx context.Context, region *models.BoundingBox, fn func(link models.NetworkLink) error) error
+	FetchRefData(ctx context.Context) (*models.NetworkRefData, error)
+}
+
+type NetworkRepositoryImpl struct {
+	pool *pgxpool.Pool
+}
+
+func NewNetworkRepository(pool *pgxpool.Pool) *NetworkRepositoryImpl {
+	return &NetworkRepositoryImpl{pool: pool}
+}
+
+// StreamNodes calls fn for every road node in id order, without holding them
+// all in memory at once. If a region is given, only the nodes at either end
+// of the links passing through it are streamed.
+func (repo *NetworkRepositoryImpl) StreamNodes(ctx context.Context, region *models.BoundingBox, fn func(node models.NetworkNode) error) error {
+	sql := `SELECT id, gml_id, ST_Y(location), ST_X(location) FROM road_nodes ORDER BY id`
+	args := []any{}
+	if region != nil {
+		sql = `
+			SELECT id, gml_id, ST_Y(location), ST_X(location)
+			FROM road_nodes
+			WHERE id IN (
+				SELECT source_id FROM road_links WHERE center_line && ST_MakeEnvelope($1, $2, $3, $4, 4326)
+				UNION
+				SELECT target_id FROM road_links WHERE center_line && ST_MakeEnvelope($1, $2, $3, $4, 4326)
+			)
+			ORDER BY id
+		`
+		args = regionArgs(region)
+	}
+
+	rows, err := repo.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch road nodes: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var node models.NetworkNode
+		if err := rows.Scan(&node.ID, &node.GmlID, &node.Location.Lat, &node.Location.Lon); err != nil {
+			return fmt.Errorf("failed to scan road node: %v", err)
+		}
+		if err := fn(node); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// StreamLinks calls fn for every road link in id order, without holding them
+// all in memory at once. The order is stable, so that graphs built from the
+// same data are identical. If a region is given, only the links passing
+// through it are streamed.
+func (repo *NetworkRepositoryImpl) StreamLinks(ctx context.Context, region *models.BoundingBox, fn func(link models.NetworkLink) error) error {
+	where := ""
+	args := []any{}
+	if region != nil {
+		where = "WHERE center_line && ST_MakeEnvelope($1, $2, $3, $4, 4326)"
+		args = regionArgs(region)
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT id, gml_id, source_id, target_id, road_classification_id, road_function_id, form_of_way_id,
+			road_classification_number, name1, length_m::float8, COALESCE(duration_s, 0)::float8,
+			COALESCE(primary_route, false), COALESCE(trunk_road, false), ST_AsBinary(center_line),
+			COALESCE(ascent_m, 0)::float8, COALESCE(descent_m, 0)::float8, COALESCE(max_gradient, 0)::float8, elevations
+		FROM road_links
+		%s
+		ORDER BY id
+	`, where)
+
+	rows, err := repo.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch road links: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link models.NetworkLink
+		var wkb []byte
+		err := rows.Scan(&link.ID, &link.GmlID, &link.SourceID, &link.TargetID,
+			&link.RoadClassificationID, &link.RoadFunctionID, &link.FormOfWayID,
+			&link.RoadClassificationNumber, &link.Name1, &link.LengthM, &link.DurationS,
+			&link.PrimaryRoute, &link.TrunkRoad, &wkb,
+			&link.AscentM, &link.DescentM, &link.MaxGradient, &link.Elevations)
+		if err != nil {
+			return fmt.Errorf("failed to scan road link: %v", err)
+		}
+
+		if link.CenterLine, err = parseWkbLineString(wkb); err != nil {
+			return fmt.Errorf("failed to decode center line for %s: %v", link.GmlID, err)
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func regionArgs(region *models.BoundingBox) []any {
+	return []any{region.MinLon, region.MinLat, region.MaxLon, region.MaxLat}
+}
+
+// FetchRefData loads the ref-data tables that road link attributes refer to.
+func (repo *NetworkRepositoryImpl) FetchRefData(ctx context.Context) (*models.NetworkRefData, error) {
+	tables := map[string]*map[string]models.RefData{}
+	for _, tableName := range []string{"road_classifications", "road_functions", "form_of_way_types"} {
+		refData, err := NewRefDataRepository(repo.pool, tableName).FetchAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %s: %v", tableName, err)
+		}
+		tables[tableName] = refData
+	}
+
+	return &models.NetworkRefData{
+		RoadClassifications: values(*tables["road_classifications"]),
+		RoadFunctions:       values(*tables["road_functions"]),
+		FormOfWayTypes:      values(*tables["form_of_way_types"]),
+	}, nil
+}
+
+func values(refData map[string]models.RefData) []models.RefData {
+	results := make([]models.RefData, 0, len(refData))
+	for _, entry := range refData {
+		results = append(results, entry)
+	}
+	return results
+}
+
+// parseWkbLineString decodes a 2D LineString from its well-known binary
+// representation, as returned by ST_AsBinary.
+func parseWkbLineString(wkb []byte) (models.LineString, error) {
+	if len(wkb) < 9 {
+		return nil, fmt.Errorf("WKB too short: %d bytes", len(wkb))
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if wkb[0] == 0 {
+		order = binary.BigEndian
+	}
+
+	if geomType := order.Uint32(wkb[1:5]); geomType != WKB_LINESTRING {
+		return nil, fmt.Errorf("expected WKB LineString, got type %d", geomType)
+	}
+
+	count := int(order.Uint32(wkb[5:9]))
+	if len(wkb) != 9+count*16 {
+		return nil, fmt.Errorf("WKB length %d does not match %d points", len(wkb), count)
+	}
+
+	line := make(models.LineString, count)
+	for i := range line {
+		offset := 9 + i*16
+		line[i][0] = math.Float64frombits(order.Uint64(wkb[offset : offset+8]))
+		line[i][1] = math.Float64frombits(order.Uint64(wkb[offset+8 : offset+16]))
+	}
+	return line, nil
+}
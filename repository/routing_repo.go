@@ -0,0 +1,989 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Minimum margin (in degrees) added around the start/end envelope when
+// selecting the edges handed to pgRouting.
+const SEARCH_MARGIN_DEGREES = 0.05
+
+// Approximate length of one degree of latitude
+const METRES_PER_DEGREE = 111_320.0
+
+// Ratio passed to ST_ConcaveHull for isochrone polygons (1.0 would give the
+// convex hull)
+const CONCAVE_HULL_RATIO = 0.3
+
+// Distance (in metres) that reached links are buffered by to form isochrone
+// polygons
+const ISOCHRONE_BUFFER_M = 50
+
+// Number of index-ordered candidates that are re-ranked by their true
+// (geodesic) distance when snapping.
+const SNAP_CANDIDATES = 10
+
+// Maximum gap (in degrees) between links of the same name or number for
+// them to be merged into one road in search results
+const ROAD_CLUSTER_DEGREES = 0.002
+
+var ErrNoNodeFound = errors.New("no road node found")
+var ErrNoLinkFound = errors.New("no road link found")
+
+type RoutingRepository interface {
+	NearestNode(ctx context.Context, coord models.Coordinate) (*models.SnappedNode, error)
+	NearestLink(ctx context.Context, coord models.Coordinate) (*models.SnappedLink, error)
+	NearestLinks(ctx context.Context, coords []models.Coordinate, profile *models.Profile, avoid *models.Avoid) ([]*models.SnappedLink, error)
+	NearestLinkNodes(ctx context.Context, coords []models.Coordinate, profile *models.Profile) ([]*models.SnappedNode, error)
+	NearestNamedLink(ctx context.Context, coord models.Coordinate) (*models.SnappedLink, error)
+	ShortestPath(ctx context.Context, from, to *models.SnappedLink, profile *models.Profile, opts models.PathOptions) ([]models.PathSegment, error)
+	CostMatrix(ctx context.Context, nodes []*models.SnappedNode, profile *models.Profile) ([][]float64, error)
+	DistanceMatrix(ctx context.Context, origins, destinations []*models.SnappedNode, profile *models.Profile) ([][]float64, [][]float64, error)
+	SearchRoads(ctx context.Context, query string, limit int) ([]models.Road, error)
+	FindJunctions(ctx context.Context, road string, number string) ([]models.Junction, error)
+	Isochrones(ctx context.Context, origin *models.SnappedNode, budgets []float64, radiusM float64, shape string, profile *models.Profile) ([]models.Isochrone, error)
+	FetchRouteLinks(ctx context.Context, ids []int64) (map[int64]models.RouteLink, error)
+}
+
+type RoutingRepositoryImpl struct {
+	pool                *pgxpool.Pool
+	roadClassifications map[string]models.RefData
+	roadFunctions       map[string]models.RefData
+	formOfWayTypes      map[string]models.RefData
+}
+
+func NewRoutingRepository(pool *pgxpool.Pool) (*RoutingRepositoryImpl, error) {
+	ctx := context.Background()
+	roadClassifications, err := NewRefDataRepository(pool, "road_classifications").FetchAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching road_classifications: %v", err)
+	}
+
+	roadFunctions, err := NewRefDataRepository(pool, "road_functions").FetchAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching road_functions: %v", err)
+	}
+
+	formOfWayTypes, err := NewRefDataRepository(pool, "form_of_way_types").FetchAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching form_of_way_types: %v", err)
+	}
+
+	return &RoutingRepositoryImpl{
+		pool:                pool,
+		roadClassifications: *roadClassifications,
+		roadFunctions:       *roadFunctions,
+		formOfWayTypes:      *formOfWayTypes,
+	}, nil
+}
+
+func (repo *RoutingRepositoryImpl) NearestNode(ctx context.Context, coord models.Coordinate) (*models.SnappedNode, error) {
+	sql := `
+		SELECT id, gml_id, ST_Y(location), ST_X(location),
+			ST_Distance(location::geography, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography)
+		FROM road_nodes
+		ORDER BY location <-> ST_SetSRID(ST_MakePoint($1, $2), 4326)
+		LIMIT 1
+	`
+
+	var node models.SnappedNode
+	err := repo.pool.QueryRow(ctx, sql, coord.Lon, coord.Lat).Scan(
+		&node.ID, &node.GmlID, &node.Location.Lat, &node.Location.Lon, &node.DistanceM)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoNodeFound
+		}
+		return nil, fmt.Errorf("failed to find nearest node: %v", err)
+	}
+
+	return &node, nil
+}
+
+// NearestLink finds the road link whose centre line passes closest to the
+// coordinate, returning the projected point and how far along the link
+// (0.0 = start node, 1.0 = end node) it lies.
+func (repo *RoutingRepositoryImpl) NearestLink(ctx context.Context, coord models.Coordinate) (*models.SnappedLink, error) {
+	sql := `
+		WITH pt AS (SELECT ST_SetSRID(ST_MakePoint($1, $2), 4326) AS geom),
+		candidates AS (
+			SELECT l.id, l.gml_id, l.name1, l.road_classification_number, l.center_line
+			FROM road_links l, pt
+			ORDER BY l.center_line <-> pt.geom
+			LIMIT $3
+		)
+		SELECT c.id, c.gml_id, c.name1, c.road_classification_number,
+			ST_Y(ST_ClosestPoint(c.center_line, pt.geom)), ST_X(ST_ClosestPoint(c.center_line, pt.geom)),
+			ST_LineLocatePoint(c.center_line, pt.geom),
+			ST_Distance(c.center_line::geography, pt.geom::geography) AS distance
+		FROM candidates c, pt
+		ORDER BY distance
+		LIMIT 1
+	`
+
+	var link models.SnappedLink
+	err := repo.pool.QueryRow(ctx, sql, coord.Lon, coord.Lat, SNAP_CANDIDATES).Scan(
+		&link.ID, &link.GmlID, &link.Name1, &link.RoadClassificationNumber,
+		&link.Point.Lat, &link.Point.Lon, &link.Fraction, &link.DistanceM)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoLinkFound
+		}
+		return nil, fmt.Errorf("failed to find nearest link: %v", err)
+	}
+
+	return &link, nil
+}
+
+// NearestNamedLink is NearestLink restricted to the links that have a road
+// name or number.
+func (repo *RoutingRepositoryImpl) NearestNamedLink(ctx context.Context, coord models.Coordinate) (*models.SnappedLink, error) {
+	sql := `
+		WITH pt AS (SELECT ST_SetSRID(ST_MakePoint($1, $2), 4326) AS geom),
+		candidates AS (
+			SELECT l.id, l.gml_id, l.name1, l.road_classification_number, l.center_line
+			FROM road_links l, pt
+			WHERE l.name1 IS NOT NULL OR l.road_classification_number IS NOT NULL
+			ORDER BY l.center_line <-> pt.geom
+			LIMIT $3
+		)
+		SELECT c.id, c.gml_id, c.name1, c.road_classification_number,
+			ST_Y(ST_ClosestPoint(c.center_line, pt.geom)), ST_X(ST_ClosestPoint(c.center_line, pt.geom)),
+			ST_LineLocatePoint(c.center_line, pt.geom),
+			ST_Distance(c.center_line::geography, pt.geom::geography) AS distance
+		FROM candidates c, pt
+		ORDER BY distance
+		LIMIT 1
+	`
+
+	var link models.SnappedLink
+	err := repo.pool.QueryRow(ctx, sql, coord.Lon, coord.Lat, SNAP_CANDIDATES).Scan(
+		&link.ID, &link.GmlID, &link.Name1, &link.RoadClassificationNumber,
+		&link.Point.Lat, &link.Point.Lon, &link.Fraction, &link.DistanceM)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoLinkFound
+		}
+		return nil, fmt.Errorf("failed to find nearest named link: %v", err)
+	}
+
+	return &link, nil
+}
+
+// NearestLinks snaps many coordinates at once onto the closest road link
+// that the profile allows and is not avoided (which may be nil), returning
+// them in the same order. As with
+// NearestLink, the nearest few links by index order are re-ranked by their
+// true distance.
+func (repo *RoutingRepositoryImpl) NearestLinks(ctx context.Context, coords []models.Coordinate, profile *models.Profile, avoid *models.Avoid) ([]*models.SnappedLink, error) {
+	exclusions, err := repo.exclusionsSql(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	lons := make([]float64, len(coords))
+	lats := make([]float64, len(coords))
+	for i, coord := range coords {
+		lons[i], lats[i] = coord.Lon, coord.Lat
+	}
+	args := []any{lons, lats, SNAP_CANDIDATES}
+	if !avoid.IsEmpty() {
+		exclusions += avoidSql(avoid, "$4")
+		args = append(args, avoid.Links)
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT p.ord, c.id, c.gml_id, c.name1, c.road_classification_number,
+			ST_Y(ST_ClosestPoint(c.center_line, pt.geom)), ST_X(ST_ClosestPoint(c.center_line, pt.geom)),
+			ST_LineLocatePoint(c.center_line, pt.geom), c.distance
+		FROM unnest($1::float8[], $2::float8[]) WITH ORDINALITY AS p(lon, lat, ord)
+		CROSS JOIN LATERAL (SELECT ST_SetSRID(ST_MakePoint(p.lon, p.lat), 4326) AS geom) pt
+		CROSS JOIN LATERAL (
+			SELECT l.*, ST_Distance(l.center_line::geography, pt.geom::geography) AS distance
+			FROM (
+				SELECT id, gml_id, name1, road_classification_number, center_line
+				FROM road_links
+				WHERE TRUE%s
+				ORDER BY center_line <-> pt.geom
+				LIMIT $3
+			) l
+			ORDER BY distance
+			LIMIT 1
+		) c
+	`, exclusions)
+
+	rows, err := repo.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find nearest links: %v", err)
+	}
+	defer rows.Close()
+
+	links := make([]*models.SnappedLink, len(coords))
+	for rows.Next() {
+		var ord int
+		var link models.SnappedLink
+		err := rows.Scan(&ord, &link.ID, &link.GmlID, &link.Name1, &link.RoadClassificationNumber,
+			&link.Point.Lat, &link.Point.Lon, &link.Fraction, &link.DistanceM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan nearest link: %v", err)
+		}
+		links[ord-1] = &link
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		if link == nil {
+			return nil, ErrNoLinkFound
+		}
+	}
+	return links, nil
+}
+
+// NearestLinkNodes snaps many coordinates at once onto the closest road link
+// that the profile allows, as NearestLinks does, and returns the end of that
+// link nearer the snapped point for each coordinate in the same order.
+func (repo *RoutingRepositoryImpl) NearestLinkNodes(ctx context.Context, coords []models.Coordinate, profile *models.Profile) ([]*models.SnappedNode, error) {
+	exclusions, err := repo.exclusionsSql(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	lons := make([]float64, len(coords))
+	lats := make([]float64, len(coords))
+	for i, coord := range coords {
+		lons[i], lats[i] = coord.Lon, coord.Lat
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT p.ord, n.id, n.gml_id, ST_Y(n.location), ST_X(n.location),
+			ST_Distance(n.location::geography, pt.geom::geography)
+		FROM unnest($1::float8[], $2::float8[]) WITH ORDINALITY AS p(lon, lat, ord)
+		CROSS JOIN LATERAL (SELECT ST_SetSRID(ST_MakePoint(p.lon, p.lat), 4326) AS geom) pt
+		CROSS JOIN LATERAL (
+			SELECT l.source_id, l.target_id, ST_LineLocatePoint(l.center_line, pt.geom) AS fraction
+			FROM (
+				SELECT source_id, target_id, center_line
+				FROM road_links
+				WHERE TRUE%s
+				ORDER BY center_line <-> pt.geom
+				LIMIT $3
+			) l
+			ORDER BY ST_Distance(l.center_line::geography, pt.geom::geography)
+			LIMIT 1
+		) c
+		JOIN road_nodes n ON n.id = CASE WHEN c.fraction <= 0.5 THEN c.source_id ELSE c.target_id END
+	`, exclusions)
+
+	rows, err := repo.pool.Query(ctx, sql, lons, lats, SNAP_CANDIDATES)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find nearest link nodes: %v", err)
+	}
+	defer rows.Close()
+
+	nodes := make([]*models.SnappedNode, len(coords))
+	for rows.Next() {
+		var ord int
+		var node models.SnappedNode
+		if err := rows.Scan(&ord, &node.ID, &node.GmlID, &node.Location.Lat, &node.Location.Lon, &node.DistanceM); err != nil {
+			return nil, fmt.Errorf("failed to scan nearest link node: %v", err)
+		}
+		nodes[ord-1] = &node
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		if node == nil {
+			return nil, ErrNoNodeFound
+		}
+	}
+	return nodes, nil
+}
+
+// ShortestPath runs pgr_withPoints over the road links surrounding the two
+// points, which splits the links they lie on with virtual edges so that the
+// path starts and ends exactly at the points. It returns the traversed links
+// in order, with the portion of the first and last links covered. The cost
+// of any penalised link is multiplied by its penalty, and avoided links are
+// left out of the search entirely. An empty result means the points are not
+// connected within the search envelope.
+func (repo *RoutingRepositoryImpl) ShortestPath(ctx context.Context, from, to *models.SnappedLink, profile *models.Profile, opts models.PathOptions) ([]models.PathSegment, error) {
+	edges, err := repo.edgesSql([]models.Coordinate{from.Point, to.Point}, profile, opts.Avoid)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Penalties) > 0 {
+		edges = penalisedSql(edges, opts.Penalties)
+	}
+
+	// The points are -1 (from) and -2 (to) in the results
+	points := fmt.Sprintf(`
+		SELECT 1 AS pid, %d AS edge_id, %f::float8 AS fraction
+		UNION ALL
+		SELECT 2, %d, %f::float8
+	`, from.ID, from.Fraction, to.ID, to.Fraction)
+
+	sql := `
+		SELECT l.id, l.gml_id, l.length_m::float8, %[2]s, l.source_id, p.node, p.next_node
+		FROM (
+			SELECT seq, node, edge, LEAD(node) OVER (ORDER BY seq) AS next_node
+			FROM pgr_withPoints(replace($1, '%[1]s', quote_literal($3::text[])), $2, -1, -2, directed := false)
+		) p
+		JOIN road_links l ON l.id = p.edge
+		ORDER BY p.seq
+	`
+
+	// Never NULL, which would make the whole edges query NULL
+	avoided := make([]string, 0)
+	if opts.Avoid != nil {
+		avoided = append(avoided, opts.Avoid.Links...)
+	}
+	rows, err := repo.pool.Query(ctx, fmt.Sprintf(sql, AVOIDED_LINKS_PLACEHOLDER, durationSql("l.")), edges, points, avoided)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shortest path: %v", err)
+	}
+	defer rows.Close()
+
+	segments := make([]models.PathSegment, 0)
+	for rows.Next() {
+		var segment models.PathSegment
+		var sourceID, node, nextNode int64
+		err := rows.Scan(&segment.LinkID, &segment.GmlID, &segment.LengthM, &segment.DurationS, &sourceID, &node, &nextNode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan path segment: %v", err)
+		}
+
+		// Work out how far along the link each end of the segment lies: at a
+		// point, or at one of its nodes
+		fraction := func(node int64, point *models.SnappedLink) float64 {
+			if node < 0 {
+				return point.Fraction
+			}
+			if node == sourceID {
+				return 0
+			}
+			return 1
+		}
+
+		segment.Forward = node == sourceID
+		if node < 0 || nextNode < 0 {
+			portion := models.LinkPortion{From: fraction(node, from), To: fraction(nextNode, to)}
+			if portion.From == portion.To {
+				continue
+			}
+			segment.Forward = portion.To > portion.From
+			segment.LengthM *= math.Abs(portion.To - portion.From)
+			segment.DurationS *= math.Abs(portion.To - portion.From)
+			segment.Portion = &portion
+		}
+		segments = append(segments, segment)
+	}
+
+	return segments, rows.Err()
+}
+
+// CostMatrix computes the cost of the cheapest path between every pair of
+// nodes with a single call to pgr_dijkstraCostMatrix. Entry [i][j] is the
+// cost from nodes[i] to nodes[j], or +Inf if there is no path between them.
+func (repo *RoutingRepositoryImpl) CostMatrix(ctx context.Context, nodes []*models.SnappedNode, profile *models.Profile) ([][]float64, error) {
+	coords := make([]models.Coordinate, len(nodes))
+	ids := make([]int64, len(nodes))
+	for i, node := range nodes {
+		coords[i] = node.Location
+		ids[i] = node.ID
+	}
+
+	edges, err := repo.edgesSql(coords, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `SELECT start_vid, end_vid, agg_cost FROM pgr_dijkstraCostMatrix($1, $2::bigint[], directed := false)`
+
+	rows, err := repo.pool.Query(ctx, sql, edges, uniqueIds(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute cost matrix: %v", err)
+	}
+	defer rows.Close()
+
+	costs := make(map[[2]int64]float64)
+	for rows.Next() {
+		var from, to int64
+		var cost float64
+		if err := rows.Scan(&from, &to, &cost); err != nil {
+			return nil, fmt.Errorf("failed to scan cost matrix: %v", err)
+		}
+		costs[[2]int64{from, to}] = cost
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	matrix := make([][]float64, len(nodes))
+	for i := range nodes {
+		matrix[i] = make([]float64, len(nodes))
+		for j := range nodes {
+			cost, ok := costs[[2]int64{ids[i], ids[j]}]
+			switch {
+			case ids[i] == ids[j]:
+				matrix[i][j] = 0
+			case ok:
+				matrix[i][j] = cost
+			default:
+				matrix[i][j] = math.Inf(1)
+			}
+		}
+	}
+	return matrix, nil
+}
+
+// Isochrones finds the part of the network reachable from the origin within
+// each cost budget (in the units of the profile's metric) with a single
+// pgr_drivingDistance search, and returns a polygon for each budget: either
+// the concave hull of the reached nodes ("hull"), or the reached links
+// buffered and merged ("buffer"). radiusM bounds how far from the origin the
+// search needs to look for the largest budget.
+func (repo *RoutingRepositoryImpl) Isochrones(ctx context.Context, origin *models.SnappedNode, budgets []float64, radiusM float64, shape string, profile *models.Profile) ([]models.Isochrone, error) {
+	edges, err := repo.edgesSql(envelopeAround(origin.Location, radiusM), profile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions, err := repo.exclusionsSql(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var polygon string
+	var shapeParam float64
+	switch shape {
+	case "hull":
+		shapeParam = CONCAVE_HULL_RATIO
+		polygon = `
+			SELECT b.budget, COUNT(*), ST_AsGeoJSON(ST_ConcaveHull(ST_Collect(n.location), $5))
+			FROM budgets b
+			JOIN reached r ON r.agg_cost <= b.budget
+			JOIN road_nodes n ON n.id = r.node
+			GROUP BY b.budget
+		`
+	case "buffer":
+		shapeParam = ISOCHRONE_BUFFER_M
+		// Only the links the profile allows were searched, so only they can
+		// have been travelled between two reached nodes
+		polygon = `
+			SELECT b.budget, COUNT(*), ST_AsGeoJSON(ST_Buffer(ST_Collect(l.center_line)::geography, $5)::geometry)
+			FROM budgets b
+			JOIN reached s ON s.agg_cost <= b.budget
+			JOIN road_links l ON l.source_id = s.node` + exclusions + `
+			JOIN reached t ON t.node = l.target_id AND t.agg_cost <= b.budget
+			GROUP BY b.budget
+		`
+	default:
+		return nil, fmt.Errorf("unknown isochrone shape '%s'", shape)
+	}
+
+	sql := `
+		WITH reached AS (
+			SELECT node, agg_cost FROM pgr_drivingDistance($1, $2::bigint, $3::float8, directed := false)
+		),
+		budgets AS (SELECT unnest($4::float8[]) AS budget)
+	` + polygon + `
+		ORDER BY b.budget DESC
+	`
+
+	maxBudget := 0.0
+	for _, budget := range budgets {
+		maxBudget = math.Max(maxBudget, budget)
+	}
+
+	rows, err := repo.pool.Query(ctx, sql, edges, origin.ID, maxBudget, budgets, shapeParam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute isochrones: %v", err)
+	}
+	defer rows.Close()
+
+	isochrones := make([]models.Isochrone, 0, len(budgets))
+	for rows.Next() {
+		var isochrone models.Isochrone
+		var geojson string
+		if err := rows.Scan(&isochrone.Budget, &isochrone.Reached, &geojson); err != nil {
+			return nil, fmt.Errorf("failed to scan isochrone: %v", err)
+		}
+		if err := json.Unmarshal([]byte(geojson), &isochrone.Geometry); err != nil {
+			return nil, fmt.Errorf("failed to decode isochrone polygon: %v", err)
+		}
+		isochrones = append(isochrones, isochrone)
+	}
+
+	return isochrones, rows.Err()
+}
+
+// envelopeAround returns the south-west and north-east corners of a box
+// extending radiusM metres around the coordinate.
+func envelopeAround(coord models.Coordinate, radiusM float64) []models.Coordinate {
+	dLat := radiusM / METRES_PER_DEGREE
+	dLon := dLat / math.Max(math.Cos(coord.Lat*math.Pi/180), 0.01)
+	return []models.Coordinate{
+		{Lat: coord.Lat - dLat, Lon: coord.Lon - dLon},
+		{Lat: coord.Lat + dLat, Lon: coord.Lon + dLon},
+	}
+}
+
+// DistanceMatrix finds the cheapest path (as per the profile) from every
+// origin to every destination in one many-to-many pgr_dijkstra search, and
+// returns the total length and duration of each path. Entry [i][j] is for
+// origins[i] to destinations[j], or +Inf if there is no path between them.
+func (repo *RoutingRepositoryImpl) DistanceMatrix(ctx context.Context, origins, destinations []*models.SnappedNode, profile *models.Profile) ([][]float64, [][]float64, error) {
+	coords := make([]models.Coordinate, 0, len(origins)+len(destinations))
+	originIds := make([]int64, len(origins))
+	destinationIds := make([]int64, len(destinations))
+	for i, node := range origins {
+		coords = append(coords, node.Location)
+		originIds[i] = node.ID
+	}
+	for i, node := range destinations {
+		coords = append(coords, node.Location)
+		destinationIds[i] = node.ID
+	}
+
+	edges, err := repo.edgesSql(coords, profile, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sql := `
+		SELECT p.start_vid, p.end_vid, SUM(l.length_m)::float8, SUM(%s)
+		FROM pgr_dijkstra($1, $2::bigint[], $3::bigint[], directed := false) AS p
+		JOIN road_links l ON l.id = p.edge
+		GROUP BY p.start_vid, p.end_vid
+	`
+
+	rows, err := repo.pool.Query(ctx, fmt.Sprintf(sql, durationSql("l.")), edges, uniqueIds(originIds), uniqueIds(destinationIds))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compute distance matrix: %v", err)
+	}
+	defer rows.Close()
+
+	type totals struct{ distance, duration float64 }
+	paths := make(map[[2]int64]totals)
+	for rows.Next() {
+		var from, to int64
+		var t totals
+		if err := rows.Scan(&from, &to, &t.distance, &t.duration); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan distance matrix: %v", err)
+		}
+		paths[[2]int64{from, to}] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	distances := make([][]float64, len(origins))
+	durations := make([][]float64, len(origins))
+	for i := range origins {
+		distances[i] = make([]float64, len(destinations))
+		durations[i] = make([]float64, len(destinations))
+		for j := range destinations {
+			t, ok := paths[[2]int64{originIds[i], destinationIds[j]}]
+			switch {
+			case originIds[i] == destinationIds[j]:
+				distances[i][j], durations[i][j] = 0, 0
+			case ok:
+				distances[i][j], durations[i][j] = t.distance, t.duration
+			default:
+				distances[i][j], durations[i][j] = math.Inf(1), math.Inf(1)
+			}
+		}
+	}
+	return distances, durations, nil
+}
+
+func uniqueIds(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// SearchRoads finds the roads whose name or number is most similar (by
+// trigram similarity) to the query. Links sharing a name and number are
+// clustered by proximity, so that each stretch of road (rather than, say,
+// every Station Road in the country) is a separate result.
+func (repo *RoutingRepositoryImpl) SearchRoads(ctx context.Context, query string, limit int) ([]models.Road, error) {
+	sql := `
+		WITH matches AS (
+			SELECT name1, road_classification_number, center_line, length_m,
+				GREATEST(similarity(COALESCE(name1, ''), $1), similarity(COALESCE(road_classification_number, ''), $1)) AS score
+			FROM road_links
+			WHERE name1 % $1 OR road_classification_number % $1
+		),
+		best AS (
+			SELECT name1, road_classification_number, MAX(score) AS score
+			FROM matches
+			GROUP BY name1, road_classification_number
+			ORDER BY score DESC
+			LIMIT $2
+		),
+		clustered AS (
+			SELECT m.*, ST_ClusterDBSCAN(m.center_line, eps := $3, minpoints := 1)
+				OVER (PARTITION BY m.name1, m.road_classification_number) AS cluster
+			FROM matches m
+			JOIN best b ON b.name1 IS NOT DISTINCT FROM m.name1
+				AND b.road_classification_number IS NOT DISTINCT FROM m.road_classification_number
+		)
+		SELECT name1, road_classification_number, MAX(score)::float8, COUNT(*), SUM(length_m)::float8,
+			ST_YMin(ST_Extent(center_line)), ST_XMin(ST_Extent(center_line)),
+			ST_YMax(ST_Extent(center_line)), ST_XMax(ST_Extent(center_line)),
+			ST_AsGeoJSON(ST_LineMerge(ST_Collect(center_line)))
+		FROM clustered
+		GROUP BY name1, road_classification_number, cluster
+		ORDER BY MAX(score) DESC, SUM(length_m) DESC
+		LIMIT $2
+	`
+
+	rows, err := repo.pool.Query(ctx, sql, query, limit, ROAD_CLUSTER_DEGREES)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search roads: %v", err)
+	}
+	defer rows.Close()
+
+	roads := make([]models.Road, 0, limit)
+	for rows.Next() {
+		var road models.Road
+		var geojson string
+		err := rows.Scan(&road.Name1, &road.RoadClassificationNumber, &road.Similarity, &road.Links, &road.LengthM,
+			&road.Bounds.MinLat, &road.Bounds.MinLon, &road.Bounds.MaxLat, &road.Bounds.MaxLon, &geojson)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan road: %v", err)
+		}
+		if err := json.Unmarshal([]byte(geojson), &road.Geometry); err != nil {
+			return nil, fmt.Errorf("failed to decode road geometry: %v", err)
+		}
+		roads = append(roads, road)
+	}
+
+	return roads, rows.Err()
+}
+
+// FindJunctions returns the junctions of a motorway in number order, or just
+// those with the given number (if not empty). Road and junction numbers are
+// compared case-insensitively.
+func (repo *RoutingRepositoryImpl) FindJunctions(ctx context.Context, road string, number string) ([]models.Junction, error) {
+	sql := `
+		SELECT j.gml_id, j.road_classification_number, j.junction_number,
+			ST_Y(j.location), ST_X(j.location), n.gml_id
+		FROM motorway_junctions j
+		LEFT JOIN road_nodes n ON n.id = j.road_node_id
+		WHERE upper(j.road_classification_number) = upper($1)
+			AND ($2 = '' OR upper(j.junction_number) = upper($2))
+		ORDER BY substring(j.junction_number FROM '^[0-9]+')::int NULLS LAST, j.junction_number
+	`
+
+	rows, err := repo.pool.Query(ctx, sql, road, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find junctions: %v", err)
+	}
+	defer rows.Close()
+
+	junctions := make([]models.Junction, 0)
+	for rows.Next() {
+		var junction models.Junction
+		err := rows.Scan(&junction.GmlID, &junction.RoadClassificationNumber, &junction.JunctionNumber,
+			&junction.Location.Lat, &junction.Location.Lon, &junction.Node)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan junction: %v", err)
+		}
+		junctions = append(junctions, junction)
+	}
+
+	return junctions, rows.Err()
+}
+
+// FetchRouteLinks loads the road links with the given ids, joined against
+// the ref-data tables. Centre lines are returned in digitised order, and
+// roundabout links count the exits at each end.
+func (repo *RoutingRepositoryImpl) FetchRouteLinks(ctx context.Context, ids []int64) (map[int64]models.RouteLink, error) {
+	sql := fmt.Sprintf(`
+		SELECT l.id, l.gml_id, l.name1, l.road_classification_number,
+			rc.value, rc.description, rf.value, rf.description, fw.value, fw.description,
+			l.length_m::float8, %s, COALESCE(l.primary_route, false), COALESCE(l.trunk_road, false),
+			ST_AsGeoJSON(l.center_line), l.elevations,
+			CASE WHEN fw.value = 'Roundabout' THEN %[2]s ELSE 0 END,
+			CASE WHEN fw.value = 'Roundabout' THEN %[3]s ELSE 0 END
+		FROM road_links l
+		JOIN road_classifications rc ON rc.id = l.road_classification_id
+		JOIN road_functions rf ON rf.id = l.road_function_id
+		JOIN form_of_way_types fw ON fw.id = l.form_of_way_id
+		WHERE l.id = ANY($1)
+	`, durationSql("l."), exitsSql("l.source_id"), exitsSql("l.target_id"))
+
+	rows, err := repo.pool.Query(ctx, sql, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch road links: %v", err)
+	}
+	defer rows.Close()
+
+	results := make(map[int64]models.RouteLink, len(ids))
+	for rows.Next() {
+		var link models.RouteLink
+		var geojson string
+		err := rows.Scan(&link.ID, &link.GmlID, &link.Name1, &link.RoadClassificationNumber,
+			&link.RoadClassification, &link.RoadClassificationDescription,
+			&link.RoadFunction, &link.RoadFunctionDescription,
+			&link.FormOfWay, &link.FormOfWayDescription,
+			&link.LengthM, &link.DurationS, &link.PrimaryRoute, &link.TrunkRoad, &geojson, &link.Elevations,
+			&link.StartExits, &link.EndExits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan road link: %v", err)
+		}
+
+		var geometry struct {
+			Coordinates models.LineString `json:"coordinates"`
+		}
+		if err := json.Unmarshal([]byte(geojson), &geometry); err != nil {
+			return nil, fmt.Errorf("failed to decode center line for %s: %v", link.GmlID, err)
+		}
+		link.CenterLine = geometry.Coordinates
+		results[link.ID] = link
+	}
+
+	return results, rows.Err()
+}
+
+// edgesSql builds the inner query pgRouting uses to construct its graph,
+// restricted to the links inside an envelope around the given coordinates so
+// that the whole network does not have to be loaded for every request. Edge
+// costs and exclusions are derived from the profile, and any avoided links
+// (which may be nil) are excluded too.
+func (repo *RoutingRepositoryImpl) edgesSql(coords []models.Coordinate, profile *models.Profile, avoid *models.Avoid) (string, error) {
+	cost, err := repo.costSql(profile)
+	if err != nil {
+		return "", err
+	}
+
+	exclusions, err := repo.exclusionsSql(profile)
+	if err != nil {
+		return "", err
+	}
+	if !avoid.IsEmpty() {
+		exclusions += avoidSql(avoid, AVOIDED_LINKS_PLACEHOLDER)
+	}
+
+	minLon, minLat, maxLon, maxLat := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, coord := range coords {
+		minLon, minLat = math.Min(minLon, coord.Lon), math.Min(minLat, coord.Lat)
+		maxLon, maxLat = math.Max(maxLon, coord.Lon), math.Max(maxLat, coord.Lat)
+	}
+
+	margin := math.Max(SEARCH_MARGIN_DEGREES, 0.25*math.Hypot(maxLat-minLat, maxLon-minLon))
+	return fmt.Sprintf(`
+		SELECT id, source_id AS source, target_id AS target, %s AS cost
+		FROM road_links
+		WHERE center_line && ST_Expand(ST_MakeEnvelope(%f, %f, %f, %f, 4326), %f)%s
+	`,
+		cost, minLon, minLat, maxLon, maxLat, margin, exclusions,
+	), nil
+}
+
+// penalisedSql wraps an edges query so that the cost of each penalised link
+// is multiplied by its penalty. Links are grouped by penalty, as there are
+// typically only a handful of distinct values.
+func penalisedSql(edges string, penalties map[int64]float64) string {
+	groups := make(map[float64][]string)
+	for id, penalty := range penalties {
+		groups[penalty] = append(groups[penalty], strconv.FormatInt(id, 10))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT id, source, target, cost * (CASE")
+	for penalty, ids := range groups {
+		fmt.Fprintf(&sb, " WHEN id = ANY('{%s}'::bigint[]) THEN %f", strings.Join(ids, ","), penalty)
+	}
+	fmt.Fprintf(&sb, " ELSE 1 END) AS cost FROM (%s) AS edges", edges)
+	return sb.String()
+}
+
+// Stands in for the avoided gml_ids in edges queries, which pgRouting runs
+// without bind parameters. Queries replace it with the quoted text[] they
+// are bound to.
+const AVOIDED_LINKS_PLACEHOLDER = ":avoided_links"
+
+// avoidSql returns additional WHERE clauses removing the avoided links. The
+// gml_ids come from the text[] parameter (or placeholder) given, and the
+// areas are written as WKT.
+func avoidSql(avoid *models.Avoid, links string) string {
+	var sb strings.Builder
+	if len(avoid.Links) > 0 {
+		fmt.Fprintf(&sb, " AND gml_id <> ALL(%s::text[])", links)
+	}
+
+	if len(avoid.Areas) > 0 {
+		polygons := make([]string, len(avoid.Areas))
+		for i, polygon := range avoid.Areas {
+			rings := make([]string, len(polygon))
+			for j, ring := range polygon {
+				positions := make([]string, len(ring))
+				for k, pos := range ring {
+					positions[k] = strconv.FormatFloat(pos[0], 'f', -1, 64) + " " + strconv.FormatFloat(pos[1], 'f', -1, 64)
+				}
+				rings[j] = "(" + strings.Join(positions, ", ") + ")"
+			}
+			polygons[i] = "(" + strings.Join(rings, ", ") + ")"
+		}
+		fmt.Fprintf(&sb, " AND NOT ST_Intersects(center_line, ST_GeomFromText('MULTIPOLYGON(%s)', 4326))", strings.Join(polygons, ", "))
+	}
+	return sb.String()
+}
+
+// costSql returns an expression over a road_links row which multiplies its
+// length or duration (as per the profile's metric) by the profile's
+// weightings. Links without a stored duration fall back to the speed model.
+func (repo *RoutingRepositoryImpl) costSql(profile *models.Profile) (string, error) {
+	var sb strings.Builder
+	if profile.SpeedMph < 0 {
+		return "", fmt.Errorf("speed must not be negative")
+	}
+	switch {
+	case profile.Metric == models.METRIC_DURATION && profile.SpeedMph > 0:
+		fmt.Fprintf(&sb, "(length_m / %f)::float8", profile.SpeedMph*models.MPH_TO_METRES_PER_SECOND)
+	case profile.Metric == models.METRIC_DURATION:
+		sb.WriteString(durationSql(""))
+	default:
+		sb.WriteString("length_m::float8")
+	}
+
+	if err := writeCaseSql(&sb, "road_classification_id", profile.RoadClassification, repo.roadClassifications); err != nil {
+		return "", err
+	}
+	if err := writeCaseSql(&sb, "road_function_id", profile.RoadFunction, repo.roadFunctions); err != nil {
+		return "", err
+	}
+	if err := writeCaseSql(&sb, "form_of_way_id", profile.FormOfWay, repo.formOfWayTypes); err != nil {
+		return "", err
+	}
+	if profile.PrimaryRoute > 0 && profile.PrimaryRoute != 1 {
+		fmt.Fprintf(&sb, " * (CASE WHEN primary_route THEN %f ELSE 1 END)", profile.PrimaryRoute)
+	}
+	if profile.TrunkRoad > 0 && profile.TrunkRoad != 1 {
+		fmt.Fprintf(&sb, " * (CASE WHEN trunk_road THEN %f ELSE 1 END)", profile.TrunkRoad)
+	}
+	if profile.Climb < 0 {
+		return "", fmt.Errorf("climb cost must not be negative")
+	}
+	if profile.Climb > 0 {
+		fmt.Fprintf(&sb, " + %f * (COALESCE(ascent_m, 0) + COALESCE(descent_m, 0))::float8 / 2", profile.Climb)
+	}
+
+	return sb.String(), nil
+}
+
+// durationSql returns an expression for the stored duration of a road_links
+// row (whose columns have the given prefix), falling back to the speed
+// model's default speed for links without one.
+func durationSql(prefix string) string {
+	return fmt.Sprintf("COALESCE(%[1]sduration_s, %[1]slength_m / %[2]f)::float8",
+		prefix, models.DefaultSpeedModel.DefaultMph*models.MPH_TO_METRES_PER_SECOND)
+}
+
+// exitsSql returns a subquery counting the links at a node that are not part
+// of a roundabout. The bounding box test lets it use the spatial index, as
+// there is none on the node ids.
+func exitsSql(node string) string {
+	return fmt.Sprintf(`(
+		SELECT count(*)::int
+		FROM road_nodes n
+		JOIN road_links x ON x.center_line && n.location AND n.id IN (x.source_id, x.target_id)
+		JOIN form_of_way_types xfw ON xfw.id = x.form_of_way_id
+		WHERE n.id = %s AND xfw.value <> 'Roundabout'
+	)`, node)
+}
+
+func writeCaseSql(sb *strings.Builder, column string, multipliers map[string]float64, refData map[string]models.RefData) error {
+	if len(multipliers) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(sb, " * (CASE %s", column)
+	for value, multiplier := range multipliers {
+		ref, ok := refData[value]
+		if !ok {
+			return fmt.Errorf("unknown %s value '%s' in profile", column, value)
+		}
+		if multiplier <= 0 {
+			return fmt.Errorf("multiplier for '%s' must be positive", value)
+		}
+		fmt.Fprintf(sb, " WHEN %d THEN %f", ref.ID, multiplier)
+	}
+	sb.WriteString(" ELSE 1 END)")
+	return nil
+}
+
+// exclusionsSql returns additional WHERE clauses removing the links the
+// profile does not allow.
+func (repo *RoutingRepositoryImpl) exclusionsSql(profile *models.Profile) (string, error) {
+	var sb strings.Builder
+
+	if err := writeNotInSql(&sb, "road_classification_id", profile.Exclude.RoadClassification, repo.roadClassifications); err != nil {
+		return "", err
+	}
+	if err := writeNotInSql(&sb, "road_function_id", profile.Exclude.RoadFunction, repo.roadFunctions); err != nil {
+		return "", err
+	}
+	if err := writeNotInSql(&sb, "form_of_way_id", profile.Exclude.FormOfWay, repo.formOfWayTypes); err != nil {
+		return "", err
+	}
+	if profile.Exclude.MaxGradient < 0 {
+		return "", fmt.Errorf("max gradient must not be negative")
+	}
+	if profile.Exclude.MaxGradient > 0 {
+		fmt.Fprintf(&sb, " AND COALESCE(max_gradient, 0) <= %f", profile.Exclude.MaxGradient)
+	}
+
+	return sb.String(), nil
+}
+
+func writeNotInSql(sb *strings.Builder, column string, values []string, refData map[string]models.RefData) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(values))
+	for i, value := range values {
+		ref, ok := refData[value]
+		if !ok {
+			return fmt.Errorf("unknown %s value '%s' in profile", column, value)
+		}
+		ids[i] = fmt.Sprint(ref.ID)
+	}
+	fmt.Fprintf(sb, " AND %s NOT IN (%s)", column, strings.Join(ids, ", "))
+	return nil
+}
+
+// ValidateProfile checks that every value referenced by the profile exists
+// in the ref-data tables.
+func (repo *RoutingRepositoryImpl) ValidateProfile(profile *models.Profile) error {
+	if _, err := repo.costSql(profile); err != nil {
+		return fmt.Errorf("profile '%s': %v", profile.Name, err)
+	}
+	if _, err := repo.exclusionsSql(profile); err != nil {
+		return fmt.Errorf("profile '%s': %v", profile.Name, err)
+	}
+	return nil
+}
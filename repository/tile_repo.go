@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Size of vector tiles, in tile coordinate units
+const TILE_EXTENT = 4096
+
+// Size of the buffer around vector tiles that geometry is clipped to, in tile
+// coordinate units
+const TILE_BUFFER = 64
+
+// Lowest zoom level at which links of each road classification are drawn;
+// classifications not listed are drawn from MIN_TILE_ZOOM_DEFAULT
+var tileMinZooms = map[string]int{
+	"Motorway":              5,
+	"A Road":                6,
+	"B Road":                9,
+	"Classified Unnumbered": 11,
+	"Unclassified":          12,
+}
+
+// Lowest zoom level at which other road links are drawn
+const MIN_TILE_ZOOM_DEFAULT = 13
+
+// Lowest zoom level at which road nodes are drawn
+const MIN_TILE_ZOOM_NODES = 14
+
+type TileRepository interface {
+	Tile(ctx context.Context, tile models.TileCoord) ([]byte, error)
+	Bounds(ctx context.Context) (*models.BoundingBox, error)
+}
+
+type TileRepositoryImpl struct {
+	pool                *pgxpool.Pool
+	roadClassifications map[string]models.RefData
+}
+
+func NewTileRepository(pool *pgxpool.Pool) (*TileRepositoryImpl, error) {
+	roadClassifications, err := NewRefDataRepository(pool, "road_classifications").FetchAll(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching road_classifications: %v", err)
+	}
+	return &TileRepositoryImpl{pool: pool, roadClassifications: *roadClassifications}, nil
+}
+
+// Tile renders a Mapbox Vector Tile of the road network, with a road_links
+// layer and (when zoomed in far enough) a road_nodes layer. Minor roads are
+// left out at low zoom levels, and link geometry is simplified to the
+// resolution of the tile.
+func (repo *TileRepositoryImpl) Tile(ctx context.Context, tile models.TileCoord) ([]byte, error) {
+	sql := `
+		WITH bounds AS (
+			SELECT ST_TileEnvelope($1, $2, $3) AS geom, ST_Transform(ST_TileEnvelope($1, $2, $3), 4326) AS geom4326
+		),
+		links AS (
+			SELECT l.gml_id, l.name1, l.road_classification_number,
+				rc.value AS road_classification, rf.value AS road_function, fw.value AS form_of_way,
+				COALESCE(l.primary_route, false) AS primary_route, COALESCE(l.trunk_road, false) AS trunk_road,
+				ST_AsMVTGeom(ST_Simplify(ST_Transform(l.center_line, 3857), $4), b.geom, $5, $6) AS geom
+			FROM road_links l
+			JOIN road_classifications rc ON rc.id = l.road_classification_id
+			JOIN road_functions rf ON rf.id = l.road_function_id
+			JOIN form_of_way_types fw ON fw.id = l.form_of_way_id
+			CROSS JOIN bounds b
+			WHERE l.center_line && b.geom4326 AND l.road_classification_id = ANY($7)
+		),
+		nodes AS (
+			SELECT n.gml_id, fr.value AS form_of_road_node,
+				ST_AsMVTGeom(ST_Transform(n.location, 3857), b.geom, $5, $6) AS geom
+			FROM road_nodes n
+			JOIN form_of_road_types fr ON fr.id = n.form_of_road_id
+			CROSS JOIN bounds b
+			WHERE $8 AND n.location && b.geom4326
+		)
+		SELECT
+			COALESCE((SELECT ST_AsMVT(links, 'road_links', $5, 'geom') FROM links WHERE geom IS NOT NULL), ''::bytea) ||
+			COALESCE((SELECT ST_AsMVT(nodes, 'road_nodes', $5, 'geom') FROM nodes WHERE geom IS NOT NULL), ''::bytea)
+	`
+
+	var mvt []byte
+	err := repo.pool.QueryRow(ctx, sql, tile.Z, tile.X, tile.Y, simplifyTolerance(tile.Z), TILE_EXTENT, TILE_BUFFER,
+		repo.classificationsAt(tile.Z), tile.Z >= MIN_TILE_ZOOM_NODES).Scan(&mvt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render tile %s: %v", tile, err)
+	}
+	return mvt, nil
+}
+
+// Bounds returns the extent of the imported road network.
+func (repo *TileRepositoryImpl) Bounds(ctx context.Context) (*models.BoundingBox, error) {
+	sql := `
+		SELECT ST_YMin(extent), ST_XMin(extent), ST_YMax(extent), ST_XMax(extent)
+		FROM (SELECT ST_Extent(center_line) AS extent FROM road_links) e
+		WHERE extent IS NOT NULL
+	`
+
+	var bounds models.BoundingBox
+	err := repo.pool.QueryRow(ctx, sql).Scan(&bounds.MinLat, &bounds.MinLon, &bounds.MaxLat, &bounds.MaxLon)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("no road links have been imported")
+		}
+		return nil, fmt.Errorf("failed to find extent of road network: %v", err)
+	}
+	return &bounds, nil
+}
+
+// classificationsAt returns the ids of the road classifications drawn at
+// zoom level z.
+func (repo *TileRepositoryImpl) classificationsAt(z int) []int32 {
+	ids := make([]int32, 0, len(repo.roadClassifications))
+	for value, refData := range repo.roadClassifications {
+		minZoom, ok := tileMinZooms[value]
+		if !ok {
+			minZoom = MIN_TILE_ZOOM_DEFAULT
+		}
+		if z >= minZoom {
+			ids = append(ids, refData.ID)
+		}
+	}
+	return ids
+}
+
+// simplifyTolerance is the size (in web mercator metres) of one tile
+// coordinate unit at zoom level z, below which detail cannot be seen.
+func simplifyTolerance(z int) float64 {
+	return 2 * 20_037_508.342789244 / float64(int(1)<<z) / TILE_EXTENT
+}
@@ -0,0 +1,106 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+const MAX_ALTERNATIVES = 3
+
+// Factor by which the cost of a link is multiplied each time it appears in
+// a route found while looking for alternatives
+const PENALTY_FACTOR = 1.4
+
+// An alternative must not share more than this fraction of its length with
+// any route already found...
+const MAX_OVERLAP = 0.7
+
+// ...nor cost more than this multiple of the best route
+const MAX_STRETCH = 1.5
+
+// Upper bound on the number of penalised searches per alternative requested
+const ATTEMPTS_PER_ALTERNATIVE = 4
+
+// alternatives finds up to k routes that are meaningfully different from the
+// best route, using the penalty method: after each search, the links of the
+// route just found are made more expensive, pushing the next search onto
+// other roads. A candidate is kept only if it does not overlap too much with
+// any route kept so far and is not unreasonably longer (or slower) than the
+// best route.
+func (s *Service) alternatives(ctx context.Context, points []*models.SnappedLink, profile *models.Profile, opts models.PathOptions, best *models.Route, k int) ([]*models.Route, error) {
+	if k > MAX_ALTERNATIVES {
+		return nil, fmt.Errorf("%w: at most %d alternatives are allowed", ErrInvalidRequest, MAX_ALTERNATIVES)
+	}
+
+	accepted := []*models.Route{best}
+	alternatives := make([]*models.Route, 0, k)
+	penalties := make(map[int64]float64)
+	opts.Penalties = penalties
+	previous := best
+
+	for attempt := 0; attempt < k*ATTEMPTS_PER_ALTERNATIVE && len(alternatives) < k; attempt++ {
+		for _, segment := range previous.Path {
+			if penalty, ok := penalties[segment.LinkID]; ok {
+				penalties[segment.LinkID] = penalty * PENALTY_FACTOR
+			} else {
+				penalties[segment.LinkID] = PENALTY_FACTOR
+			}
+		}
+
+		candidate, err := s.routePoints(ctx, points, profile, opts)
+		if errors.Is(err, ErrNoRoute) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		previous = candidate
+
+		if routeCost(candidate, profile) > routeCost(best, profile)*MAX_STRETCH {
+			break
+		}
+		if maxOverlap(candidate, accepted) > MAX_OVERLAP {
+			continue
+		}
+
+		accepted = append(accepted, candidate)
+		alternatives = append(alternatives, candidate)
+	}
+
+	return alternatives, nil
+}
+
+func routeCost(route *models.Route, profile *models.Profile) float64 {
+	if profile.Metric == models.METRIC_DURATION {
+		return route.DurationS
+	}
+	return route.DistanceM
+}
+
+// maxOverlap is the largest fraction of the candidate's length that is
+// shared with any one of the routes.
+func maxOverlap(candidate *models.Route, routes []*models.Route) float64 {
+	if candidate.DistanceM == 0 {
+		return 1
+	}
+
+	result := 0.0
+	for _, route := range routes {
+		links := make(map[int64]bool, len(route.Path))
+		for _, segment := range route.Path {
+			links[segment.LinkID] = true
+		}
+
+		shared := 0.0
+		for _, segment := range candidate.Path {
+			if links[segment.LinkID] {
+				shared += segment.LengthM
+			}
+		}
+		result = max(result, shared/candidate.DistanceM)
+	}
+	return result
+}
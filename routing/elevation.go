@@ -0,0 +1,57 @@
+package routing
+
+import (
+	"github.com/rm-hull/route-planner/models"
+)
+
+// RouteElevation builds the height profile of a route from the elevations of
+// its (travel-oriented) links, with one point per centre line position. It
+// returns nil unless every link has elevations.
+func RouteElevation(links []models.RouteLink) *models.RouteElevation {
+	if len(links) == 0 {
+		return nil
+	}
+
+	result := &models.RouteElevation{Profile: make([]models.ElevationPoint, 0)}
+	travelled := 0.0
+	for _, link := range links {
+		if len(link.Elevations) == 0 || len(link.Elevations) != len(link.CenterLine) {
+			return nil
+		}
+
+		// Share the link's length out between its segments in proportion to
+		// their great-circle lengths
+		segments := make([]float64, len(link.CenterLine))
+		total := 0.0
+		for i := 1; i < len(link.CenterLine); i++ {
+			from, to := link.CenterLine[i-1], link.CenterLine[i]
+			segments[i] = models.Coordinate{Lat: from[1], Lon: from[0]}.DistanceTo(models.Coordinate{Lat: to[1], Lon: to[0]})
+			total += segments[i]
+		}
+
+		along := 0.0
+		for i, height := range link.Elevations {
+			along += segments[i]
+			distance := travelled
+			if total > 0 {
+				distance += link.LengthM * along / total
+			}
+			point := models.ElevationPoint{DistanceM: distance, ElevationM: float64(height)}
+
+			if n := len(result.Profile); n > 0 {
+				if i == 0 {
+					// The shared node between consecutive links
+					continue
+				}
+				if rise := point.ElevationM - result.Profile[n-1].ElevationM; rise > 0 {
+					result.AscentM += rise
+				} else {
+					result.DescentM -= rise
+				}
+			}
+			result.Profile = append(result.Profile, point)
+		}
+		travelled += link.LengthM
+	}
+	return result
+}
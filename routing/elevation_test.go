@@ -0,0 +1,80 @@
+package routing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// climbingLink runs east along latitude 51 from lon, through a position
+// every 0.001 degrees, with the given heights at each.
+func climbingLink(lon float64, lengthM float64, heights ...float32) models.RouteLink {
+	line := make(models.LineString, len(heights))
+	for i := range line {
+		line[i] = [2]float64{lon + 0.001*float64(i), 51}
+	}
+	return models.RouteLink{CenterLine: line, Elevations: heights, LengthM: lengthM}
+}
+
+func TestRouteElevation(t *testing.T) {
+	tests := []struct {
+		name     string
+		links    []models.RouteLink
+		profile  []models.ElevationPoint
+		ascent   float64
+		descent  float64
+		expected bool
+	}{
+		{
+			name:     "single link",
+			links:    []models.RouteLink{climbingLink(0, 140, 10, 20, 15)},
+			profile:  []models.ElevationPoint{{DistanceM: 0, ElevationM: 10}, {DistanceM: 70, ElevationM: 20}, {DistanceM: 140, ElevationM: 15}},
+			ascent:   10,
+			descent:  5,
+			expected: true,
+		},
+		{
+			name:     "shared node listed once",
+			links:    []models.RouteLink{climbingLink(0, 140, 10, 20, 15), climbingLink(0.002, 100, 15, 30)},
+			profile:  []models.ElevationPoint{{DistanceM: 0, ElevationM: 10}, {DistanceM: 70, ElevationM: 20}, {DistanceM: 140, ElevationM: 15}, {DistanceM: 240, ElevationM: 30}},
+			ascent:   25,
+			descent:  5,
+			expected: true,
+		},
+		{
+			name:     "heights differ at the shared node",
+			links:    []models.RouteLink{climbingLink(0, 70, 10, 20), climbingLink(0.001, 70, 21, 25)},
+			profile:  []models.ElevationPoint{{DistanceM: 0, ElevationM: 10}, {DistanceM: 70, ElevationM: 20}, {DistanceM: 140, ElevationM: 25}},
+			ascent:   15,
+			expected: true,
+		},
+		{name: "link without elevations", links: []models.RouteLink{climbingLink(0, 70, 10, 20), {CenterLine: models.LineString{{0.001, 51}, {0.002, 51}}, LengthM: 70}}},
+		{name: "no links"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := RouteElevation(test.links)
+			if !test.expected {
+				if result != nil {
+					t.Fatalf("expected no elevation profile, got %+v", result)
+				}
+				return
+			}
+			if result == nil {
+				t.Fatal("expected an elevation profile")
+			}
+			if len(result.Profile) != len(test.profile) {
+				t.Fatalf("got profile %v, expected %v", result.Profile, test.profile)
+			}
+			for i, point := range result.Profile {
+				if math.Abs(point.DistanceM-test.profile[i].DistanceM) > 1e-6 || point.ElevationM != test.profile[i].ElevationM {
+					t.Fatalf("got profile %v, expected %v", result.Profile, test.profile)
+				}
+			}
+			if result.AscentM != test.ascent || result.DescentM != test.descent {
+				t.Fatalf("got ascent %v and descent %v, expected %v and %v", result.AscentM, result.DescentM, test.ascent, test.descent)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package routing
+
+import (
+	"context"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Engine answers the snapping and path-finding queries behind routes and
+// matrices. Both the database repository (via PostGIS and pgRouting) and the
+// in-memory graph implement it.
+type Engine interface {
+	NearestNode(ctx context.Context, coord models.Coordinate) (*models.SnappedNode, error)
+	NearestLink(ctx context.Context, coord models.Coordinate) (*models.SnappedLink, error)
+	NearestLinks(ctx context.Context, coords []models.Coordinate, profile *models.Profile, avoid *models.Avoid) ([]*models.SnappedLink, error)
+	NearestLinkNodes(ctx context.Context, coords []models.Coordinate, profile *models.Profile) ([]*models.SnappedNode, error)
+	NearestNamedLink(ctx context.Context, coord models.Coordinate) (*models.SnappedLink, error)
+	ShortestPath(ctx context.Context, from, to *models.SnappedLink, profile *models.Profile, opts models.PathOptions) ([]models.PathSegment, error)
+	CostMatrix(ctx context.Context, nodes []*models.SnappedNode, profile *models.Profile) ([][]float64, error)
+	DistanceMatrix(ctx context.Context, origins, destinations []*models.SnappedNode, profile *models.Profile) ([][]float64, [][]float64, error)
+	Isochrones(ctx context.Context, origin *models.SnappedNode, budgets []float64, radiusM float64, shape string, profile *models.Profile) ([]models.Isochrone, error)
+	FetchRouteLinks(ctx context.Context, ids []int64) (map[int64]models.RouteLink, error)
+}
@@ -0,0 +1,95 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+var contentTypes = map[string]string{
+	"json":    "application/json",
+	"geojson": "application/geo+json",
+	"gpx":     "application/gpx+xml",
+}
+
+// ContentType returns the MIME type for a route output format, or an error
+// if the format is not supported.
+func ContentType(format string) (string, error) {
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return "", fmt.Errorf("unsupported format '%s'", format)
+	}
+	return contentType, nil
+}
+
+// WriteRoute encodes the route, and any alternatives, in the requested
+// format. Alternatives are rendered as additional (numbered) features in
+// GeoJSON and as additional tracks in GPX.
+func (s *Service) WriteRoute(ctx context.Context, w io.Writer, route *models.Route, format string) error {
+	links, err := s.RouteLinks(ctx, route)
+	if err != nil {
+		return err
+	}
+
+	alternativeLinks := make([][]models.RouteLink, len(route.Alternatives))
+	for i, alternative := range route.Alternatives {
+		if alternativeLinks[i], err = s.RouteLinks(ctx, alternative); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case "json":
+		result := withDetails(route, links)
+		result.Alternatives = make([]*models.Route, len(route.Alternatives))
+		for i, alternative := range route.Alternatives {
+			result.Alternatives[i] = withDetails(alternative, alternativeLinks[i])
+		}
+		return json.NewEncoder(w).Encode(result)
+
+	case "geojson":
+		collection := AsFeatureCollection(route, links)
+		for i, alternative := range route.Alternatives {
+			for _, feature := range AsFeatureCollection(alternative, alternativeLinks[i]).Features {
+				feature.Properties["alternative"] = i + 1
+				collection.Features = append(collection.Features, feature)
+			}
+		}
+		return json.NewEncoder(w).Encode(collection)
+
+	case "gpx":
+		gpx := AsGPX(route, links)
+		for i, alternative := range route.Alternatives {
+			gpx.Tracks = append(gpx.Tracks, AlternativeTrack(alternative, alternativeLinks[i], i+1))
+		}
+
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(gpx); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+
+	default:
+		return fmt.Errorf("unsupported format '%s'", format)
+	}
+}
+
+// withDetails returns a copy of the route with its instructions, merged
+// geometry and (when known) height profile filled in.
+func withDetails(route *models.Route, links []models.RouteLink) *models.Route {
+	result := *route
+	geometry := MergedLine(links).AsGeoJSON()
+	result.Instructions = RouteInstructions(route, links)
+	result.Geometry = &geometry
+	result.Elevation = RouteElevation(links)
+	return &result
+}
@@ -0,0 +1,41 @@
+package routing
+
+import (
+	"github.com/rm-hull/route-planner/models"
+)
+
+// AsFeatureCollection renders the links of a route as GeoJSON, one
+// LineString feature per traversed road link.
+func AsFeatureCollection(route *models.Route, links []models.RouteLink) *models.GeoJSONFeatureCollection {
+	legs := legIndexes(route)
+	features := make([]models.GeoJSONFeature, len(links))
+	for i, link := range links {
+		features[i] = models.NewFeature(link.CenterLine.AsGeoJSON(), map[string]any{
+			"seq":                             i + 1,
+			"leg":                             legs[i] + 1,
+			"gml_id":                          link.GmlID,
+			"name1":                           link.Name1,
+			"road_classification_number":      link.RoadClassificationNumber,
+			"road_classification":             link.RoadClassification,
+			"road_classification_description": link.RoadClassificationDescription,
+			"road_function":                   link.RoadFunction,
+			"road_function_description":       link.RoadFunctionDescription,
+			"form_of_way":                     link.FormOfWay,
+			"form_of_way_description":         link.FormOfWayDescription,
+			"length_m":                        link.LengthM,
+			"duration_s":                      link.DurationS,
+		})
+	}
+	return models.NewFeatureCollection(features...)
+}
+
+// legIndexes maps each segment of the route's path to the leg it belongs to.
+func legIndexes(route *models.Route) []int {
+	indexes := make([]int, 0, len(route.Path))
+	for i, leg := range route.Legs {
+		for range leg.Path {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,110 @@
+package routing
+
+import (
+	"fmt"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// AsGPX renders a route as a GPX document: the merged centre lines become a
+// single track, a waypoint is added at the start, at every via point, at
+// every change of road and at the destination, and each turn-by-turn
+// instruction becomes a route point.
+func AsGPX(route *models.Route, links []models.RouteLink) *models.GPX {
+	name := fmt.Sprintf("Route from %s to %s", route.From.Point, route.To.Point)
+	gpx := models.NewGPX()
+	gpx.Metadata = models.GPXMetadata{
+		Name: name,
+		Desc: fmt.Sprintf("%.1f km, %.0f min", route.DistanceM/1000, route.DurationS/60),
+	}
+
+	segment := models.GPXTrackSegment{Points: make([]models.GPXPoint, 0)}
+	for _, pos := range MergedLine(links) {
+		segment.Points = append(segment.Points, models.GPXPoint{Lat: pos[1], Lon: pos[0]})
+	}
+
+	// Waypoints are listed in route order, so each via point comes after the
+	// road changes on the leg leading to it
+	waypoints := []models.GPXPoint{{Lat: route.From.Point.Lat, Lon: route.From.Point.Lon, Name: "Start"}}
+	previous, offset := "", 0
+	for i, leg := range route.Legs {
+		for _, link := range links[offset : offset+len(leg.Path)] {
+			label := RoadLabel(link)
+			if label != "" && label != previous && len(link.CenterLine) > 0 {
+				start := link.CenterLine[0]
+				waypoints = append(waypoints, models.GPXPoint{Lat: start[1], Lon: start[0], Name: label, Desc: link.RoadClassification})
+			}
+			previous = label
+		}
+		offset += len(leg.Path)
+
+		if i < len(route.Via) {
+			via := route.Via[i]
+			waypoints = append(waypoints, models.GPXPoint{Lat: via.Point.Lat, Lon: via.Point.Lon, Name: fmt.Sprintf("Via %d", i+1)})
+		}
+	}
+	waypoints = append(waypoints, models.GPXPoint{Lat: route.To.Point.Lat, Lon: route.To.Point.Lon, Name: "Destination"})
+
+	gpx.Waypoints = waypoints
+	routePoints := make([]models.GPXPoint, 0)
+	for _, instruction := range RouteInstructions(route, links) {
+		routePoints = append(routePoints, models.GPXPoint{
+			Lat:  instruction.Location.Lat,
+			Lon:  instruction.Location.Lon,
+			Name: instruction.Road,
+			Desc: instruction.Text,
+		})
+	}
+
+	gpx.Routes = []models.GPXRoute{{Name: name, Points: routePoints}}
+	gpx.Tracks = []models.GPXTrack{{Name: name, Segments: []models.GPXTrackSegment{segment}}}
+	return gpx
+}
+
+// AlternativeTrack renders an alternative route as a GPX track.
+func AlternativeTrack(route *models.Route, links []models.RouteLink, n int) models.GPXTrack {
+	segment := models.GPXTrackSegment{Points: make([]models.GPXPoint, 0)}
+	for _, pos := range MergedLine(links) {
+		segment.Points = append(segment.Points, models.GPXPoint{Lat: pos[1], Lon: pos[0]})
+	}
+
+	name := fmt.Sprintf("Alternative %d (%.1f km, %.0f min)", n, route.DistanceM/1000, route.DurationS/60)
+	return models.GPXTrack{Name: name, Segments: []models.GPXTrackSegment{segment}}
+}
+
+// MergedLine joins the (travel-oriented) centre lines of consecutive links
+// into one line string, dropping the shared node between each pair.
+func MergedLine(links []models.RouteLink) models.LineString {
+	merged := make(models.LineString, 0)
+	for _, link := range links {
+		for i, pos := range link.CenterLine {
+			if i == 0 && len(merged) > 0 && merged[len(merged)-1] == pos {
+				continue
+			}
+			merged = append(merged, pos)
+		}
+	}
+	return merged
+}
+
+// RoadLabel describes a link the way it would be signed, e.g. "A303 (London
+// Road)", "M3" or "Station Road". Unnamed, unnumbered links have no label.
+func RoadLabel(link models.RouteLink) string {
+	number := ""
+	if link.RoadClassificationNumber != nil {
+		number = *link.RoadClassificationNumber
+	}
+	name := ""
+	if link.Name1 != nil {
+		name = *link.Name1
+	}
+
+	switch {
+	case number != "" && name != "":
+		return fmt.Sprintf("%s (%s)", number, name)
+	case number != "":
+		return number
+	default:
+		return name
+	}
+}
@@ -0,0 +1,42 @@
+package routing
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+func namedLink(name string, start [2]float64) models.RouteLink {
+	return models.RouteLink{Name1: &name, CenterLine: models.LineString{start, {start[0] + 0.001, start[1]}}}
+}
+
+func TestAsGPXListsWaypointsInRouteOrder(t *testing.T) {
+	snapped := func(lon float64) *models.SnappedLink {
+		return &models.SnappedLink{Point: models.Coordinate{Lat: 51, Lon: lon}}
+	}
+	route := &models.Route{
+		From: snapped(0),
+		Via:  []*models.SnappedLink{snapped(0.002)},
+		To:   snapped(0.004),
+		Legs: []models.RouteLeg{
+			{Path: make([]models.PathSegment, 2)},
+			{Path: make([]models.PathSegment, 2)},
+		},
+	}
+	links := []models.RouteLink{
+		namedLink("High Street", [2]float64{0, 51}),
+		namedLink("Mill Lane", [2]float64{0.001, 51}),
+		namedLink("Mill Lane", [2]float64{0.002, 51}),
+		namedLink("Church Road", [2]float64{0.003, 51}),
+	}
+
+	names := make([]string, 0)
+	for _, waypoint := range AsGPX(route, links).Waypoints {
+		names = append(names, waypoint.Name)
+	}
+	expected := []string{"Start", "High Street", "Mill Lane", "Via 1", "Church Road", "Destination"}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("got waypoints %v, expected %v", names, expected)
+	}
+}
@@ -0,0 +1,329 @@
+package routing
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Form of way codes (see FormOfWayTypeValue) that change how a manoeuvre is
+// described.
+const (
+	FORM_OF_WAY_ROUNDABOUT                 = "Roundabout"
+	FORM_OF_WAY_SLIP_ROAD                  = "Slip Road"
+	FORM_OF_WAY_DUAL_CARRIAGEWAY           = "Dual Carriageway"
+	FORM_OF_WAY_COLLAPSED_DUAL_CARRIAGEWAY = "Collapsed Dual Carriageway"
+)
+
+// RouteInstructions generates the instructions for each leg of a route in
+// turn, announcing the arrival at every via point along the way.
+func RouteInstructions(route *models.Route, links []models.RouteLink) []models.Instruction {
+	instructions := make([]models.Instruction, 0)
+	offset := 0
+	for i, leg := range route.Legs {
+		legLinks := links[offset : offset+len(leg.Path)]
+		offset += len(leg.Path)
+
+		legInstructions := Instructions(legLinks)
+		if i < len(route.Legs)-1 && len(legInstructions) > 0 {
+			arrival := &legInstructions[len(legInstructions)-1]
+			arrival.Type = "waypoint"
+			arrival.Text = fmt.Sprintf("Arrive at waypoint %d", i+1)
+		}
+		instructions = append(instructions, legInstructions...)
+	}
+	return instructions
+}
+
+// Instructions generates turn-by-turn manoeuvres for the links of a route.
+// A new instruction is produced whenever the road being followed changes, or
+// when entering a roundabout or slip road; bends in the same road are not
+// announced.
+func Instructions(links []models.RouteLink) []models.Instruction {
+	instructions := make([]models.Instruction, 0)
+	if len(links) == 0 {
+		return instructions
+	}
+
+	instructions = append(instructions, departure(links[0]))
+
+	for i := 1; i < len(links); i++ {
+		prev, link := links[i-1], links[i]
+		current := &instructions[len(instructions)-1]
+
+		if link.FormOfWay == FORM_OF_WAY_ROUNDABOUT {
+			if prev.FormOfWay == FORM_OF_WAY_ROUNDABOUT {
+				extend(current, link)
+				continue
+			}
+
+			j := i
+			for j < len(links) && links[j].FormOfWay == FORM_OF_WAY_ROUNDABOUT {
+				j++
+			}
+			instructions = append(instructions, roundabout(link, roundaboutExit(links[i:j]), links[j:]))
+			continue
+		}
+
+		if prev.FormOfWay == FORM_OF_WAY_ROUNDABOUT {
+			// The exit taken has already been announced with the roundabout
+			extend(current, link)
+			current.Road = RoadLabel(link)
+			continue
+		}
+
+		if link.FormOfWay == FORM_OF_WAY_SLIP_ROAD && prev.FormOfWay != FORM_OF_WAY_SLIP_ROAD {
+			instructions = append(instructions, slipRoad(prev, link, links[i+1:]))
+			continue
+		}
+
+		label := RoadLabel(link)
+		if prev.FormOfWay == FORM_OF_WAY_SLIP_ROAD && link.FormOfWay != FORM_OF_WAY_SLIP_ROAD {
+			instructions = append(instructions, newInstruction("merge", joinText(link), link))
+			continue
+		}
+
+		if label == RoadLabel(prev) && label != "" {
+			extend(current, link)
+			continue
+		}
+
+		change := bearingChange(prev, link)
+		if label == "" && RoadLabel(prev) == "" && math.Abs(change) < 45 {
+			extend(current, link)
+			continue
+		}
+
+		instructions = append(instructions, turn(link, change))
+	}
+
+	last := links[len(links)-1]
+	arrival := newInstruction("arrive", "Arrive at destination", last)
+	arrival.DistanceM = 0
+	arrival.DurationS = 0
+	arrival.Location = endOf(last)
+	return append(instructions, arrival)
+}
+
+func newInstruction(kind string, text string, link models.RouteLink) models.Instruction {
+	return models.Instruction{
+		Type:      kind,
+		Text:      text,
+		Road:      RoadLabel(link),
+		FormOfWay: link.FormOfWay,
+		DistanceM: link.LengthM,
+		DurationS: link.DurationS,
+		Location:  startOf(link),
+	}
+}
+
+// extend adds the link to the distance and duration covered by an
+// instruction.
+func extend(instruction *models.Instruction, link models.RouteLink) {
+	instruction.DistanceM += link.LengthM
+	instruction.DurationS += link.DurationS
+}
+
+func departure(link models.RouteLink) models.Instruction {
+	text := "Head " + compassPoint(initialBearing(link))
+	if label := RoadLabel(link); label != "" {
+		text += " on " + label
+	}
+	return newInstruction("depart", text, link)
+}
+
+func turn(link models.RouteLink, change float64) models.Instruction {
+	direction := turnDirection(change)
+
+	var text string
+	if direction == "straight" {
+		text = "Continue"
+	} else {
+		text = "Turn " + direction
+	}
+
+	if label := RoadLabel(link); label != "" {
+		if direction == "straight" {
+			text += " on " + label
+		} else {
+			text += " onto " + roadDescription(link)
+		}
+	}
+
+	kind := "turn"
+	if direction == "straight" {
+		kind = "continue"
+	}
+	return newInstruction(kind, text, link)
+}
+
+func roundabout(link models.RouteLink, exit int, after []models.RouteLink) models.Instruction {
+	text := "At the roundabout take the exit"
+	if exit > 0 {
+		text = fmt.Sprintf("At the roundabout take the %s exit", ordinal(exit))
+	}
+	if len(after) > 0 {
+		if label := RoadLabel(after[0]); label != "" {
+			text += " onto " + label
+		}
+	}
+
+	instruction := newInstruction("roundabout", text, link)
+	instruction.Exit = exit
+	return instruction
+}
+
+// roundaboutExit numbers the exit taken off a roundabout by counting the
+// exits at each node passed on the way round (the entry node, and so the
+// link arrived on, is not among them). It returns 0 if the links do not
+// record their exits.
+func roundaboutExit(roundabout []models.RouteLink) int {
+	last := roundabout[len(roundabout)-1]
+	if last.EndExits == 0 {
+		return 0
+	}
+
+	exit := 1
+	for _, link := range roundabout[:len(roundabout)-1] {
+		exit += link.EndExits
+	}
+	return exit
+}
+
+func slipRoad(prev models.RouteLink, link models.RouteLink, after []models.RouteLink) models.Instruction {
+	text := "Take the slip road"
+	if direction := turnDirection(bearingChange(prev, link)); direction != "straight" {
+		text += " on the " + sideOf(direction)
+	}
+
+	for _, next := range after {
+		if next.FormOfWay == FORM_OF_WAY_SLIP_ROAD {
+			continue
+		}
+		if label := RoadLabel(next); label != "" {
+			text += " towards " + label
+		}
+		break
+	}
+	return newInstruction("slip road", text, link)
+}
+
+func joinText(link models.RouteLink) string {
+	if label := RoadLabel(link); label != "" {
+		return "Join " + roadDescription(link)
+	}
+	return "Join the main carriageway"
+}
+
+// roadDescription is the road label, qualified where the road is a dual
+// carriageway.
+func roadDescription(link models.RouteLink) string {
+	label := RoadLabel(link)
+	if link.FormOfWay == FORM_OF_WAY_DUAL_CARRIAGEWAY || link.FormOfWay == FORM_OF_WAY_COLLAPSED_DUAL_CARRIAGEWAY {
+		return "the " + label + " dual carriageway"
+	}
+	return label
+}
+
+func startOf(link models.RouteLink) models.Coordinate {
+	if len(link.CenterLine) == 0 {
+		return models.Coordinate{}
+	}
+	pos := link.CenterLine[0]
+	return models.Coordinate{Lat: pos[1], Lon: pos[0]}
+}
+
+func endOf(link models.RouteLink) models.Coordinate {
+	if len(link.CenterLine) == 0 {
+		return models.Coordinate{}
+	}
+	pos := link.CenterLine[len(link.CenterLine)-1]
+	return models.Coordinate{Lat: pos[1], Lon: pos[0]}
+}
+
+// initialBearing is the bearing of the first segment of the link.
+func initialBearing(link models.RouteLink) float64 {
+	if len(link.CenterLine) < 2 {
+		return 0
+	}
+	return bearing(link.CenterLine[0], link.CenterLine[1])
+}
+
+// finalBearing is the bearing of the last segment of the link.
+func finalBearing(link models.RouteLink) float64 {
+	n := len(link.CenterLine)
+	if n < 2 {
+		return 0
+	}
+	return bearing(link.CenterLine[n-2], link.CenterLine[n-1])
+}
+
+// bearingChange is the signed change in heading, in degrees, when moving
+// from one link onto the next: negative values turn left, positive right.
+func bearingChange(from models.RouteLink, to models.RouteLink) float64 {
+	change := initialBearing(to) - finalBearing(from)
+	for change > 180 {
+		change -= 360
+	}
+	for change <= -180 {
+		change += 360
+	}
+	return change
+}
+
+// bearing returns the initial great-circle bearing from a to b, both given
+// as [lon, lat], in degrees clockwise from north.
+func bearing(a, b [2]float64) float64 {
+	lat1, lat2 := a[1]*math.Pi/180, b[1]*math.Pi/180
+	dLon := (b[0] - a[0]) * math.Pi / 180
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+func turnDirection(change float64) string {
+	angle := math.Abs(change)
+	side := "right"
+	if change < 0 {
+		side = "left"
+	}
+
+	switch {
+	case angle < 20:
+		return "straight"
+	case angle < 60:
+		return "slight " + side
+	case angle < 135:
+		return side
+	default:
+		return "sharp " + side
+	}
+}
+
+func sideOf(direction string) string {
+	if direction == "left" || direction == "slight left" || direction == "sharp left" {
+		return "left"
+	}
+	return "right"
+}
+
+func compassPoint(bearing float64) string {
+	points := []string{"north", "northeast", "east", "southeast", "south", "southwest", "west", "northwest"}
+	return points[int(math.Round(bearing/45))%len(points)]
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
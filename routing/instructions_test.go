@@ -0,0 +1,49 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+func roundaboutLink(endExits int, from, to [2]float64) models.RouteLink {
+	return models.RouteLink{FormOfWay: FORM_OF_WAY_ROUNDABOUT, EndExits: endExits, CenterLine: models.LineString{from, to}}
+}
+
+func TestRoundaboutExits(t *testing.T) {
+	tests := []struct {
+		name     string
+		exits    []int
+		text     string
+		expected int
+	}{
+		{name: "first exit", exits: []int{1}, text: "At the roundabout take the 1st exit onto Church Road", expected: 1},
+		{name: "past a side road", exits: []int{1, 0, 1}, text: "At the roundabout take the 2nd exit onto Church Road", expected: 2},
+		{name: "past a dual carriageway", exits: []int{2, 1, 2}, text: "At the roundabout take the 4th exit onto Church Road", expected: 4},
+		{name: "exits not recorded", exits: []int{0, 0, 0}, text: "At the roundabout take the exit onto Church Road"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			links := []models.RouteLink{namedLink("High Street", [2]float64{0, 51})}
+			position := [2]float64{0.001, 51}
+			for i, exits := range test.exits {
+				next := [2]float64{0.001 + 0.0005*float64(i+1), 51 + 0.0005*float64(i%2)}
+				links = append(links, roundaboutLink(exits, position, next))
+				position = next
+			}
+			links = append(links, namedLink("Church Road", position))
+
+			instructions := Instructions(links)
+			if len(instructions) != 3 {
+				t.Fatalf("expected depart, roundabout and arrive, got %+v", instructions)
+			}
+			roundabout := instructions[1]
+			if roundabout.Type != "roundabout" || roundabout.Text != test.text || roundabout.Exit != test.expected {
+				t.Fatalf("got %s instruction %q (exit %d), expected %q", roundabout.Type, roundabout.Text, roundabout.Exit, test.text)
+			}
+			if roundabout.Road != "Church Road" {
+				t.Fatalf("expected the instruction to continue onto Church Road, got %q", roundabout.Road)
+			}
+		})
+	}
+}
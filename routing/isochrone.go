@@ -0,0 +1,81 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Largest budgets accepted, to bound the size of the network searched
+const (
+	MAX_ISOCHRONE_MINUTES = 120
+	MAX_ISOCHRONE_METRES  = 150_000
+)
+
+// Fastest speed in the speed model, used to bound how far a duration budget
+// can reach
+const MAX_SPEED_MPH = 70
+
+// Isochrones computes the area reachable from the origin within each budget,
+// given in minutes (unit "min") or metres (unit "m"), as a GeoJSON polygon
+// per budget ordered from largest to smallest. Shape is either "hull" or
+// "buffer".
+func (s *Service) Isochrones(ctx context.Context, origin models.Coordinate, budgets []float64, unit string, shape string, opts RouteOptions) (*models.GeoJSONFeatureCollection, error) {
+	if len(budgets) == 0 {
+		return nil, fmt.Errorf("%w: at least one budget is required", ErrInvalidRequest)
+	}
+	if shape != "hull" && shape != "buffer" {
+		return nil, fmt.Errorf("%w: unknown shape '%s'", ErrInvalidRequest, shape)
+	}
+
+	var limit, scale, maxSpeed float64
+	switch unit {
+	case "min":
+		opts.Minimise = models.METRIC_DURATION
+		limit, scale, maxSpeed = MAX_ISOCHRONE_MINUTES, 60, MAX_SPEED_MPH*models.MPH_TO_METRES_PER_SECOND
+	case "m":
+		opts.Minimise = models.METRIC_DISTANCE
+		limit, scale, maxSpeed = MAX_ISOCHRONE_METRES, 1, 1
+	default:
+		return nil, fmt.Errorf("%w: unknown unit '%s'", ErrInvalidRequest, unit)
+	}
+
+	costs := make([]float64, len(budgets))
+	maxCost := 0.0
+	for i, budget := range budgets {
+		if budget <= 0 || budget > limit {
+			return nil, fmt.Errorf("%w: budgets must be between 0 and %.0f %s", ErrInvalidRequest, limit, unit)
+		}
+		costs[i] = budget * scale
+		maxCost = max(maxCost, costs[i])
+	}
+
+	profile, err := s.Profile(opts)
+	if err != nil {
+		return nil, err
+	}
+	if unit == "min" && profile.SpeedMph > 0 {
+		maxSpeed = profile.SpeedMph * models.MPH_TO_METRES_PER_SECOND
+	}
+	nodes, err := s.snapToNodes(ctx, []models.Coordinate{origin}, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	isochrones, err := s.engine.Isochrones(ctx, nodes[0], costs, maxCost*maxSpeed, shape, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	features := make([]models.GeoJSONFeature, len(isochrones))
+	for i, isochrone := range isochrones {
+		features[i] = models.NewFeature(isochrone.Geometry, map[string]any{
+			"budget":  isochrone.Budget / scale,
+			"unit":    unit,
+			"profile": profile.Name,
+			"reached": isochrone.Reached,
+		})
+	}
+	return models.NewFeatureCollection(features...), nil
+}
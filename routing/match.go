@@ -0,0 +1,33 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Maximum number of points in a trace to be matched
+const MAX_TRACE_POINTS = 10_000
+
+// Matcher finds the road links most probably travelled along a GPS trace.
+// The in-memory graph implements it, as does a matcher that loads the region
+// around each trace from the database.
+type Matcher interface {
+	MatchTrace(ctx context.Context, trace []models.Coordinate) (*models.MatchResult, error)
+}
+
+// MatchTrace map-matches a GPS trace against the road network.
+func (s *Service) MatchTrace(ctx context.Context, trace []models.Coordinate) (*models.MatchResult, error) {
+	if len(trace) < 2 {
+		return nil, fmt.Errorf("%w: a trace needs at least two points", ErrInvalidRequest)
+	}
+	if len(trace) > MAX_TRACE_POINTS {
+		return nil, fmt.Errorf("%w: at most %d trace points are allowed", ErrInvalidRequest, MAX_TRACE_POINTS)
+	}
+	if s.matcher == nil {
+		return nil, fmt.Errorf("map matching is %w", ErrUnavailable)
+	}
+
+	return s.matcher.MatchTrace(ctx, trace)
+}
@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+const MAX_MATRIX_POINTS = 200
+
+// Matrix computes the network distance and duration from every origin to
+// every destination, following the cheapest path as per the profile.
+func (s *Service) Matrix(ctx context.Context, req models.MatrixRequest) (*models.Matrix, error) {
+	if len(req.Origins) == 0 || len(req.Destinations) == 0 {
+		return nil, fmt.Errorf("%w: at least one origin and destination are required", ErrInvalidRequest)
+	}
+	if len(req.Origins) > MAX_MATRIX_POINTS || len(req.Destinations) > MAX_MATRIX_POINTS {
+		return nil, fmt.Errorf("%w: at most %d origins and destinations are allowed", ErrInvalidRequest, MAX_MATRIX_POINTS)
+	}
+
+	profile, err := s.Profile(RouteOptions{Profile: req.Profile, Minimise: req.Minimise})
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.snapToNodes(ctx, append(append([]models.Coordinate{}, req.Origins...), req.Destinations...), profile)
+	if err != nil {
+		return nil, err
+	}
+	origins, destinations := nodes[:len(req.Origins)], nodes[len(req.Origins):]
+
+	distances, durations, err := s.engine.DistanceMatrix(ctx, origins, destinations, profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile.SpeedMph > 0 {
+		for i, row := range distances {
+			for j, distance := range row {
+				durations[i][j], _ = profile.DurationSeconds(distance)
+			}
+		}
+	}
+
+	return &models.Matrix{
+		Profile:      profile.Name,
+		Minimise:     profile.Metric,
+		Origins:      origins,
+		Destinations: destinations,
+		DistancesM:   nullable(distances),
+		DurationsS:   nullable(durations),
+	}, nil
+}
+
+// nullable converts a matrix to one that can be encoded as JSON, with
+// infinite (unreachable) entries as null.
+func nullable(matrix [][]float64) [][]*float64 {
+	result := make([][]*float64, len(matrix))
+	for i, row := range matrix {
+		result[i] = make([]*float64, len(row))
+		for j := range row {
+			if !math.IsInf(row[j], 1) {
+				result[i][j] = &row[j]
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+const MAX_OPTIMISE_STOPS = 100
+
+// Optimise finds the order in which to visit the stops that minimises the
+// total network distance or duration (as per the profile's metric), starting
+// at start and finishing at end if one is given, or at the last stop
+// otherwise. The route through the stops in that order is also returned.
+func (s *Service) Optimise(ctx context.Context, start models.Coordinate, stops []models.Coordinate, end *models.Coordinate, opts RouteOptions) (*models.OptimisedRoute, error) {
+	if len(stops) == 0 {
+		return nil, fmt.Errorf("%w: at least one stop is required", ErrInvalidRequest)
+	}
+	if len(stops) > MAX_OPTIMISE_STOPS {
+		return nil, fmt.Errorf("%w: at most %d stops are allowed", ErrInvalidRequest, MAX_OPTIMISE_STOPS)
+	}
+
+	profile, err := s.Profile(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	waypoints := append([]models.Coordinate{start}, stops...)
+	if end != nil {
+		waypoints = append(waypoints, *end)
+	}
+
+	nodes, err := s.snapToNodes(ctx, waypoints, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix, err := s.engine.CostMatrix(ctx, nodes, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	order := SolveOrder(matrix, end != nil)
+	if cost := pathCost(matrix, order, end != nil); math.IsInf(cost, 1) {
+		return nil, fmt.Errorf("%w: not all stops are reachable", ErrNoRoute)
+	}
+
+	// The order is solved between the ends of the links the stops snap to,
+	// but the route itself runs between the points on those links
+	points, err := s.snapToLinks(ctx, waypoints, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := []*models.SnappedLink{points[0]}
+	stopOrder := make([]int, len(order))
+	for i, index := range order {
+		ordered = append(ordered, points[index])
+		stopOrder[i] = index - 1
+	}
+	if end != nil {
+		ordered = append(ordered, points[len(points)-1])
+	}
+
+	route, err := s.routePoints(ctx, ordered, profile, models.PathOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.RouteLinks(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OptimisedRoute{Order: stopOrder, Route: withDetails(route, links)}, nil
+}
@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+const DEFAULT_PROFILE = "shortest"
+
+var ErrUnknownProfile = errors.New("unknown routing profile")
+var ErrUnknownMetric = errors.New("unknown metric")
+
+// LoadProfiles reads a JSON array of routing profiles, keyed by name in the
+// result. Without a path, only the plain "shortest" (by length) profile is
+// available.
+func LoadProfiles(path string) (map[string]models.Profile, error) {
+	if path == "" {
+		return map[string]models.Profile{DEFAULT_PROFILE: {Name: DEFAULT_PROFILE}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles: %v", err)
+	}
+
+	var profiles []models.Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("error parsing profiles '%s': %v", path, err)
+	}
+
+	results := make(map[string]models.Profile, len(profiles))
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("profile without a name in '%s'", path)
+		}
+		if err := checkMetric(profile.Metric); err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", profile.Name, err)
+		}
+		if _, exists := results[profile.Name]; exists {
+			return nil, fmt.Errorf("duplicate profile '%s' in '%s'", profile.Name, path)
+		}
+		results[profile.Name] = profile
+	}
+
+	if _, ok := results[DEFAULT_PROFILE]; !ok {
+		return nil, fmt.Errorf("no '%s' profile defined in '%s'", DEFAULT_PROFILE, path)
+	}
+	return results, nil
+}
+
+func checkMetric(metric string) error {
+	if metric != "" && metric != models.METRIC_DISTANCE && metric != models.METRIC_DURATION {
+		return fmt.Errorf("%w: '%s'", ErrUnknownMetric, metric)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// The named road closest to a coordinate
+type NamedRoad struct {
+	Description string              `json:"description"`
+	DistanceM   float64             `json:"distance_m"`
+	Link        *models.SnappedLink `json:"link"`
+	Road        models.RouteLink    `json:"road"`
+}
+
+// ReverseGeocode finds the closest road link with a name or number to the
+// coordinate, and describes it.
+func (s *Service) ReverseGeocode(ctx context.Context, coord models.Coordinate) (*NamedRoad, error) {
+	link, err := s.engine.NearestNamedLink(ctx, coord)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.engine.FetchRouteLinks(ctx, []int64{link.ID})
+	if err != nil {
+		return nil, err
+	}
+	road, ok := links[link.ID]
+	if !ok {
+		return nil, fmt.Errorf("road link %s not found", link.GmlID)
+	}
+
+	return &NamedRoad{
+		Description: RoadDescription(road),
+		DistanceM:   link.DistanceM,
+		Link:        link,
+		Road:        road,
+	}, nil
+}
+
+// RoadDescription describes a link by its number and name, whether it is a
+// trunk road, and its form of way, e.g. "A34 Oxford Road, Trunk, Dual
+// Carriageway".
+func RoadDescription(link models.RouteLink) string {
+	names := make([]string, 0, 2)
+	if link.RoadClassificationNumber != nil && *link.RoadClassificationNumber != "" {
+		names = append(names, *link.RoadClassificationNumber)
+	}
+	if link.Name1 != nil && *link.Name1 != "" {
+		names = append(names, *link.Name1)
+	}
+
+	parts := make([]string, 0, 3)
+	if len(names) > 0 {
+		parts = append(parts, strings.Join(names, " "))
+	}
+	if link.TrunkRoad {
+		parts = append(parts, "Trunk")
+	}
+	if link.FormOfWay != "" {
+		parts = append(parts, link.FormOfWay)
+	}
+	return strings.Join(parts, ", ")
+}
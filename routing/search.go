@@ -0,0 +1,65 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Number of roads returned by a search unless a limit is given
+const DEFAULT_SEARCH_RESULTS = 10
+
+// Upper limit on the number of roads returned by a search
+const MAX_SEARCH_RESULTS = 50
+
+// SearchRoads finds roads by name (e.g. "Station Rd") or number (e.g.
+// "A303"), allowing for misspellings and abbreviations, with the most
+// similar first. A limit of zero gives the default number of results.
+func (s *Service) SearchRoads(ctx context.Context, query string, limit int) ([]models.Road, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: a search query is required", ErrInvalidRequest)
+	}
+	if limit == 0 {
+		limit = DEFAULT_SEARCH_RESULTS
+	}
+	if limit < 0 || limit > MAX_SEARCH_RESULTS {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidRequest, MAX_SEARCH_RESULTS)
+	}
+	if s.repo == nil {
+		return nil, fmt.Errorf("road search is %w", ErrUnavailable)
+	}
+
+	return s.repo.SearchRoads(ctx, query, limit)
+}
+
+// FindJunctions looks up the junctions of a motorway, e.g. road "M4" and
+// number "J12" (or just "12"). Without a number, all of the road's
+// junctions are returned.
+func (s *Service) FindJunctions(ctx context.Context, road string, number string) ([]models.Junction, error) {
+	road = strings.ReplaceAll(road, " ", "")
+	if road == "" {
+		return nil, fmt.Errorf("%w: a road is required", ErrInvalidRequest)
+	}
+	number = strings.TrimSpace(number)
+	if len(number) > 1 && (number[0] == 'J' || number[0] == 'j') {
+		number = strings.TrimSpace(number[1:])
+	}
+	if s.repo == nil {
+		return nil, fmt.Errorf("junction lookup is %w", ErrUnavailable)
+	}
+
+	junctions, err := s.repo.FindJunctions(ctx, road, number)
+	if err != nil {
+		return nil, err
+	}
+	if len(junctions) == 0 {
+		if number != "" {
+			road += " J" + number
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNoJunctionFound, road)
+	}
+	return junctions, nil
+}
@@ -0,0 +1,255 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+)
+
+var ErrNoRoute = errors.New("no route found")
+var ErrInvalidRequest = errors.New("invalid request")
+var ErrUnavailable = errors.New("not available without a database")
+var ErrNoJunctionFound = errors.New("no such motorway junction")
+
+type Service struct {
+	repo     repository.RoutingRepository
+	engine   Engine
+	matcher  Matcher
+	profiles map[string]models.Profile
+}
+
+// NewService creates a routing service which snaps points and finds paths
+// with the engine, matches traces with the matcher, and uses the repository
+// for isochrones. The repository may be nil when serving from a graph
+// snapshot, in which case isochrones are unavailable.
+func NewService(repo repository.RoutingRepository, engine Engine, matcher Matcher, profiles map[string]models.Profile) *Service {
+	return &Service{repo: repo, engine: engine, matcher: matcher, profiles: profiles}
+}
+
+// Profiles returns the available routing profiles, keyed by name.
+func (s *Service) Profiles() map[string]models.Profile {
+	return s.profiles
+}
+
+// Options common to all routing requests
+type RouteOptions struct {
+	// Name of the routing profile, or empty for the default profile
+	Profile string
+	// Either "distance" or "duration"; overrides the profile's metric if set
+	Minimise string
+	// Number of alternative routes to look for, in addition to the best
+	Alternatives int
+	// Road links and areas the route must not use
+	Avoid models.Avoid
+}
+
+// Profile resolves the routing profile for the options, falling back to the
+// default profile when no name is given. The returned profile's metric is
+// always set.
+func (s *Service) Profile(opts RouteOptions) (*models.Profile, error) {
+	return ResolveProfile(s.profiles, opts)
+}
+
+// ResolveProfile is Profile, over the given set of profiles.
+func ResolveProfile(profiles map[string]models.Profile, opts RouteOptions) (*models.Profile, error) {
+	name := opts.Profile
+	if name == "" {
+		name = DEFAULT_PROFILE
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownProfile, name)
+	}
+
+	if err := checkMetric(opts.Minimise); err != nil {
+		return nil, err
+	}
+	if opts.Minimise != "" {
+		profile.Metric = opts.Minimise
+	}
+	if profile.Metric == "" {
+		profile.Metric = models.METRIC_DISTANCE
+	}
+	return &profile, nil
+}
+
+// Route snaps each waypoint (origin, any via points, then destination) onto
+// its nearest road link and finds the cheapest path between each
+// consecutive pair over the road network, as weighted by the chosen profile.
+func (s *Service) Route(ctx context.Context, waypoints []models.Coordinate, opts RouteOptions) (*models.Route, error) {
+	if len(waypoints) < 2 {
+		return nil, fmt.Errorf("%w: at least two waypoints are required", ErrInvalidRequest)
+	}
+
+	profile, err := s.Profile(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Avoid.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+
+	points, err := s.snapToLinks(ctx, waypoints, profile, &opts.Avoid)
+	if err != nil {
+		return nil, err
+	}
+
+	pathOpts := models.PathOptions{Avoid: &opts.Avoid}
+	route, err := s.routePoints(ctx, points, profile, pathOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Alternatives > 0 {
+		route.Alternatives, err = s.alternatives(ctx, points, profile, pathOpts, route, opts.Alternatives)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return route, nil
+}
+
+// snapToNodes snaps each waypoint onto the nearest link the profile allows,
+// as snapToLinks does, and then onto the nearer end of that link, so that
+// node-to-node searches start from the same links as routes.
+func (s *Service) snapToNodes(ctx context.Context, waypoints []models.Coordinate, profile *models.Profile) ([]*models.SnappedNode, error) {
+	nodes, err := s.engine.NearestLinkNodes(ctx, waypoints, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snap waypoints: %w", err)
+	}
+	return nodes, nil
+}
+
+// snapToLinks snaps each waypoint onto the nearest road link the profile
+// allows and the route does not avoid, so that routes start and end partway
+// along links rather than detouring to the nearest node.
+func (s *Service) snapToLinks(ctx context.Context, waypoints []models.Coordinate, profile *models.Profile, avoid *models.Avoid) ([]*models.SnappedLink, error) {
+	points, err := s.engine.NearestLinks(ctx, waypoints, profile, avoid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snap waypoints: %w", err)
+	}
+	return points, nil
+}
+
+// routePoints stitches together the legs between consecutive snapped points.
+func (s *Service) routePoints(ctx context.Context, points []*models.SnappedLink, profile *models.Profile, opts models.PathOptions) (*models.Route, error) {
+	route := &models.Route{
+		Profile:  profile.Name,
+		Minimise: profile.Metric,
+		From:     points[0],
+		Via:      points[1 : len(points)-1],
+		To:       points[len(points)-1],
+		Links:    make([]string, 0),
+		Legs:     make([]models.RouteLeg, 0, len(points)-1),
+		Path:     make([]models.PathSegment, 0),
+	}
+
+	for i := 1; i < len(points); i++ {
+		leg, err := s.routeLeg(ctx, points[i-1], points[i], profile, opts)
+		if err != nil {
+			return nil, fmt.Errorf("leg %d: %w", i, err)
+		}
+
+		route.Legs = append(route.Legs, *leg)
+		route.Path = append(route.Path, leg.Path...)
+		route.Links = append(route.Links, leg.Links...)
+		route.DistanceM += leg.DistanceM
+		route.DurationS += leg.DurationS
+	}
+
+	return route, nil
+}
+
+func (s *Service) routeLeg(ctx context.Context, from, to *models.SnappedLink, profile *models.Profile, opts models.PathOptions) (*models.RouteLeg, error) {
+	leg := &models.RouteLeg{From: from, To: to, Links: make([]string, 0), Path: make([]models.PathSegment, 0)}
+	if from.ID == to.ID && from.Fraction == to.Fraction {
+		return leg, nil
+	}
+
+	segments, err := s.engine.ShortestPath(ctx, from, to, profile, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	leg.Path = segments
+	for i := range segments {
+		segment := &segments[i]
+		if duration, ok := profile.DurationSeconds(segment.LengthM); ok {
+			segment.DurationS = duration
+		}
+		leg.DistanceM += segment.LengthM
+		leg.DurationS += segment.DurationS
+		leg.Links = append(leg.Links, segment.GmlID)
+	}
+
+	return leg, nil
+}
+
+// RouteLinks fetches the attributes and geometry of every link along the
+// route, in travel order, with each centre line oriented in the direction of
+// travel. Links only partly traversed at either end of a leg are cut down to
+// the part travelled.
+func (s *Service) RouteLinks(ctx context.Context, route *models.Route) ([]models.RouteLink, error) {
+	ids := make([]int64, len(route.Path))
+	for i, segment := range route.Path {
+		ids[i] = segment.LinkID
+	}
+
+	fetched, err := s.engine.FetchRouteLinks(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]models.RouteLink, len(route.Path))
+	for i, segment := range route.Path {
+		link, ok := fetched[segment.LinkID]
+		if !ok {
+			return nil, fmt.Errorf("road link %s no longer exists", segment.GmlID)
+		}
+		if portion := segment.Portion; portion != nil {
+			from, to := math.Min(portion.From, portion.To), math.Max(portion.From, portion.To)
+			link.Elevations = link.CenterLine.SliceValues(link.Elevations, from, to)
+			link.CenterLine = link.CenterLine.Slice(from, to)
+			link.LengthM = segment.LengthM
+		}
+		// As travelled, which differs from the link's own duration for
+		// profiles with a fixed speed
+		link.DurationS = segment.DurationS
+		if !segment.Forward {
+			link.CenterLine = link.CenterLine.Reversed()
+			slices.Reverse(link.Elevations)
+			link.StartExits, link.EndExits = link.EndExits, link.StartExits
+		}
+		links[i] = link
+	}
+
+	return links, nil
+}
+
+type Nearest struct {
+	Node *models.SnappedNode `json:"node"`
+	Link *models.SnappedLink `json:"link"`
+}
+
+// Nearest returns the closest road node and road link to the coordinate.
+func (s *Service) Nearest(ctx context.Context, coord models.Coordinate) (*Nearest, error) {
+	node, err := s.engine.NearestNode(ctx, coord)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := s.engine.NearestLink(ctx, coord)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Nearest{Node: node, Link: link}, nil
+}
@@ -0,0 +1,105 @@
+package routing
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// ParseTrace reads the points of a GPS trace, in "gpx" or "csv" format.
+func ParseTrace(r io.Reader, format string) ([]models.Coordinate, error) {
+	switch format {
+	case "gpx":
+		return parseGpxTrace(r)
+	case "csv":
+		return parseCsvTrace(r)
+	}
+	return nil, fmt.Errorf("unsupported trace format '%s'", format)
+}
+
+// parseGpxTrace reads the track points of every track segment, in order, or
+// the route points if the file has no tracks.
+func parseGpxTrace(r io.Reader) ([]models.Coordinate, error) {
+	var gpx models.GPX
+	if err := xml.NewDecoder(r).Decode(&gpx); err != nil {
+		return nil, fmt.Errorf("invalid GPX: %v", err)
+	}
+
+	trace := make([]models.Coordinate, 0)
+	for _, track := range gpx.Tracks {
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				trace = append(trace, models.Coordinate{Lat: point.Lat, Lon: point.Lon})
+			}
+		}
+	}
+	if len(trace) == 0 {
+		for _, route := range gpx.Routes {
+			for _, point := range route.Points {
+				trace = append(trace, models.Coordinate{Lat: point.Lat, Lon: point.Lon})
+			}
+		}
+	}
+	return trace, nil
+}
+
+// parseCsvTrace reads one point per row. If the first row is a header, the
+// lat/latitude and lon/lng/longitude columns are used; otherwise the first
+// two columns are taken to be the latitude and longitude.
+func parseCsvTrace(r io.Reader) ([]models.Coordinate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	trace := make([]models.Coordinate, 0)
+	latColumn, lonColumn := 0, 1
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return trace, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+
+		if row == 1 && isCsvHeader(record) {
+			latColumn, lonColumn = -1, -1
+			for i, name := range record {
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "lat", "latitude":
+					latColumn = i
+				case "lon", "lng", "long", "longitude":
+					lonColumn = i
+				}
+			}
+			if latColumn < 0 || lonColumn < 0 {
+				return nil, fmt.Errorf("CSV header has no latitude and longitude columns")
+			}
+			continue
+		}
+
+		if len(record) <= max(latColumn, lonColumn) {
+			return nil, fmt.Errorf("CSV row %d has too few columns", row)
+		}
+		coord, err := models.ParseCoordinate(record[latColumn] + "," + record[lonColumn])
+		if err != nil {
+			return nil, fmt.Errorf("CSV row %d: %v", row, err)
+		}
+		trace = append(trace, *coord)
+	}
+}
+
+func isCsvHeader(record []string) bool {
+	for _, field := range record {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package routing
+
+import (
+	"math"
+)
+
+// SolveOrder finds a low-cost order in which to visit the stops of a
+// journey, given the matrix of travel costs between every pair of points.
+// Index 0 of the matrix is the fixed start and, if hasEnd is set, the last
+// index is the fixed end; the remaining indexes are the stops, which are
+// returned in visiting order. Unreachable pairs should have a cost of +Inf.
+//
+// The order is built by nearest neighbour, then improved by 2-opt and Or-opt
+// moves until neither finds a cheaper path.
+func SolveOrder(matrix [][]float64, hasEnd bool) []int {
+	last := len(matrix)
+	if hasEnd {
+		last--
+	}
+
+	order := nearestNeighbour(matrix, 1, last)
+	cost := func(order []int) float64 {
+		return pathCost(matrix, order, hasEnd)
+	}
+
+	best := cost(order)
+	for improved := true; improved; {
+		improved = false
+
+		// 2-opt: reverse the stops between i and j
+		for i := 0; i < len(order)-1; i++ {
+			for j := i + 1; j < len(order); j++ {
+				candidate := twoOpt(order, i, j)
+				if c := cost(candidate); c < best-1e-9 {
+					order, best, improved = candidate, c, true
+				}
+			}
+		}
+
+		// Or-opt: move a run of up to three stops elsewhere in the order
+		for length := 1; length <= 3; length++ {
+			for i := 0; i+length <= len(order); i++ {
+				for j := 0; j <= len(order)-length; j++ {
+					if j == i {
+						continue
+					}
+					candidate := orOpt(order, i, length, j)
+					if c := cost(candidate); c < best-1e-9 {
+						order, best, improved = candidate, c, true
+					}
+				}
+			}
+		}
+	}
+
+	return order
+}
+
+// nearestNeighbour greedily orders the stops [first, last) by repeatedly
+// visiting the cheapest unvisited stop from the current position.
+func nearestNeighbour(matrix [][]float64, first int, last int) []int {
+	visited := make([]bool, len(matrix))
+	order := make([]int, 0, last-first)
+
+	current := 0
+	for len(order) < last-first {
+		next, nextCost := -1, math.Inf(1)
+		for stop := first; stop < last; stop++ {
+			if !visited[stop] && (next == -1 || matrix[current][stop] < nextCost) {
+				next, nextCost = stop, matrix[current][stop]
+			}
+		}
+		visited[next] = true
+		order = append(order, next)
+		current = next
+	}
+	return order
+}
+
+// pathCost is the total cost of travelling from the start through the stops
+// in order, then on to the end if there is one.
+func pathCost(matrix [][]float64, order []int, hasEnd bool) float64 {
+	total, current := 0.0, 0
+	for _, stop := range order {
+		total += matrix[current][stop]
+		current = stop
+	}
+	if hasEnd {
+		total += matrix[current][len(matrix)-1]
+	}
+	return total
+}
+
+func twoOpt(order []int, i int, j int) []int {
+	result := make([]int, len(order))
+	copy(result, order)
+	for a, b := i, j; a < b; a, b = a+1, b-1 {
+		result[a], result[b] = result[b], result[a]
+	}
+	return result
+}
+
+// orOpt moves the run of stops starting at i to position j of the order
+// that remains once the run has been removed.
+func orOpt(order []int, i int, length int, j int) []int {
+	run := order[i : i+length]
+	rest := make([]int, 0, len(order)-length)
+	rest = append(rest, order[:i]...)
+	rest = append(rest, order[i+length:]...)
+
+	result := make([]int, 0, len(order))
+	result = append(result, rest[:j]...)
+	result = append(result, run...)
+	result = append(result, rest[j:]...)
+	return result
+}
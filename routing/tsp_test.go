@@ -0,0 +1,166 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// lineMatrix is the matrix of distances between points along a line.
+func lineMatrix(positions ...float64) [][]float64 {
+	matrix := make([][]float64, len(positions))
+	for i, a := range positions {
+		matrix[i] = make([]float64, len(positions))
+		for j, b := range positions {
+			matrix[i][j] = math.Abs(a - b)
+		}
+	}
+	return matrix
+}
+
+// randomMatrix is an asymmetric matrix of costs between n points, with the
+// given fraction of pairs unreachable.
+func randomMatrix(random *rand.Rand, n int, unreachable float64) [][]float64 {
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		matrix[i] = make([]float64, n)
+		for j := range matrix[i] {
+			switch {
+			case i == j:
+			case random.Float64() < unreachable:
+				matrix[i][j] = math.Inf(1)
+			default:
+				matrix[i][j] = 1 + random.Float64()*100
+			}
+		}
+	}
+	return matrix
+}
+
+// checkStops verifies that the order visits each stop exactly once, and
+// neither the start nor the end.
+func checkStops(t *testing.T, order []int, matrix [][]float64, hasEnd bool) {
+	t.Helper()
+	last := len(matrix)
+	if hasEnd {
+		last--
+	}
+	sorted := slices.Sorted(slices.Values(order))
+	for i, stop := range sorted {
+		if stop != i+1 {
+			t.Fatalf("order %v does not visit each of stops 1 to %d once", order, last-1)
+		}
+	}
+	if len(sorted) != last-1 {
+		t.Fatalf("order %v does not visit each of stops 1 to %d", order, last-1)
+	}
+}
+
+func TestSolveOrderRespectsStartAndEnd(t *testing.T) {
+	tests := []struct {
+		name      string
+		positions []float64
+		hasEnd    bool
+		cost      float64
+		// The only optimal order, if there is just one
+		expected []int
+	}{
+		{
+			// Out to the far side first, so as to finish at the end
+			name:      "start in the middle",
+			positions: []float64{0, 3, -1, 1, -3, 2, -2, 4},
+			hasEnd:    true,
+			cost:      10,
+			expected:  []int{2, 6, 4, 3, 5, 1},
+		},
+		{
+			// The end is beside the start, so the stops are visited on the
+			// way out and back
+			name:      "end beside start",
+			positions: []float64{0, 5, 2, 4, 1, 3, 0.5},
+			hasEnd:    true,
+			cost:      9.5,
+		},
+		{
+			name:      "no end",
+			positions: []float64{0, 4, 1, 3, 2},
+			cost:      4,
+			expected:  []int{2, 4, 3, 1},
+		},
+		{
+			name:      "single stop",
+			positions: []float64{0, 1, 2},
+			hasEnd:    true,
+			cost:      2,
+			expected:  []int{1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matrix := lineMatrix(test.positions...)
+			order := SolveOrder(matrix, test.hasEnd)
+			checkStops(t, order, matrix, test.hasEnd)
+			if cost := pathCost(matrix, order, test.hasEnd); cost != test.cost {
+				t.Fatalf("order %v costs %v, expected %v", order, cost, test.cost)
+			}
+			if test.expected != nil && !slices.Equal(order, test.expected) {
+				t.Fatalf("got order %v, expected %v", order, test.expected)
+			}
+		})
+	}
+}
+
+func TestSolveOrderNeverWorsens(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for round := range 50 {
+		hasEnd := round%2 == 0
+		matrix := randomMatrix(random, 3+random.Intn(15), 0.1*float64(round%3))
+		last := len(matrix)
+		if hasEnd {
+			last--
+		}
+
+		order := SolveOrder(matrix, hasEnd)
+		checkStops(t, order, matrix, hasEnd)
+		cost := pathCost(matrix, order, hasEnd)
+		if initial := pathCost(matrix, nearestNeighbour(matrix, 1, last), hasEnd); cost > initial {
+			t.Fatalf("round %d: improved order costs %v, more than the nearest neighbour order's %v", round, cost, initial)
+		}
+
+		// The result is a local optimum: no single move makes it cheaper
+		for i := 0; i < len(order)-1; i++ {
+			for j := i + 1; j < len(order); j++ {
+				if c := pathCost(matrix, twoOpt(order, i, j), hasEnd); c < cost-1e-9 {
+					t.Fatalf("round %d: 2-opt move (%d, %d) lowers the cost from %v to %v", round, i, j, cost, c)
+				}
+			}
+		}
+		for length := 1; length <= 3; length++ {
+			for i := 0; i+length <= len(order); i++ {
+				for j := 0; j <= len(order)-length; j++ {
+					moved := orOpt(order, i, length, j)
+					checkStops(t, moved, matrix, hasEnd)
+					if c := pathCost(matrix, moved, hasEnd); c < cost-1e-9 {
+						t.Fatalf("round %d: Or-opt move (%d, %d, %d) lowers the cost from %v to %v", round, i, length, j, cost, c)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOptimiseLimitsStops(t *testing.T) {
+	service := NewService(nil, nil, nil, nil)
+	for _, count := range []int{0, MAX_OPTIMISE_STOPS + 1} {
+		stops := make([]models.Coordinate, count)
+		_, err := service.Optimise(context.Background(), models.Coordinate{}, stops, nil, RouteOptions{})
+		if !errors.Is(err, ErrInvalidRequest) {
+			t.Fatalf("%d stops: expected an invalid request, got %v", count, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GET /isochrone?origin=lat,lon&budgets=10,20,30[&unit=min|m][&shape=hull|buffer][&profile=name]
+func (server *Server) handleIsochrone(w http.ResponseWriter, r *http.Request) {
+	origin, err := coordinateParam(r, "origin")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	budgets, err := floatsParam(r, "budgets")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	unit := r.URL.Query().Get("unit")
+	if unit == "" {
+		unit = "min"
+	}
+	shape := r.URL.Query().Get("shape")
+	if shape == "" {
+		shape = "hull"
+	}
+
+	isochrones, err := server.service.Isochrones(r.Context(), *origin, budgets, unit, shape, routeOptions(r))
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	writeGeoJSON(w, http.StatusOK, isochrones)
+}
+
+// floatsParam parses a comma-separated list of numbers.
+func floatsParam(r *http.Request, name string) ([]float64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, fmt.Errorf("missing '%s' parameter", name)
+	}
+
+	parts := strings.Split(value, ",")
+	results := make([]float64, len(parts))
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' parameter: %v", name, err)
+		}
+		results[i] = number
+	}
+	return results, nil
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/rm-hull/route-planner/routing"
+)
+
+// Upper limit on the size of uploaded traces
+const MAX_TRACE_BYTES = 16 << 20
+
+var traceFormats = map[string]string{
+	"application/gpx+xml": "gpx",
+	"text/csv":            "csv",
+}
+
+// POST /match[?format=gpx|csv], with the trace as the request body
+func (server *Server) handleMatch(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if format = traceFormats[mediaType]; format == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("missing 'format' parameter (or a Content-Type of application/gpx+xml or text/csv)"))
+			return
+		}
+	}
+
+	trace, err := routing.ParseTrace(http.MaxBytesReader(w, r.Body, MAX_TRACE_BYTES), format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := server.service.MatchTrace(r.Context(), trace)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
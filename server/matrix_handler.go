@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// POST /matrix
+func (server *Server) handleMatrix(w http.ResponseWriter, r *http.Request) {
+	var req models.MatrixRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	matrix, err := server.service.Matrix(r.Context(), req)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, matrix)
+}
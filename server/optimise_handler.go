@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/routing"
+)
+
+type optimiseRequest struct {
+	Start    *models.Coordinate  `json:"start"`
+	End      *models.Coordinate  `json:"end"`
+	Stops    []models.Coordinate `json:"stops"`
+	Profile  string              `json:"profile"`
+	Minimise string              `json:"minimise"`
+}
+
+// POST /optimise
+func (server *Server) handleOptimise(w http.ResponseWriter, r *http.Request) {
+	var req optimiseRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Start == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing 'start'"))
+		return
+	}
+
+	opts := routing.RouteOptions{Profile: req.Profile, Minimise: req.Minimise}
+	optimised, err := server.service.Optimise(r.Context(), *req.Start, req.Stops, req.End, opts)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, optimised)
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// GET /reverse?lat=..&lon=..
+func (server *Server) handleReverse(w http.ResponseWriter, r *http.Request) {
+	lat, lon := r.URL.Query().Get("lat"), r.URL.Query().Get("lon")
+	if lat == "" || lon == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing 'lat' or 'lon' parameter"))
+		return
+	}
+
+	coord, err := models.ParseCoordinate(lat + "," + lon)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	road, err := server.service.ReverseGeocode(r.Context(), *coord)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, road)
+}
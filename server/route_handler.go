@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rm-hull/route-planner/models"
+	"github.com/rm-hull/route-planner/repository"
+	"github.com/rm-hull/route-planner/routing"
+)
+
+// GET /route?from=lat,lon[&via=lat,lon...]&to=lat,lon[&profile=name][&minimise=distance|duration][&alternatives=k][&avoid_links=id,...][&avoid_areas=geojson][&format=json|geojson|gpx]
+func (server *Server) handleRoute(w http.ResponseWriter, r *http.Request) {
+	from, err := coordinateParam(r, "from")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	waypoints := []models.Coordinate{*from}
+	for i, value := range r.URL.Query()["via"] {
+		via, err := models.ParseCoordinate(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid 'via' parameter %d: %v", i+1, err))
+			return
+		}
+		waypoints = append(waypoints, *via)
+	}
+
+	to, err := coordinateParam(r, "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	waypoints = append(waypoints, *to)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	contentType, err := routing.ContentType(format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts := routeOptions(r)
+	if opts.Alternatives, err = intParam(r, "alternatives", 0); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.Avoid, err = avoidParams(r); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	route, err := server.service.Route(r.Context(), waypoints, opts)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	var body bytes.Buffer
+	if err := server.service.WriteRoute(r.Context(), &body, route, format); err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := body.WriteTo(w); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+// GET /profiles
+func (server *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles := make([]models.Profile, 0)
+	for _, profile := range server.service.Profiles() {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+// GET /nearest?point=lat,lon
+func (server *Server) handleNearest(w http.ResponseWriter, r *http.Request) {
+	point, err := coordinateParam(r, "point")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	nearest, err := server.service.Nearest(r.Context(), *point)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, nearest)
+}
+
+func routeOptions(r *http.Request) routing.RouteOptions {
+	return routing.RouteOptions{
+		Profile:  r.URL.Query().Get("profile"),
+		Minimise: r.URL.Query().Get("minimise"),
+	}
+}
+
+// avoidParams reads the comma-separated (and repeatable) avoid_links gml_ids
+// and the avoid_areas GeoJSON polygons.
+func avoidParams(r *http.Request) (models.Avoid, error) {
+	var avoid models.Avoid
+	for _, value := range r.URL.Query()["avoid_links"] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				avoid.Links = append(avoid.Links, id)
+			}
+		}
+	}
+
+	if value := r.URL.Query().Get("avoid_areas"); value != "" {
+		areas, err := models.ParseAvoidAreas([]byte(value))
+		if err != nil {
+			return avoid, fmt.Errorf("invalid 'avoid_areas' parameter: %v", err)
+		}
+		avoid.Areas = areas
+	}
+	return avoid, nil
+}
+
+func intParam(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid '%s' parameter: %s", name, value)
+	}
+	return number, nil
+}
+
+func coordinateParam(r *http.Request, name string) (*models.Coordinate, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, fmt.Errorf("missing '%s' parameter", name)
+	}
+
+	coord, err := models.ParseCoordinate(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s' parameter: %v", name, err)
+	}
+	return coord, nil
+}
+
+func writeRoutingError(w http.ResponseWriter, err error) {
+	if errors.Is(err, routing.ErrUnknownProfile) || errors.Is(err, routing.ErrUnknownMetric) ||
+		errors.Is(err, routing.ErrInvalidRequest) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if errors.Is(err, routing.ErrNoRoute) || errors.Is(err, routing.ErrNoJunctionFound) || errors.Is(err, repository.ErrNoNodeFound) ||
+		errors.Is(err, repository.ErrNoLinkFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, routing.ErrUnavailable) {
+		writeError(w, http.StatusNotImplemented, err)
+		return
+	}
+
+	log.Printf("routing failed: %v", err)
+	writeError(w, http.StatusInternalServerError, errors.New("internal server error"))
+}
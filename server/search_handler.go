@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// GET /roads?q=..[&limit=n]
+func (server *Server) handleSearchRoads(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid 'limit' parameter: %v", err))
+			return
+		}
+	}
+
+	roads, err := server.service.SearchRoads(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, roads)
+}
+
+// GET /junctions?road=M25[&number=10]
+func (server *Server) handleJunctions(w http.ResponseWriter, r *http.Request) {
+	junctions, err := server.service.FindJunctions(r.Context(), r.URL.Query().Get("road"), r.URL.Query().Get("number"))
+	if err != nil {
+		writeRoutingError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, junctions)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/rm-hull/route-planner/repository"
+	"github.com/rm-hull/route-planner/routing"
+)
+
+type Server struct {
+	service *routing.Service
+	tiles   repository.TileRepository
+	mux     *http.ServeMux
+}
+
+// NewServer creates the HTTP API over the routing service. Tiles may be nil
+// when serving without a database, in which case vector tiles are
+// unavailable.
+func NewServer(service *routing.Service, tiles repository.TileRepository) *Server {
+	server := &Server{service: service, tiles: tiles, mux: http.NewServeMux()}
+	server.mux.HandleFunc("GET /route", server.handleRoute)
+	server.mux.HandleFunc("GET /nearest", server.handleNearest)
+	server.mux.HandleFunc("GET /reverse", server.handleReverse)
+	server.mux.HandleFunc("GET /roads", server.handleSearchRoads)
+	server.mux.HandleFunc("GET /junctions", server.handleJunctions)
+	server.mux.HandleFunc("GET /profiles", server.handleProfiles)
+	server.mux.HandleFunc("POST /optimise", server.handleOptimise)
+	server.mux.HandleFunc("GET /isochrone", server.handleIsochrone)
+	server.mux.HandleFunc("POST /matrix", server.handleMatrix)
+	server.mux.HandleFunc("POST /match", server.handleMatch)
+	server.mux.HandleFunc("GET /tiles/{z}/{x}/{y}", server.handleTile)
+	return server
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Upper limit on the size of JSON request bodies
+const MAX_REQUEST_BYTES = 1 << 20
+
+func readJSON(w http.ResponseWriter, r *http.Request, body any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_REQUEST_BYTES))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	writeEncoded(w, status, "application/json", body)
+}
+
+func writeGeoJSON(w http.ResponseWriter, status int, body any) {
+	writeEncoded(w, status, "application/geo+json", body)
+}
+
+func writeEncoded(w http.ResponseWriter, status int, contentType string, body any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
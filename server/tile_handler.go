@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// GET /tiles/{z}/{x}/{y}.mvt
+func (server *Server) handleTile(w http.ResponseWriter, r *http.Request) {
+	if server.tiles == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("vector tiles are not available without a database"))
+		return
+	}
+
+	y, ok := strings.CutSuffix(r.PathValue("y"), ".mvt")
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unsupported tile format"))
+		return
+	}
+
+	var tile models.TileCoord
+	var errs [3]error
+	tile.Z, errs[0] = strconv.Atoi(r.PathValue("z"))
+	tile.X, errs[1] = strconv.Atoi(r.PathValue("x"))
+	tile.Y, errs[2] = strconv.Atoi(y)
+	if err := errors.Join(errs[:]...); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid tile coordinates: %v", err))
+		return
+	}
+	if err := tile.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	mvt, err := server.tiles.Tile(r.Context(), tile)
+	if err != nil {
+		log.Printf("tile failed: %v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("internal server error"))
+		return
+	}
+
+	if len(mvt) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(mvt); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package tiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+// Size of the fixed PMTiles (version 3) header
+const PMTILES_HEADER_BYTES = 127
+
+// The header and root directory must fit in the first 16KiB of an archive,
+// so that clients can fetch both with one request
+const PMTILES_ROOT_BYTES = 16384 - PMTILES_HEADER_BYTES
+
+// Number of entries in each leaf directory to start with, when the root
+// directory would be too big to hold them all
+const PMTILES_LEAF_ENTRIES = 4096
+
+// Compression type code for gzip, from the PMTiles specification
+const PMTILES_COMPRESSION_GZIP = 2
+
+// Tile type code for Mapbox Vector Tiles, from the PMTiles specification
+const PMTILES_TILE_TYPE_MVT = 1
+
+// A run of tiles with consecutive ids sharing the same data (or, in the
+// root directory, a leaf directory when runLength is 0)
+type pmtilesEntry struct {
+	tileID    uint64
+	offset    uint64
+	length    uint64
+	runLength uint32
+}
+
+// PMTilesWriter builds a PMTiles archive of vector tiles. Tile data is
+// spooled to a temporary file as it is written, and identical tiles are
+// stored only once; the archive itself is assembled by Finish.
+type PMTilesWriter struct {
+	data     *os.File
+	dataSize uint64
+	entries  []pmtilesEntry
+	contents map[[sha256.Size]byte]pmtilesEntry
+	minZoom  int
+	maxZoom  int
+}
+
+func NewPMTilesWriter() (*PMTilesWriter, error) {
+	data, err := os.CreateTemp("", "route-planner-tiles-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	return &PMTilesWriter{
+		data:     data,
+		contents: make(map[[sha256.Size]byte]pmtilesEntry),
+		minZoom:  math.MaxInt,
+		maxZoom:  -1,
+	}, nil
+}
+
+// WriteTile adds an (uncompressed) MVT tile to the archive.
+func (w *PMTilesWriter) WriteTile(tile models.TileCoord, mvt []byte) error {
+	entry := pmtilesEntry{tileID: TileID(tile), runLength: 1}
+	w.minZoom, w.maxZoom = min(w.minZoom, tile.Z), max(w.maxZoom, tile.Z)
+
+	hash := sha256.Sum256(mvt)
+	if existing, ok := w.contents[hash]; ok {
+		entry.offset, entry.length = existing.offset, existing.length
+		w.entries = append(w.entries, entry)
+		return nil
+	}
+
+	compressed, err := compress(mvt)
+	if err != nil {
+		return err
+	}
+	if _, err := w.data.Write(compressed); err != nil {
+		return fmt.Errorf("failed to write tile %s: %v", tile, err)
+	}
+
+	entry.offset, entry.length = w.dataSize, uint64(len(compressed))
+	w.dataSize += entry.length
+	w.contents[hash] = entry
+	w.entries = append(w.entries, entry)
+	return nil
+}
+
+// Finish writes the archive, with the given metadata and bounds, to out.
+func (w *PMTilesWriter) Finish(out io.Writer, metadata map[string]any, bounds models.BoundingBox) error {
+	if len(w.entries) == 0 {
+		return fmt.Errorf("no tiles to write")
+	}
+
+	entries := w.runs()
+	root, leaves, err := buildDirectories(entries)
+	if err != nil {
+		return err
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %v", err)
+	}
+	compressedMetadata, err := compress(metadataJSON)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, PMTILES_HEADER_BYTES)
+	header = append(header, "PMTiles"...)
+	header = append(header, 3)
+	offset := uint64(PMTILES_HEADER_BYTES)
+	for _, length := range []uint64{uint64(len(root)), uint64(len(compressedMetadata)), uint64(len(leaves)), w.dataSize} {
+		header = binary.LittleEndian.AppendUint64(header, offset)
+		header = binary.LittleEndian.AppendUint64(header, length)
+		offset += length
+	}
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(w.entries)))
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(entries)))
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(w.contents)))
+	// Tile data is written in the order tiles were rendered, not by id, so
+	// the archive is not clustered
+	header = append(header, 0, PMTILES_COMPRESSION_GZIP, PMTILES_COMPRESSION_GZIP, PMTILES_TILE_TYPE_MVT)
+	header = append(header, uint8(w.minZoom), uint8(w.maxZoom))
+	for _, degrees := range []float64{bounds.MinLon, bounds.MinLat, bounds.MaxLon, bounds.MaxLat} {
+		header = binary.LittleEndian.AppendUint32(header, uint32(e7(degrees)))
+	}
+	header = append(header, uint8(w.minZoom))
+	header = binary.LittleEndian.AppendUint32(header, uint32(e7((bounds.MinLon+bounds.MaxLon)/2)))
+	header = binary.LittleEndian.AppendUint32(header, uint32(e7((bounds.MinLat+bounds.MaxLat)/2)))
+
+	for _, section := range [][]byte{header, root, compressedMetadata, leaves} {
+		if _, err := out.Write(section); err != nil {
+			return fmt.Errorf("failed to write archive: %v", err)
+		}
+	}
+	if _, err := w.data.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read back tile data: %v", err)
+	}
+	if _, err := io.Copy(out, w.data); err != nil {
+		return fmt.Errorf("failed to write tile data: %v", err)
+	}
+	return nil
+}
+
+// Close removes the temporary tile data.
+func (w *PMTilesWriter) Close() error {
+	w.data.Close()
+	return os.Remove(w.data.Name())
+}
+
+// runs sorts the tiles by id, merging consecutive tiles with the same data
+// into runs.
+func (w *PMTilesWriter) runs() []pmtilesEntry {
+	sort.Slice(w.entries, func(i, j int) bool { return w.entries[i].tileID < w.entries[j].tileID })
+
+	runs := make([]pmtilesEntry, 0, len(w.entries))
+	for _, entry := range w.entries {
+		if n := len(runs); n > 0 {
+			last := &runs[n-1]
+			if last.offset == entry.offset && last.tileID+uint64(last.runLength) == entry.tileID {
+				last.runLength++
+				continue
+			}
+		}
+		runs = append(runs, entry)
+	}
+	return runs
+}
+
+// buildDirectories encodes the entries as a root directory, or if that
+// would be too big, as leaf directories of increasing size indexed by the
+// root directory.
+func buildDirectories(entries []pmtilesEntry) ([]byte, []byte, error) {
+	root, err := encodeDirectory(entries)
+	if err != nil || len(root) <= PMTILES_ROOT_BYTES {
+		return root, nil, err
+	}
+
+	for leafSize := PMTILES_LEAF_ENTRIES; ; leafSize += leafSize / 5 {
+		rootEntries := make([]pmtilesEntry, 0)
+		leaves := make([]byte, 0)
+		for start := 0; start < len(entries); start += leafSize {
+			leaf, err := encodeDirectory(entries[start:min(start+leafSize, len(entries))])
+			if err != nil {
+				return nil, nil, err
+			}
+			rootEntries = append(rootEntries, pmtilesEntry{tileID: entries[start].tileID, offset: uint64(len(leaves)), length: uint64(len(leaf))})
+			leaves = append(leaves, leaf...)
+		}
+
+		root, err := encodeDirectory(rootEntries)
+		if err != nil || len(root) <= PMTILES_ROOT_BYTES {
+			return root, leaves, err
+		}
+	}
+}
+
+// encodeDirectory serialises directory entries column by column as
+// varints (tile ids delta-encoded, and offsets omitted where they follow on
+// from the previous entry), then compresses them.
+func encodeDirectory(entries []pmtilesEntry) ([]byte, error) {
+	buf := binary.AppendUvarint(nil, uint64(len(entries)))
+	lastID := uint64(0)
+	for _, entry := range entries {
+		buf = binary.AppendUvarint(buf, entry.tileID-lastID)
+		lastID = entry.tileID
+	}
+	for _, entry := range entries {
+		buf = binary.AppendUvarint(buf, uint64(entry.runLength))
+	}
+	for _, entry := range entries {
+		buf = binary.AppendUvarint(buf, entry.length)
+	}
+	for i, entry := range entries {
+		if i > 0 && entry.offset == entries[i-1].offset+entries[i-1].length {
+			buf = binary.AppendUvarint(buf, 0)
+		} else {
+			buf = binary.AppendUvarint(buf, entry.offset+1)
+		}
+	}
+	return compress(buf)
+}
+
+// TileID numbers tiles along a Hilbert curve at each zoom level, after all
+// the tiles of the zoom levels below.
+func TileID(tile models.TileCoord) uint64 {
+	id := (uint64(1)<<(2*tile.Z) - 1) / 3
+	x, y := uint64(tile.X), uint64(tile.Y)
+	for a := tile.Z - 1; a >= 0; a-- {
+		s := uint64(1) << a
+		rx, ry := x&s, y&s
+		id += ((3 * rx) ^ ry) << a
+		if ry == 0 {
+			if rx != 0 {
+				x, y = s-1-x, s-1-y
+			}
+			x, y = y, x
+		}
+	}
+	return id
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// e7 converts degrees to the fixed-point form used in PMTiles headers.
+func e7(degrees float64) int32 {
+	return int32(math.Round(degrees * 1e7))
+}
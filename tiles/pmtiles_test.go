@@ -0,0 +1,195 @@
+package tiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/rm-hull/route-planner/models"
+)
+
+func TestTileID(t *testing.T) {
+	tests := []struct {
+		tile     models.TileCoord
+		expected uint64
+	}{
+		{models.TileCoord{Z: 0, X: 0, Y: 0}, 0},
+		{models.TileCoord{Z: 1, X: 0, Y: 0}, 1},
+		{models.TileCoord{Z: 1, X: 0, Y: 1}, 2},
+		{models.TileCoord{Z: 1, X: 1, Y: 1}, 3},
+		{models.TileCoord{Z: 1, X: 1, Y: 0}, 4},
+		{models.TileCoord{Z: 2, X: 0, Y: 0}, 5},
+		{models.TileCoord{Z: 3, X: 0, Y: 0}, 21},
+		{models.TileCoord{Z: 3, X: 7, Y: 0}, 84},
+		{models.TileCoord{Z: 12, X: 3423, Y: 1763}, 19078479},
+	}
+	for _, test := range tests {
+		if id := TileID(test.tile); id != test.expected {
+			t.Errorf("tile %s has id %d, expected %d", test.tile, id, test.expected)
+		}
+	}
+
+	// Each zoom level numbers its tiles without gaps or repeats
+	for z := range 5 {
+		first := TileID(models.TileCoord{Z: z})
+		seen := make(map[uint64]bool)
+		for x := range 1 << z {
+			for y := range 1 << z {
+				id := TileID(models.TileCoord{Z: z, X: x, Y: y})
+				if id < first || id >= first+1<<(2*z) || seen[id] {
+					t.Fatalf("tile %d/%d/%d has id %d, out of range or repeated", z, x, y, id)
+				}
+				seen[id] = true
+			}
+		}
+	}
+}
+
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// readDirectory decodes a directory written by encodeDirectory.
+func readDirectory(t *testing.T, data []byte) []pmtilesEntry {
+	t.Helper()
+	r := bytes.NewReader(gunzip(t, data))
+	next := func() uint64 {
+		value, err := binary.ReadUvarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	entries := make([]pmtilesEntry, next())
+	lastID := uint64(0)
+	for i := range entries {
+		entries[i].tileID = lastID + next()
+		lastID = entries[i].tileID
+	}
+	for i := range entries {
+		entries[i].runLength = uint32(next())
+	}
+	for i := range entries {
+		entries[i].length = next()
+	}
+	for i := range entries {
+		if offset := next(); offset == 0 {
+			entries[i].offset = entries[i-1].offset + entries[i-1].length
+		} else {
+			entries[i].offset = offset - 1
+		}
+	}
+	return entries
+}
+
+func TestPMTilesRoundTrip(t *testing.T) {
+	w, err := NewPMTilesWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Two tiles of the same (empty) content next to each other along the
+	// curve, so stored once as a run
+	tiles := map[models.TileCoord][]byte{
+		{Z: 12, X: 3423, Y: 1763}: []byte("first"),
+		{Z: 14, X: 8000, Y: 5000}: []byte("second"),
+		{Z: 13, X: 0, Y: 0}:       {},
+		{Z: 13, X: 0, Y: 1}:       {},
+	}
+	for _, tile := range []models.TileCoord{{Z: 14, X: 8000, Y: 5000}, {Z: 13, X: 0, Y: 1}, {Z: 12, X: 3423, Y: 1763}, {Z: 13, X: 0, Y: 0}} {
+		if err := w.WriteTile(tile, tiles[tile]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	bounds := models.BoundingBox{MinLon: -1.5, MinLat: 50.25, MaxLon: 0.5, MaxLat: 51.75}
+	if err := w.Finish(&out, map[string]any{"name": "test"}, bounds); err != nil {
+		t.Fatal(err)
+	}
+	archive := out.Bytes()
+	header := archive[:PMTILES_HEADER_BYTES]
+
+	if string(header[:7]) != "PMTiles" || header[7] != 3 {
+		t.Fatalf("bad magic or version: %q", header[:8])
+	}
+	u64 := func(at int) uint64 { return binary.LittleEndian.Uint64(header[at:]) }
+	i32 := func(at int) int32 { return int32(binary.LittleEndian.Uint32(header[at:])) }
+
+	// Root directory, metadata, leaf directories and tile data follow the
+	// header in turn
+	sections := make([][]byte, 4)
+	offset := uint64(PMTILES_HEADER_BYTES)
+	for i := range sections {
+		start, length := u64(8+16*i), u64(16+16*i)
+		if start != offset {
+			t.Fatalf("section %d starts at %d, expected %d", i, start, offset)
+		}
+		sections[i] = archive[start : start+length]
+		offset += length
+	}
+	if offset != uint64(len(archive)) {
+		t.Fatalf("sections end at %d, but the archive is %d bytes", offset, len(archive))
+	}
+	if len(sections[2]) != 0 {
+		t.Fatalf("expected no leaf directories, got %d bytes", len(sections[2]))
+	}
+
+	if addressed, entries, contents := u64(72), u64(80), u64(88); addressed != 4 || entries != 3 || contents != 3 {
+		t.Fatalf("got %d addressed tiles, %d entries and %d contents, expected 4, 3 and 3", addressed, entries, contents)
+	}
+	if clustered, internal, tile, kind := header[96], header[97], header[98], header[99]; clustered != 0 ||
+		internal != PMTILES_COMPRESSION_GZIP || tile != PMTILES_COMPRESSION_GZIP || kind != PMTILES_TILE_TYPE_MVT {
+		t.Fatalf("got clustered %d, compression %d/%d and tile type %d", clustered, internal, tile, kind)
+	}
+	if minZoom, maxZoom, centerZoom := header[100], header[101], header[118]; minZoom != 12 || maxZoom != 14 || centerZoom != 12 {
+		t.Fatalf("got zooms %d to %d (centre %d), expected 12 to 14 (centre 12)", minZoom, maxZoom, centerZoom)
+	}
+	got := []int32{i32(102), i32(106), i32(110), i32(114), i32(119), i32(123)}
+	expected := []int32{-15000000, 502500000, 5000000, 517500000, -5000000, 510000000}
+	if !slices.Equal(got, expected) {
+		t.Fatalf("got bounds and centre %v, expected %v", got, expected)
+	}
+
+	var metadata map[string]any
+	if err := json.Unmarshal(gunzip(t, sections[1]), &metadata); err != nil || metadata["name"] != "test" {
+		t.Fatalf("metadata did not round trip: %v (%v)", metadata, err)
+	}
+
+	// Every tile can be found through the root directory
+	root := readDirectory(t, sections[0])
+	for tile, mvt := range tiles {
+		id := TileID(tile)
+		i, _ := slices.BinarySearchFunc(root, id, func(entry pmtilesEntry, id uint64) int {
+			if entry.tileID+uint64(entry.runLength) <= id {
+				return -1
+			}
+			if entry.tileID > id {
+				return 1
+			}
+			return 0
+		})
+		if i == len(root) || root[i].tileID > id {
+			t.Fatalf("tile %s (id %d) is not in the root directory %+v", tile, id, root)
+		}
+		entry := root[i]
+		if data := gunzip(t, sections[3][entry.offset:entry.offset+entry.length]); !bytes.Equal(data, mvt) {
+			t.Fatalf("tile %s read back as %q, expected %q", tile, data, mvt)
+		}
+	}
+}